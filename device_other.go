@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// deviceID reports no device, device IDs are only used on Unix-like systems.
+func deviceID(os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// isCrossDeviceError reports no cross-device rename errors, moving files between volumes is only supported on Unix-like
+// systems.
+func isCrossDeviceError(error) bool {
+	return false
+}
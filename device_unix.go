@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// deviceID returns the ID of the device (volume) the file is stored on.
+func deviceID(fileInfo os.FileInfo) (uint64, bool) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	// The type of Dev differs between platforms
+	return uint64(stat.Dev), true
+}
+
+// isCrossDeviceError reports whether a rename failed because the target is on another device (volume).
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// diskUsage reports the disk usage as unknown, the allocated blocks are only exposed on Unix-like systems.
+func diskUsage(os.FileInfo) (int64, bool) {
+	return 0, false
+}
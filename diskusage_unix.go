@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// diskUsage returns the bytes allocated for the file on disk, which is less than its size for sparse files.
+func diskUsage(fileInfo os.FileInfo) (int64, bool) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	// Blocks are counted in units of 512 bytes, regardless of the block size of the file system
+	return int64(stat.Blocks) * 512, true
+}
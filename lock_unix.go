@@ -0,0 +1,40 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// dbLockSupported tells whether concurrent invocations are kept from modifying the same DB file
+const dbLockSupported = true
+
+// lockFile takes an exclusive advisory lock on the file, creating it if needed. It fails with errDBLocked instead of
+// waiting if another process holds the lock.
+func lockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file %s, err: %w", path, err)
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+
+		return nil, errDBLocked
+	}
+
+	if err != nil {
+		file.Close()
+
+		return nil, fmt.Errorf("unable to lock file %s, err: %w", path, err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
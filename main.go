@@ -1,32 +1,84 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/gob"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
 	"log"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/urfave/cli/v2"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
-	scanDir    = "scanDir"
-	termSearch = "termSearch"
-	ts         = "ts"
-	fileSearch = "fileSearch"
-	fs         = "fs"
-	stats      = "stats"
-	s          = "s"
-	duplicates = "duplicates"
-	d          = "d"
+	scanDir           = "scanDir"
+	termSearch        = "termSearch"
+	ts                = "ts"
+	fileSearch        = "fileSearch"
+	fs                = "fs"
+	tag               = "tag"
+	canonical         = "canonical"
+	verify            = "verify"
+	report            = "report"
+	partialDuplicates = "partial-duplicates"
+	orphans           = "orphans"
+	empty             = "empty"
+	uniqueTo          = "unique-to"
+	overlap           = "overlap"
+	reconcile         = "reconcile"
+	roots             = "roots"
+	collisions        = "collisions"
+	snapshot          = "snapshot"
+	trend             = "trend"
+	under             = "under"
+	byHash            = "byhash"
+	dedupRecords      = "dedup-records"
+	applyPlan         = "apply-plan"
+	importManifest    = "import-manifest"
+	terms             = "terms"
+	watch             = "watch"
+	reindex           = "reindex"
+	serve             = "serve"
+	repl              = "repl"
+	rehash            = "rehash"
+	convert           = "convert"
+	stats             = "stats"
+	s                 = "s"
+	duplicates        = "duplicates"
+	d                 = "d"
 )
 
 const (
@@ -34,13 +86,76 @@ const (
 	fast = "fast"
 )
 
+const (
+	formatText      = "text"
+	formatCSV       = "csv"
+	formatJSON      = "json"
+	formatTSV       = "tsv"
+	formatTable     = "table"
+	formatSparkline = "sparkline"
+)
+
+const (
+	showTimeRelative = "relative"
+	showTimeAbsolute = "absolute"
+)
+
+const (
+	hashAlgoMD5    = "md5"
+	hashAlgoSHA256 = "sha256"
+)
+
+const (
+	samplePositionHead = "head"
+	samplePositionTail = "tail"
+	samplePositionBoth = "both"
+)
+
+const (
+	// hashModeFullMD5 marks the md5 hashes of whole files, e.g. imported from md5sum manifests
+	hashModeFullMD5 = "full-md5"
+	// hashModeTree marks the hashes combined from the hashes of the chunks of the whole file, see treeHashFile
+	hashModeTree = "tree"
+	// treeHashChunkSize is the size of the chunks hashed in parallel by the tree hash
+	treeHashChunkSize = 4 * MB
+)
+
+const (
+	duplicateModeDefault   = "default"
+	duplicateModeExactName = "exact-name"
+	duplicateModeStem      = "stem"
+	duplicateModeStat      = "stat"
+)
+
 const (
 	MB = 1024 * 1024
 )
 
+const (
+	defaultAddr     = "localhost:8080"
+	shutdownTimeout = 5 * time.Second
+	// defaultPollInterval is the time between two scans when watching by polling
+	defaultPollInterval = 5 * time.Minute
+)
+
 const (
 	maxLines         = 100
 	defaultMinLength = 15
+	// defaultMaxResults is the default cap of the IDs collected by a search, to avoid running out of memory
+	defaultMaxResults = 10_000_000
+	// minHashPrefixLength is the shortest hash prefix looked up, shorter ones would match too many files
+	minHashPrefixLength = 6
+	// defaultMaxTermLength is the length above which search terms are split into chunks, unless configured otherwise
+	defaultMaxTermLength = 128
+)
+
+const (
+	// maxPreviewSize is the size above which files are not previewed
+	maxPreviewSize = 100 * MB
+	// previewReadSize is the number of bytes read from the beginning of a file for previews
+	previewReadSize = 4096
+	// previewHexSize is the number of bytes displayed for previews of binary files
+	previewHexSize = 64
 )
 
 const (
@@ -53,6 +168,153 @@ const (
 const (
 	flagMode            = "mode"
 	flagSearchMinLength = "search-min-length"
+	flagSinceScan       = "since-scan"
+	flagLimitPerGroup   = "limit-results-per-group"
+	flagCheckpoint      = "checkpoint"
+	flagTree            = "tree"
+	flagDepth           = "depth"
+	flagExperimental    = "experimental"
+	flagVerbose         = "verbose"
+	flagIgnoreCase      = "ignore-case"
+	flagMaxReadRate     = "max-read-rate"
+	flagFormat          = "format"
+	flagReportFormat    = "report-format"
+	flagProgress        = "progress"
+	flagNoHash          = "no-hash"
+	flagHashMissing     = "hash-missing"
+	flagIncludeHidden   = "include-hidden"
+	flagPreview         = "preview"
+	flagParallel        = "parallel"
+	flagTrash           = "trash"
+	flagSummaryOnly     = "summary-only"
+	flagSamplePosition  = "sample-position"
+	flagInspectArchives = "inspect-archives"
+	flagMinTermLength   = "min-term-length"
+	flagMaxTermLength   = "max-term-length"
+	flagDryRun          = "dry-run"
+	flagExt             = "ext"
+	flagCRC32           = "crc32"
+	flagDeleteEmptyDirs = "delete-empty-dirs"
+	flagAddr            = "addr"
+	flagAlgo            = "algo"
+	flagPreferOlderThan = "prefer-delete-older-than"
+	flagConfirmEach     = "confirm-each"
+	flagUpdateHashes    = "update-hashes-on-load"
+	flagSizeTolerance   = "size-tolerance"
+	flagExcludeRoot     = "exclude-root"
+	flagShowTime        = "show-time"
+	flagShowMatches     = "show-matches"
+	flagDedupeOutput    = "dedupe-output"
+	flagTopTerms        = "top-terms"
+	flagMaxCandidates   = "max-candidates"
+	flagJSONErrors      = "json-errors"
+	flagSamplePercent   = "sample-percent"
+	flagSeed            = "seed"
+	flagMoveTo          = "move-duplicates-to"
+	flagMaxResults      = "max-results"
+	flagPoll            = "poll"
+	flagInterval        = "interval"
+	flagResume          = "resume"
+	flagByType          = "by-type"
+	flagPlan            = "plan"
+	flagAuto            = "auto"
+	flagKeepPattern     = "keep-pattern"
+	flagStorePerms      = "store-perms"
+	flagMinGroupSize    = "min-group-size"
+	flagShowPerms       = "show-perms"
+	flagFlushEvery      = "flush-every"
+	flagTreeHash        = "tree-hash"
+	flagSkipEmpty       = "skip-empty"
+	flagMetricsCSV      = "metrics-csv"
+	flagDelimiter       = "delimiter"
+	flagUnset           = "unset"
+)
+
+// Columns of the DB file. Only the first three are mandatory, the rest may be missing from older DB files.
+const (
+	colPath = iota
+	colSize
+	colHash
+	colModTime
+	colTags
+	colSamplePosition
+	colCRC32
+	colAlgoHashes
+	colHashMode
+	colRoot
+	colMode
+	colOwner
+	colDiskSize
+	colCanonical
+)
+
+const tagSeparator = ";"
+
+// stdinDBFile as the DB file makes the commands read the DB from stdin
+const stdinDBFile = "-"
+
+// Codes of the errors reported by the commands, see Output.Errorf
+const (
+	errCodeReadDB     = "read_db"
+	errCodeWriteDB    = "write_db"
+	errCodeReadFile   = "read_file"
+	errCodeDeleteFile = "delete_file"
+	errCodeSearch     = "search"
+	errCodeScan       = "scan"
+	errCodeVerify     = "verify"
+	errCodeLockDB     = "lock_db"
+	errCodeUpdateDB   = "update_db"
+	errCodeWriteFile  = "write_file"
+	errCodeMoveFile   = "move_file"
+	errCodeServe      = "serve"
+	errCodePlanEntry  = "plan_entry"
+)
+
+// envSearchMode sets the default search mode of the search commands
+const envSearchMode = "FC_SEARCH_MODE"
+
+// binaryDBExtension selects the binary DB format, which loads much faster than CSV but is not human-readable
+const binaryDBExtension = ".fcdb"
+
+// binaryDBVersion is the version of the binary DB format, stored at the beginning of the file. Version 1 files are
+// still loaded, but their search terms are recalculated.
+const binaryDBVersion = 2
+
+// acceptSuggestion is the answer accepting the files suggested for deletion
+const acceptSuggestion = "s"
+
+// algoHashSeparator separates the algorithm from the hash in the algorithm hashes column, e.g. sha256:abc
+const algoHashSeparator = ":"
+
+// archiveSeparator separates the path of an archive from the path of an entry inside it, e.g. archive.zip::inner/file.txt
+const archiveSeparator = "::"
+
+const metaFileSuffix = ".meta"
+
+// delimiterMarker starts the first line of CSV DB files using a delimiter other than comma, e.g. #delimiter=tab
+const delimiterMarker = "#delimiter="
+
+// historyFileSuffix is the suffix of the file next to the DB file storing the snapshots of the catalog
+const historyFileSuffix = ".history"
+
+// tempFileSuffix is the suffix of the file next to the DB file written first, replacing the DB file once complete
+const tempFileSuffix = ".tmp"
+
+// lockFileSuffix is the suffix of the file next to the DB file locked by the commands modifying the catalog
+const lockFileSuffix = ".lock"
+
+// artifactsFileSuffix is the suffix of the file next to the DB file listing the files and directories written by the
+// commands (e.g. plans, checkpoints or the directories duplicates were moved to), which are never catalogued
+const artifactsFileSuffix = ".artifacts"
+
+// sparklineBars are the bars of sparklines, from the lowest to the highest value
+const sparklineBars = "▁▂▃▄▅▆▇█"
+
+// metaSetting marks the rows of the meta file storing settings of the DB instead of the last scan time of a root
+const (
+	metaSetting              = "setting"
+	metaSettingMinTermLength = "min-term-length"
+	metaSettingMaxTermLength = "max-term-length"
 )
 
 func main() {
@@ -65,15 +327,134 @@ func main() {
 
 func CreateApp(output Output) *cli.App {
 	return &cli.App{
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  flagJSONErrors,
+				Usage: "Report errors as JSON objects with a code and a message on stderr",
+			},
+		},
+		Before: func(cCtx *cli.Context) error {
+			if cCtx.Bool(flagJSONErrors) {
+				output = NewJSONErrorOutput(output, os.Stderr)
+			}
+
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:  scanDir,
 				Usage: "Scan will scan a list of directories and store them in the DB file",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  flagSinceScan,
+						Usage: "Re-hash known files modified since the last scan of their root",
+					},
+					&cli.BoolFlag{
+						Name:  flagVerbose,
+						Usage: "List the paths which could not be read",
+					},
+					&cli.StringFlag{
+						Name:  flagMaxReadRate,
+						Usage: "Limit the read throughput of hashing, e.g. 50MB (per second)",
+					},
+					&cli.BoolFlag{
+						Name:  flagProgress,
+						Usage: "Report the progress of the scan based on the bytes processed",
+					},
+					&cli.BoolFlag{
+						Name:  flagNoHash,
+						Usage: "Store new files without hashing them, for a quick inventory",
+					},
+					&cli.BoolFlag{
+						Name:  flagHashMissing,
+						Usage: "Hash known files which were stored without a hash",
+					},
+					&cli.BoolFlag{
+						Name:  flagIncludeHidden,
+						Usage: "Catalog hidden files and directories (starting with a dot) as well",
+					},
+					&cli.BoolFlag{
+						Name:  flagParallel,
+						Usage: "Scan all roots concurrently, useful when they are on different devices",
+					},
+					&cli.StringFlag{
+						Name:  flagSamplePosition,
+						Value: samplePositionHead,
+						Usage: "Hash a sample from the beginning (head), the end (tail) or both ends (both) of large files",
+					},
+					&cli.BoolFlag{
+						Name:  flagInspectArchives,
+						Usage: "Catalog the contents of zip and tar archives as well",
+					},
+					&cli.IntFlag{
+						Name:  flagMinTermLength,
+						Usage: "Drop search terms shorter than this from the index, stored for later use (0 keeps the stored setting)",
+					},
+					&cli.IntFlag{
+						Name:  flagMaxTermLength,
+						Usage: "Split search terms longer than this into chunks, stored for later use (0 keeps the stored setting, 128 by default)",
+					},
+					&cli.BoolFlag{
+						Name:  flagCRC32,
+						Usage: "Store a CRC32 checksum of the hashed sample as well, used by verify to quickly reject changed files",
+					},
+					&cli.StringFlag{
+						Name:  flagAlgo,
+						Value: hashAlgoMD5,
+						Usage: "Hash algorithm used for new files: md5 or sha256",
+					},
+					&cli.StringSliceFlag{
+						Name:  flagExcludeRoot,
+						Usage: "Skip the subtree under this path, e.g. --exclude-root /data/tmp",
+					},
+					&cli.BoolFlag{
+						Name:  flagResume,
+						Usage: "Resume an interrupted scan, re-hashing known files only if their size or modification time changed",
+					},
+					&cli.BoolFlag{
+						Name:  flagStorePerms,
+						Usage: "Store the permission bits and the owner (uid:gid, on Unix) of new or changed files",
+					},
+					&cli.IntFlag{
+						Name:  flagFlushEvery,
+						Usage: "Write the DB file after every N new or updated files, so that an interrupted scan can be resumed (0 means only at the end)",
+					},
+					&cli.BoolFlag{
+						Name:  flagTreeHash,
+						Usage: "Hash new files in full, reading fixed-size chunks in parallel (tree hashes are only compared to each other)",
+					},
+				},
 				Action: func(cCtx *cli.Context) error {
+					maxReadRate, err := parseByteSize(cCtx.String(flagMaxReadRate))
+					if err != nil {
+						return err
+					}
+
 					return ScanCommand(
 						output,
 						cCtx.Args().Get(0),
 						cCtx.Args().Slice()[1:],
+						ScanOptions{
+							SinceScan:       cCtx.Bool(flagSinceScan),
+							Verbose:         cCtx.Bool(flagVerbose),
+							MaxReadRate:     maxReadRate,
+							Progress:        cCtx.Bool(flagProgress),
+							NoHash:          cCtx.Bool(flagNoHash),
+							HashMissing:     cCtx.Bool(flagHashMissing),
+							IncludeHidden:   cCtx.Bool(flagIncludeHidden),
+							Parallel:        cCtx.Bool(flagParallel),
+							SamplePosition:  cCtx.String(flagSamplePosition),
+							InspectArchives: cCtx.Bool(flagInspectArchives),
+							MinTermLength:   cCtx.Int(flagMinTermLength),
+							MaxTermLength:   cCtx.Int(flagMaxTermLength),
+							CRC32:           cCtx.Bool(flagCRC32),
+							HashAlgo:        cCtx.String(flagAlgo),
+							ExcludeRoots:    cCtx.StringSlice(flagExcludeRoot),
+							Resume:          cCtx.Bool(flagResume),
+							FlushEvery:      cCtx.Int(flagFlushEvery),
+							StorePerms:      cCtx.Bool(flagStorePerms),
+							TreeHash:        cCtx.Bool(flagTreeHash),
+						},
 					)
 				},
 			},
@@ -82,16 +463,56 @@ func CreateApp(output Output) *cli.App {
 				Aliases: []string{ts},
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:  flagMode,
-						Value: slow,
-						Usage: "Find only exact-search terms (fast) or search by contains (slow)",
+						Name:    flagMode,
+						Value:   slow,
+						Usage:   "Find only exact-search terms (fast) or search by contains (slow)",
+						EnvVars: []string{envSearchMode},
+					},
+					&cli.StringFlag{
+						Name:  flagFormat,
+						Value: formatText,
+						Usage: "Output format of the results: text, csv, tsv or json",
+					},
+					&cli.StringFlag{
+						Name:  flagShowTime,
+						Usage: "Show the modification time of each file: relative (e.g. 3 months ago) or absolute",
+					},
+					&cli.BoolFlag{
+						Name:  flagShowMatches,
+						Usage: "Show the stored search terms which matched the searched terms for each result",
+					},
+					&cli.BoolFlag{
+						Name:  flagShowPerms,
+						Usage: "Show the permission bits and owner of each result, as stored by scanDir --store-perms",
+					},
+					&cli.BoolFlag{
+						Name:  flagDedupeOutput,
+						Usage: "Print each path only once, even if it was found multiple times",
+					},
+					&cli.IntFlag{
+						Name:  flagMaxCandidates,
+						Usage: "Stop searching if a single term matches more files than this in slow mode (0 means no limit)",
+					},
+					&cli.IntFlag{
+						Name:  flagMaxResults,
+						Value: defaultMaxResults,
+						Usage: "Stop searching if the terms together match more files than this (0 means no limit)",
 					},
 				},
 				Action: func(cCtx *cli.Context) error {
 					return TermSearchCommand(
 						output,
 						cCtx.Args().Get(0),
-						cCtx.String(flagMode),
+						SearchOptions{
+							Mode:          cCtx.String(flagMode),
+							Format:        cCtx.String(flagFormat),
+							ShowTime:      cCtx.String(flagShowTime),
+							ShowMatches:   cCtx.Bool(flagShowMatches),
+							ShowPerms:     cCtx.Bool(flagShowPerms),
+							Dedupe:        cCtx.Bool(flagDedupeOutput),
+							MaxCandidates: cCtx.Int(flagMaxCandidates),
+							MaxResults:    cCtx.Int(flagMaxResults),
+						},
 						cCtx.Args().Slice()[1:],
 					)
 				},
@@ -99,12 +520,135 @@ func CreateApp(output Output) *cli.App {
 			{
 				Name:    fileSearch,
 				Aliases: []string{fs},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    flagMode,
+						Value:   slow,
+						Usage:   "Find only exact-search terms (fast) or search by contains (slow)",
+						EnvVars: []string{envSearchMode},
+					},
+					&cli.StringFlag{
+						Name:  flagFormat,
+						Value: formatText,
+						Usage: "Output format of the results: text, csv, tsv or json",
+					},
+					&cli.StringFlag{
+						Name:  flagShowTime,
+						Usage: "Show the modification time of each file: relative (e.g. 3 months ago) or absolute",
+					},
+					&cli.BoolFlag{
+						Name:  flagShowMatches,
+						Usage: "Show the stored search terms which matched the searched terms for each result",
+					},
+					&cli.BoolFlag{
+						Name:  flagShowPerms,
+						Usage: "Show the permission bits and owner of each result, as stored by scanDir --store-perms",
+					},
+					&cli.BoolFlag{
+						Name:  flagDedupeOutput,
+						Usage: "Print each path only once, even if it was found multiple times",
+					},
+					&cli.IntFlag{
+						Name:  flagMaxCandidates,
+						Usage: "Stop searching if a single term matches more files than this in slow mode (0 means no limit)",
+					},
+					&cli.IntFlag{
+						Name:  flagMaxResults,
+						Value: defaultMaxResults,
+						Usage: "Stop searching if the terms together match more files than this (0 means no limit)",
+					},
+				},
 				Action: func(cCtx *cli.Context) error {
 					return FileSearchCommand(
 						output,
 						cCtx.Args().Get(0),
-						cCtx.String(flagMode),
+						SearchOptions{
+							Mode:          cCtx.String(flagMode),
+							Format:        cCtx.String(flagFormat),
+							ShowTime:      cCtx.String(flagShowTime),
+							ShowMatches:   cCtx.Bool(flagShowMatches),
+							ShowPerms:     cCtx.Bool(flagShowPerms),
+							Dedupe:        cCtx.Bool(flagDedupeOutput),
+							MaxCandidates: cCtx.Int(flagMaxCandidates),
+							MaxResults:    cCtx.Int(flagMaxResults),
+						},
+						cCtx.Args().Get(1),
+					)
+				},
+			},
+			{
+				Name:      tag,
+				Usage:     "Tag will add tags to a file already in the DB file",
+				ArgsUsage: "<db file> <file path> <tag>...",
+				Action: func(cCtx *cli.Context) error {
+					return TagCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+						cCtx.Args().Slice()[2:],
+					)
+				},
+			},
+			{
+				Name:      canonical,
+				Usage:     "Canonical will mark a file as the copy to keep of its content, so that its duplicates are not reported anymore",
+				ArgsUsage: "<db file> <file path>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  flagUnset,
+						Usage: "Remove the mark instead of setting it",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return CanonicalCommand(
+						output,
+						cCtx.Args().Get(0),
 						cCtx.Args().Get(1),
+						!cCtx.Bool(flagUnset),
+					)
+				},
+			},
+			{
+				Name:  verify,
+				Usage: "Verify will re-hash catalogued files and report the ones which changed or went missing",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  flagCheckpoint,
+						Usage: "File recording verified paths, so that an interrupted verification can be resumed",
+					},
+					&cli.StringFlag{
+						Name:  flagMaxReadRate,
+						Usage: "Limit the read throughput of hashing, e.g. 50MB (per second)",
+					},
+					&cli.Float64Flag{
+						Name:  flagSamplePercent,
+						Usage: "Verify only a random sample of this percent of the files (0 means all files)",
+					},
+					&cli.Int64Flag{
+						Name:  flagSeed,
+						Usage: "Seed of the random sample, for reproducing a run (random by default)",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					maxReadRate, err := parseByteSize(cCtx.String(flagMaxReadRate))
+					if err != nil {
+						return err
+					}
+
+					seed := cCtx.Int64(flagSeed)
+					if !cCtx.IsSet(flagSeed) {
+						seed = time.Now().UnixNano()
+					}
+
+					return VerifyCommand(
+						output,
+						cCtx.Args().Get(0),
+						VerifyOptions{
+							Checkpoint:    cCtx.String(flagCheckpoint),
+							MaxReadRate:   maxReadRate,
+							SamplePercent: cCtx.Float64(flagSamplePercent),
+							Seed:          seed,
+						},
 					)
 				},
 			},
@@ -117,795 +661,8330 @@ func CreateApp(output Output) *cli.App {
 						Value: defaultMinLength,
 						Usage: "Find only exact-search terms (fast) or search by contains (slow)",
 					},
+					&cli.IntFlag{
+						Name:  flagLimitPerGroup,
+						Usage: "Display at most this many files per duplicate group (0 means no limit)",
+					},
+					&cli.StringFlag{
+						Name:  flagMode,
+						Value: duplicateModeDefault,
+						Usage: "Find duplicates by size, hash and search terms (default), by identical file names (exact-name) or by file names without extension and size (stem) or by file name, size and modification time (stat)",
+					},
+					&cli.BoolFlag{
+						Name:  flagIgnoreCase,
+						Usage: "Compare file names case-insensitively in exact-name and stem modes",
+					},
+					&cli.StringFlag{
+						Name:  flagReportFormat,
+						Value: formatText,
+						Usage: "Interactive review (text) or a non-interactive report of all duplicate groups (csv or tsv)",
+					},
+					&cli.IntFlag{
+						Name:  flagPreview,
+						Usage: "Print the first N lines of each file (or a hex dump of binary files) before the delete prompt (0 means no preview)",
+					},
+					&cli.BoolFlag{
+						Name:  flagTrash,
+						Usage: "Move deleted files to the trash instead of removing them permanently",
+					},
+					&cli.BoolFlag{
+						Name:  flagSummaryOnly,
+						Usage: "Only print the number of duplicate groups and reclaimable bytes, without prompting",
+					},
+					&cli.StringSliceFlag{
+						Name:  flagExt,
+						Usage: "Only consider files with these extensions, e.g. --ext jpg --ext png",
+					},
+					&cli.BoolFlag{
+						Name:  flagDeleteEmptyDirs,
+						Usage: "Remove the directories which became empty by deleting files, except for scan roots",
+					},
+					&cli.StringFlag{
+						Name:  flagAlgo,
+						Value: hashAlgoMD5,
+						Usage: "Hash algorithm used for finding duplicates by content: md5 or sha256",
+					},
+					&cli.DurationFlag{
+						Name:  flagPreferOlderThan,
+						Usage: "Suggest deleting the files of each group modified before this long ago, e.g. 720h, keeping at least one",
+					},
+					&cli.BoolFlag{
+						Name:  flagConfirmEach,
+						Usage: "Ask for confirmation before deleting each selected file",
+					},
+					&cli.StringFlag{
+						Name:  flagShowTime,
+						Usage: "Show the modification time of each file: relative (e.g. 3 months ago) or absolute",
+					},
+					&cli.StringFlag{
+						Name:  flagSizeTolerance,
+						Usage: "Group files with matching hashes whose sizes differ by at most this much, e.g. 16B, 1KB or 0.1%",
+					},
+					&cli.StringFlag{
+						Name:  flagMoveTo,
+						Usage: "Move all but the first file of each group with matching hashes into a dated folder of this directory, without prompting",
+					},
+					&cli.BoolFlag{
+						Name:  flagByType,
+						Usage: "Only print the reclaimable bytes of duplicates per file extension, the largest first, without prompting",
+					},
+					&cli.IntFlag{
+						Name:  flagMinGroupSize,
+						Usage: "Only consider groups with at least this many files, e.g. 5 to skip pairs and triples",
+					},
+					&cli.BoolFlag{
+						Name:  flagHashMissing,
+						Usage: "Hash the files stored without a hash which have the same size as other files, storing the hashes",
+					},
+					&cli.BoolFlag{
+						Name:  flagSkipEmpty,
+						Value: true,
+						Usage: "Leave zero-byte files out of the groups by size and hash, only counting them (see the empty command)",
+					},
+					&cli.BoolFlag{
+						Name:  flagAuto,
+						Usage: "Resolve the groups with matching hashes by the --keep-pattern rule instead of prompting",
+					},
+					&cli.StringFlag{
+						Name:  flagKeepPattern,
+						Usage: "Keep the file of each group whose path matches this regular expression and delete the others, skipping groups where not exactly one file matches, e.g. --keep-pattern '^/master/'",
+					},
+					&cli.StringFlag{
+						Name:  flagPlan,
+						Usage: "Write the files selected for deletion to this plan file instead of deleting them, see apply-plan",
+					},
 				},
 				Action: func(cCtx *cli.Context) error {
+					sizeTolerance, sizeTolerancePercent, err := parseSizeTolerance(cCtx.String(flagSizeTolerance))
+					if err != nil {
+						return err
+					}
+
+					var keepPattern *regexp.Regexp
+					if cCtx.String(flagKeepPattern) != "" {
+						keepPattern, err = regexp.Compile(cCtx.String(flagKeepPattern))
+						if err != nil {
+							return fmt.Errorf("invalid keep pattern: %w", err)
+						}
+					}
+
 					return DuplicateCommand(
 						output,
 						cCtx.Args().Get(0),
-						cCtx.Int(flagSearchMinLength),
+						DuplicateOptions{
+							SearchMinLength:  cCtx.Int(flagSearchMinLength),
+							LimitPerGroup:    cCtx.Int(flagLimitPerGroup),
+							Mode:             cCtx.String(flagMode),
+							IgnoreCase:       cCtx.Bool(flagIgnoreCase),
+							ReportFormat:     cCtx.String(flagReportFormat),
+							Preview:          cCtx.Int(flagPreview),
+							Trash:            cCtx.Bool(flagTrash),
+							SummaryOnly:      cCtx.Bool(flagSummaryOnly),
+							Extensions:       cCtx.StringSlice(flagExt),
+							DeleteEmptyDirs:  cCtx.Bool(flagDeleteEmptyDirs),
+							HashAlgo:         cCtx.String(flagAlgo),
+							PreferOlderThan:  cCtx.Duration(flagPreferOlderThan),
+							ConfirmEach:      cCtx.Bool(flagConfirmEach),
+							SizeTolerance:    sizeTolerance,
+							SizeTolerancePct: sizeTolerancePercent,
+							ShowTime:         cCtx.String(flagShowTime),
+							MoveTo:           cCtx.String(flagMoveTo),
+							ByType:           cCtx.Bool(flagByType),
+							Plan:             cCtx.String(flagPlan),
+							Auto:             cCtx.Bool(flagAuto),
+							KeepPattern:      keepPattern,
+							MinGroupSize:     cCtx.Int(flagMinGroupSize),
+							HashMissing:      cCtx.Bool(flagHashMissing),
+							IncludeEmpty:     !cCtx.Bool(flagSkipEmpty),
+						},
 					)
 				},
 			},
 			{
-				Name:    stats,
-				Aliases: []string{s},
+				Name:  report,
+				Usage: "Report will summarize the catalog without accessing the file system",
 				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  flagTree,
+						Usage: "Summarize the total size of catalogued files per directory, like du",
+					},
 					&cli.IntFlag{
-						Name:  flagSearchMinLength,
-						Value: defaultMinLength,
-						Usage: "Find only exact-search terms (fast) or search by contains (slow)",
+						Name:  flagDepth,
+						Usage: "Only report directories up to this depth (0 means no limit)",
 					},
 				},
 				Action: func(cCtx *cli.Context) error {
-					return StatsCommand(
+					return ReportCommand(
 						output,
 						cCtx.Args().Get(0),
-						cCtx.Int(flagSearchMinLength),
+						ReportOptions{
+							Tree:  cCtx.Bool(flagTree),
+							Depth: cCtx.Int(flagDepth),
+						},
 					)
 				},
 			},
-		},
-	}
-}
-
-func ScanCommand(output Output, dbFile string, roots []string) error {
-	db := NewDB(output, dbFile)
-
-	db.Load()
-
-	err := db.Scan(roots...)
-	if err != nil {
-		output.Printf("Error scanning directories: %v\n", err)
-		output.Exit(1)
-	}
-
-	err = db.Write()
-	if err != nil {
-		output.Printf("Error writing DB: %v\n", err)
-		output.Exit(1)
-	}
-
-	return nil
-}
-
-func TermSearchCommand(output Output, dbFile, modeFlag string, searchTerms []string) error {
-	db := NewDB(output, dbFile)
-
-	db.Load()
-
-	db.Search(modeFlag, searchTerms)
-
-	return nil
-}
-
-func FileSearchCommand(output Output, dbFile, modeFlag, filePath string) error {
-	db := NewDB(output, dbFile)
-
-	db.Load()
-
-	searchTerms := pathToSearchTerms(filePath)
-
-	db.Search(modeFlag, searchTerms)
-
-	return nil
-}
-
-func DuplicateCommand(output Output, dbFile string, searchMinLength int) error {
-	db := NewDB(output, dbFile)
-
-	db.Load()
-
-	db.Duplicates(searchMinLength)
-
-	err := db.Write()
-	if err != nil {
-		output.Printf("Error writing DB: %v\n", err)
-		output.Exit(1)
-	}
-
-	return nil
-}
-
-func StatsCommand(output Output, dbFile string, searchMinLength int) error {
-	db := NewDB(output, dbFile)
-
-	db.Load()
-
-	db.Stats(searchMinLength)
-
-	return nil
-}
-
-type Output interface {
-	Println(a ...any)
-	Printf(format string, a ...any)
-	Scanln(a *string) error
-	Exit(code int)
-}
-
-type StdOut struct{}
-
+			{
+				Name:  partialDuplicates,
+				Usage: "Experimental: find files which are a prefix of a larger file, e.g. interrupted downloads",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  flagExperimental,
+						Usage: "Confirm running an experimental command",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return PartialDuplicatesCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Bool(flagExperimental),
+					)
+				},
+			},
+			{
+				Name:  serve,
+				Usage: "Serve will load the catalog once and answer search queries over HTTP, e.g. GET /search?q=foo&mode=slow",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  flagAddr,
+						Value: defaultAddr,
+						Usage: "Address to listen on",
+					},
+					&cli.IntFlag{
+						Name:  flagMaxResults,
+						Value: defaultMaxResults,
+						Usage: "Reject searches if the terms together match more files than this (0 means no limit)",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return ServeCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.String(flagAddr),
+						cCtx.Int(flagMaxResults),
+					)
+				},
+			},
+			{
+				Name:  repl,
+				Usage: "Repl will load the catalog once and answer the search queries read from stdin, e.g. for exploring large catalogs",
+				Action: func(cCtx *cli.Context) error {
+					return ReplCommand(
+						output,
+						cCtx.Args().Get(0),
+					)
+				},
+			},
+			{
+				Name:  watch,
+				Usage: "Watch will keep scanning the directories periodically, keeping the DB file up to date",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  flagPoll,
+						Usage: "Detect changes by scanning the directories periodically, which works on network mounts as well",
+					},
+					&cli.DurationFlag{
+						Name:  flagInterval,
+						Value: defaultPollInterval,
+						Usage: "Time between two scans when polling",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return WatchCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Slice()[1:],
+						WatchOptions{
+							Poll:     cCtx.Bool(flagPoll),
+							Interval: cCtx.Duration(flagInterval),
+						},
+					)
+				},
+			},
+			{
+				Name:  rehash,
+				Usage: "Rehash will calculate the hashes missing for an algorithm, to migrate the catalog to a new algorithm",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  flagAlgo,
+						Value: hashAlgoMD5,
+						Usage: "Hash algorithm to backfill: md5 or sha256",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return RehashCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.String(flagAlgo),
+					)
+				},
+			},
+			{
+				Name:  convert,
+				Usage: "Convert will write the catalog in another format, selected by the extension of the target (.csv or .fcdb)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  flagDelimiter,
+						Usage: "Field separator of the CSV target, a single character or tab (kept by later writes)",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return ConvertCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+						cCtx.String(flagDelimiter),
+					)
+				},
+			},
+			{
+				Name:  terms,
+				Usage: "Terms will print the search terms a file name is indexed by",
+				Action: func(cCtx *cli.Context) error {
+					return TermsCommand(
+						output,
+						cCtx.Args().Get(0),
+					)
+				},
+			},
+			{
+				Name:  applyPlan,
+				Usage: "Apply-plan will delete the files of a plan written by duplicates --plan, skipping the ones changed since",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  flagTrash,
+						Usage: "Move deleted files to the trash instead of removing them permanently",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return ApplyPlanCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+						cCtx.Bool(flagTrash),
+					)
+				},
+			},
+			{
+				Name:  importManifest,
+				Usage: "Import-manifest will catalog the files of an md5sum manifest using its checksums, without hashing the files",
+				Action: func(cCtx *cli.Context) error {
+					return ImportManifestCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+					)
+				},
+			},
+			{
+				Name:  dedupRecords,
+				Usage: "Dedup-records will remove rows of the DB file repeating the same path, keeping the newest one",
+				Action: func(cCtx *cli.Context) error {
+					return DedupRecordsCommand(
+						output,
+						cCtx.Args().Get(0),
+					)
+				},
+			},
+			{
+				Name:  reindex,
+				Usage: "Reindex will rebuild the indexes of the catalog and write it again, to repair it after manual edits",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  flagDryRun,
+						Usage: "Only rebuild the indexes, without writing the DB",
+					},
+					&cli.BoolFlag{
+						Name:  flagUpdateHashes,
+						Usage: "Re-hash the files which were hashed with an outdated hash mode",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return ReindexCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Bool(flagDryRun),
+						cCtx.Bool(flagUpdateHashes),
+					)
+				},
+			},
+			{
+				Name:  orphans,
+				Usage: "Orphans lists catalogued files outside of the given roots (or the roots scanned before)",
+				Action: func(cCtx *cli.Context) error {
+					return OrphansCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Slice()[1:],
+					)
+				},
+			},
+			{
+				Name:  empty,
+				Usage: "Empty lists the catalogued zero-byte files",
+				Action: func(cCtx *cli.Context) error {
+					return EmptyCommand(
+						output,
+						cCtx.Args().Get(0),
+					)
+				},
+			},
+			{
+				Name:  uniqueTo,
+				Usage: "Unique-to lists catalogued files under a root which have no copy (by hash and size) outside of it",
+				Action: func(cCtx *cli.Context) error {
+					return UniqueToCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+					)
+				},
+			},
+			{
+				Name:  overlap,
+				Usage: "Overlap reports which files of another catalog (by hash and size) are present in this one, listing the missing ones",
+				Action: func(cCtx *cli.Context) error {
+					return OverlapCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+					)
+				},
+			},
+			{
+				Name:  reconcile,
+				Usage: "Reconcile lists the files to copy to and delete from a target catalog to make it match a source catalog by content, without touching any files",
+				Action: func(cCtx *cli.Context) error {
+					return ReconcileCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+					)
+				},
+			},
+			{
+				Name:  under,
+				Usage: "Under lists the catalogued files under a directory, even if the drive is offline",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  flagShowTime,
+						Usage: "Show the modification time of each file: relative (e.g. 3 months ago) or absolute",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return UnderCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+						cCtx.String(flagShowTime),
+					)
+				},
+			},
+			{
+				Name:  byHash,
+				Usage: "Byhash lists the catalogued files whose hash starts with the given prefix, like short git hashes",
+				Action: func(cCtx *cli.Context) error {
+					return ByHashCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Args().Get(1),
+					)
+				},
+			},
+			{
+				Name:  roots,
+				Usage: "Roots lists the roots covered by the catalog with their file counts and total sizes",
+				Action: func(cCtx *cli.Context) error {
+					return RootsCommand(
+						output,
+						cCtx.Args().Get(0),
+					)
+				},
+			},
+			{
+				Name:  collisions,
+				Usage: "Collisions lists catalogued paths which only differ in case and can't coexist on case-insensitive file systems",
+				Action: func(cCtx *cli.Context) error {
+					return CollisionsCommand(
+						output,
+						cCtx.Args().Get(0),
+					)
+				},
+			},
+			{
+				Name:  snapshot,
+				Usage: "Snapshot will append a summary of the catalog to its history file, for tracking its growth",
+				Action: func(cCtx *cli.Context) error {
+					return SnapshotCommand(
+						output,
+						cCtx.Args().Get(0),
+					)
+				},
+			},
+			{
+				Name:  trend,
+				Usage: "Trend will print the snapshots of the catalog recorded before",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  flagFormat,
+						Value: formatTable,
+						Usage: "Output format of the history: table or sparkline",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return TrendCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.String(flagFormat),
+					)
+				},
+			},
+			{
+				Name:    stats,
+				Aliases: []string{s},
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  flagSearchMinLength,
+						Value: defaultMinLength,
+						Usage: "Find only exact-search terms (fast) or search by contains (slow)",
+					},
+					&cli.IntFlag{
+						Name:  flagTopTerms,
+						Usage: "List the given number of search terms shared by the most files",
+					},
+					&cli.StringFlag{
+						Name:  flagMetricsCSV,
+						Usage: "Append the totals as a row to this CSV file, building a time series for charting",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return StatsCommand(
+						output,
+						cCtx.Args().Get(0),
+						cCtx.Int(flagSearchMinLength),
+						cCtx.Int(flagTopTerms),
+						cCtx.String(flagMetricsCSV),
+					)
+				},
+			},
+		},
+	}
+}
+
+type ScanOptions struct {
+	// SinceScan makes the scan re-hash known files which were modified since the last scan of their root
+	SinceScan bool
+	// Verbose makes the scan list the paths which could not be read instead of only counting them
+	Verbose bool
+	// MaxReadRate limits the bytes read per second for hashing (0 means no limit)
+	MaxReadRate int64
+	// Progress makes the scan report its progress based on the bytes processed
+	Progress bool
+	// NoHash makes the scan store new files without hashing them, leaving only a stat per file
+	NoHash bool
+	// HashMissing makes the scan hash known files which were stored without a hash
+	HashMissing bool
+	// IncludeHidden makes the scan catalog hidden files and directories (starting with a dot) as well
+	IncludeHidden bool
+	// Parallel makes the scan process all roots concurrently, which overlaps IO when roots are on different devices
+	Parallel bool
+	// SamplePosition selects which part of large files is hashed, see the samplePosition constants
+	SamplePosition string
+	// InspectArchives makes the scan catalog the entries of new or changed archives as virtual paths
+	InspectArchives bool
+	// MinTermLength drops shorter search terms from the index and is stored in the meta file (0 keeps the stored value)
+	MinTermLength int
+	// MaxTermLength splits longer search terms into chunks and is stored in the meta file (0 keeps the stored value)
+	MaxTermLength int
+	// CRC32 makes the scan store a CRC32 checksum of the hashed sample next to the md5 hash
+	CRC32 bool
+	// HashAlgo is the hash algorithm used for new files, see the hashAlgo constants
+	HashAlgo string
+	// ExcludeRoots are the subtrees skipped during the walk
+	ExcludeRoots []string
+	// Resume re-hashes known files unless their size and modification time match the stored ones, for continuing an
+	// interrupted scan
+	Resume bool
+	// StorePerms stores the permission bits and the owner of new or changed files
+	StorePerms bool
+	// FlushEvery writes the DB file after every this many new or updated files during the scan (0 means only at the end)
+	FlushEvery int
+	// TreeHash hashes new files in full, hashing fixed-size chunks in parallel and combining their hashes
+	TreeHash bool
+}
+
+func ScanCommand(output Output, dbFile string, roots []string, options ScanOptions) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	switch options.SamplePosition {
+	case "", samplePositionHead, samplePositionTail, samplePositionBoth:
+	default:
+		output.Printf("Unknown sample position: %s\n", options.SamplePosition)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if options.TreeHash && options.SamplePosition != "" && options.SamplePosition != samplePositionHead {
+		output.Printf("The tree hash covers the whole file, it can't be combined with --%s\n", flagSamplePosition)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if !isHashAlgo(options.HashAlgo) {
+		output.Printf("Unknown hash algorithm: %s\n", options.HashAlgo)
+		output.Exit(1)
+
+		return nil
+	}
+
+	roots, err := expandRoots(roots)
+	if err != nil {
+		output.Errorf(errCodeScan, "Error expanding roots: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	err = scanDB(output, dbFile, roots, options)
+	if err != nil {
+		reportCommandError(output, err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+// scanDB loads the DB, scans the roots and writes the DB, even if scanning some of the roots failed. The caller has to
+// hold the lock of the DB. Errors are returned instead of exiting, so that watching can go on after a failed scan.
+func scanDB(output Output, dbFile string, roots []string, options ScanOptions) error {
+	db := NewDB(output, dbFile)
+
+	db.SetMaxReadRate(options.MaxReadRate)
+
+	err := db.load()
+	if err != nil {
+		return &commandError{code: errCodeReadDB, message: "Error reading DB", err: err}
+	}
+
+	if options.MinTermLength > 0 {
+		db.SetMinTermLength(options.MinTermLength)
+	}
+
+	if options.MaxTermLength > 0 {
+		db.SetMaxTermLength(options.MaxTermLength)
+	}
+
+	scanErr := db.Scan(options, roots...)
+
+	err = db.Write()
+	if err != nil {
+		return &commandError{code: errCodeWriteDB, message: "Error writing DB", err: errors.Join(scanErr, err)}
+	}
+
+	if scanErr != nil {
+		return &commandError{code: errCodeScan, message: "Error scanning directories", err: scanErr}
+	}
+
+	return nil
+}
+
+// commandError is an error of a step of a command, reported with the code of the step, see Output.Errorf
+type commandError struct {
+	code    string
+	message string
+	err     error
+}
+
+func (e *commandError) Error() string {
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// reportCommandError reports an error with the code of the failed step, other errors are reported as scan errors
+func reportCommandError(output Output, err error) {
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		output.Errorf(cmdErr.code, "%v\n", err)
+
+		return
+	}
+
+	output.Errorf(errCodeScan, "Error scanning directories: %v\n", err)
+}
+
+// expandRoots expands the roots containing wildcards (e.g. /mnt/drive*/Photos), for shells and config files which
+// don't expand them. Roots without wildcards and existing paths containing them literally (e.g. /data/Photos [2024])
+// are kept as they are, patterns matching nothing are an error.
+func expandRoots(roots []string) ([]string, error) {
+	expanded := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if !strings.ContainsAny(root, "*?[") {
+			expanded = append(expanded, root)
+
+			continue
+		}
+
+		if _, err := os.Stat(root); err == nil {
+			expanded = append(expanded, root)
+
+			continue
+		}
+
+		matches, err := filepath.Glob(root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root pattern '%s', err: %w", root, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("root pattern '%s' matches nothing", root)
+		}
+
+		expanded = append(expanded, matches...)
+	}
+
+	return expanded, nil
+}
+
+type SearchOptions struct {
+	// Mode is either fast (exact search terms) or slow (search terms containing the needles)
+	Mode string
+	// Format is the output format of the results, see the format constants
+	Format string
+	// ShowTime shows the modification time of the files, see the showTime constants, empty for not showing it
+	ShowTime string
+	// ShowMatches shows the stored search terms which matched the searched terms for each result
+	ShowMatches bool
+	// ShowPerms shows the stored permission bits and owner of each result
+	ShowPerms bool
+	// Dedupe prints each path only once, even if it was found multiple times
+	Dedupe bool
+	// MaxCandidates stops a slow search if a single term matches more files than this, 0 means no limit
+	MaxCandidates int
+	// MaxResults stops a search if the IDs collected for all terms and filters exceed this, 0 means no limit
+	MaxResults int
+	// Limit caps the number of results printed, 0 for the default of 100
+	Limit int
+}
+
+func TermSearchCommand(output Output, dbFile string, options SearchOptions, searchTerms []string) error {
+	if options.Mode == "" {
+		options.Mode = slow
+	}
+
+	if options.Mode != fast && options.Mode != slow {
+		output.Printf("Unknown search mode: %s\n", options.Mode)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if !isShowTime(options.ShowTime) {
+		output.Printf("Unknown time format: %s\n", options.ShowTime)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	query, err := ParseQuery(searchTerms)
+	if err != nil {
+		output.Errorf(errCodeSearch, "Error parsing query: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db.Search(options, query)
+
+	return nil
+}
+
+func FileSearchCommand(output Output, dbFile string, options SearchOptions, filePath string) error {
+	if options.Mode == "" {
+		options.Mode = slow
+	}
+
+	if options.Mode != fast && options.Mode != slow {
+		output.Printf("Unknown search mode: %s\n", options.Mode)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if !isShowTime(options.ShowTime) {
+		output.Printf("Unknown time format: %s\n", options.ShowTime)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	searchTerms := db.searchTerms(filePath)
+
+	db.Search(options, Query{Terms: searchTerms})
+
+	return nil
+}
+
+func TagCommand(output Output, dbFile, filePath string, tags []string) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	err := db.Tag(ID(filePath), tags...)
+	if err != nil {
+		output.Errorf(errCodeUpdateDB, "Error tagging file: %v\n", err)
+		output.Exit(1)
+	}
+
+	err = db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+func CanonicalCommand(output Output, dbFile, filePath string, mark bool) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	err := db.SetCanonical(ID(filePath), mark)
+	if err != nil {
+		output.Errorf(errCodeUpdateDB, "Error marking file: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	err = db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+type VerifyOptions struct {
+	// Checkpoint is a file listing the paths already verified, these will be skipped
+	Checkpoint string
+	// MaxReadRate limits the bytes read per second for hashing (0 means no limit)
+	MaxReadRate int64
+	// SamplePercent limits the verification to a random sample of the files (0 means all files)
+	SamplePercent float64
+	// Seed is the seed of the random sample, the same seed selects the same sample of the same catalog
+	Seed int64
+}
+
+func VerifyCommand(output Output, dbFile string, options VerifyOptions) error {
+	if options.SamplePercent < 0 || options.SamplePercent > 100 {
+		output.Printf("Invalid sample percent: %v\n", options.SamplePercent)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.SetMaxReadRate(options.MaxReadRate)
+
+	db.Load()
+
+	err := db.Verify(options)
+	if err != nil {
+		output.Errorf(errCodeVerify, "Error verifying files: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+type ReportOptions struct {
+	// Tree enables the du-like report of directory sizes
+	Tree bool
+	// Depth limits the depth of directories reported in the tree report
+	Depth int
+}
+
+func ReportCommand(output Output, dbFile string, options ReportOptions) error {
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	if !options.Tree {
+		output.Printf("No report selected, use --%s\n", flagTree)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db.TreeReport(options.Depth)
+
+	return nil
+}
+
+func PartialDuplicatesCommand(output Output, dbFile string, experimental bool) error {
+	if !experimental {
+		output.Printf("%s is experimental, use --%s to run it anyway\n", partialDuplicates, flagExperimental)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.PartialDuplicates()
+
+	return nil
+}
+
+type WatchOptions struct {
+	// Poll detects changes by scanning the roots periodically, the only supported way of watching for now
+	Poll bool
+	// Interval is the time between two scans when polling
+	Interval time.Duration
+}
+
+func WatchCommand(output Output, dbFile string, roots []string, options WatchOptions) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	if !options.Poll {
+		output.Printf("Only watching by polling is supported, use --%s\n", flagPoll)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if options.Interval <= 0 {
+		output.Printf("Invalid interval: %s\n", options.Interval)
+		output.Exit(1)
+
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	pollScans(ctx, output, dbFile, roots, ticker.C)
+
+	return nil
+}
+
+// pollScans scans the roots right away and then at each tick, until the context is cancelled. Each scan is incremental:
+// new and deleted files are picked up, and known files modified since the previous scan are re-hashed. Failed polls are
+// reported, but polling goes on.
+func pollScans(ctx context.Context, output Output, dbFile string, roots []string, ticks <-chan time.Time) {
+	for cycle := 1; ; cycle++ {
+		output.Printf("Poll %d at %s\n", cycle, time.Now().Format(time.TimeOnly))
+
+		err := pollScan(output, dbFile, roots)
+		if err != nil {
+			reportCommandError(output, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+	}
+}
+
+// pollScan scans the roots available in this cycle. Missing roots (e.g. unmounted drives) are skipped, so are all of
+// them while the DB is in use by another process.
+func pollScan(output Output, dbFile string, roots []string) error {
+	var available []string
+	for _, root := range roots {
+		expanded, err := expandRoots([]string{root})
+		if err != nil {
+			output.Printf("Skipping root %s: %v\n", root, err)
+
+			continue
+		}
+
+		for _, path := range expanded {
+			if _, err := os.Stat(path); err != nil {
+				output.Printf("Skipping missing root: %s\n", path)
+
+				continue
+			}
+
+			available = append(available, path)
+		}
+	}
+
+	if len(available) == 0 {
+		output.Println("No roots available, skipping this poll")
+
+		return nil
+	}
+
+	unlock, err := lockFile(dbFile + lockFileSuffix)
+	if errors.Is(err, errDBLocked) {
+		output.Printf("The DB %s is in use by another process, skipping this poll\n", dbFile)
+
+		return nil
+	}
+
+	if err != nil {
+		return &commandError{code: errCodeLockDB, message: "Error locking DB", err: err}
+	}
+	defer unlock()
+
+	return scanDB(output, dbFile, available, ScanOptions{SinceScan: true})
+}
+
+func ServeCommand(output Output, dbFile, addr string, maxResults int) error {
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           db.Handler(maxResults),
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	output.Printf("Serving %s on http://%s\n", dbFile, addr)
+
+	select {
+	case err := <-errs:
+		output.Errorf(errCodeServe, "Error serving: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	case <-ctx.Done():
+	}
+
+	// Requests in progress are given some time to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		output.Errorf(errCodeServe, "Error shutting down: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+func ReplCommand(output Output, dbFile string) error {
+	if dbFile == stdinDBFile {
+		output.Println("The DB can't be read from stdin, as the queries are read from it")
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.Repl(SearchOptions{Mode: slow, MaxResults: defaultMaxResults})
+
+	return nil
+}
+
+func RehashCommand(output Output, dbFile, algo string) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	if !isHashAlgo(algo) {
+		output.Printf("Unknown hash algorithm: %s\n", algo)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.Rehash(algo)
+
+	err := db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+func ConvertCommand(output Output, dbFile, targetFile, delimiter string) error {
+	if targetFile == "" {
+		output.Println("No target file given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	comma, err := parseDelimiter(delimiter)
+	if err != nil {
+		output.Printf("Invalid delimiter: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	// Without a delimiter given, the one of the source is kept
+	if delimiter != "" {
+		db.delimiter = comma
+	}
+
+	// The meta file is written next to the target as well
+	db.dbFile = targetFile
+
+	err = db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	output.Printf("Converted %d files to %s\n", len(db.Files), targetFile)
+
+	return nil
+}
+
+func ApplyPlanCommand(output Output, dbFile, planFile string, trash bool) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	if planFile == "" {
+		output.Println("No plan file given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	entries, err := readPlan(planFile)
+	if err != nil {
+		output.Errorf(errCodeReadFile, "Error reading plan: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.ApplyPlan(entries, trash)
+
+	err = db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+func ImportManifestCommand(output Output, dbFile, manifestFile string) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	if manifestFile == "" {
+		output.Println("No manifest file given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	content, err := os.ReadFile(manifestFile)
+	if err != nil {
+		output.Errorf(errCodeReadFile, "Error reading manifest: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.ImportManifest(string(content), filepath.Dir(manifestFile))
+
+	err = db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+func DedupRecordsCommand(output Output, dbFile string) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	if isBinaryDB(dbFile) {
+		output.Println("Only CSV DB files can contain duplicate rows")
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	err := db.DedupRecords()
+	if err != nil {
+		output.Errorf(errCodeReadDB, "Error reading DB: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	err = db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+func ReindexCommand(output Output, dbFile string, dryRun, updateHashes bool) error {
+	if !dryRun && rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	if !dryRun {
+		unlock, ok := lockDB(output, dbFile)
+		if !ok {
+			return nil
+		}
+		defer unlock()
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	if updateHashes {
+		db.UpdateOutdatedHashes()
+	}
+
+	db.Reindex()
+
+	if dryRun {
+		return nil
+	}
+
+	err := db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+func OverlapCommand(output Output, dbFile, otherFile string) error {
+	if otherFile == "" {
+		output.Println("No other DB file given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	other := NewDB(output, otherFile)
+
+	other.Load()
+
+	db.Overlap(other)
+
+	return nil
+}
+
+func ReconcileCommand(output Output, sourceFile, targetFile string) error {
+	if targetFile == "" {
+		output.Println("No target DB file given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	source := NewDB(output, sourceFile)
+
+	source.Load()
+
+	target := NewDB(output, targetFile)
+
+	target.Load()
+
+	source.Reconcile(target)
+
+	return nil
+}
+
+func UniqueToCommand(output Output, dbFile, root string) error {
+	if root == "" {
+		output.Println("No root given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.UniqueTo(root)
+
+	return nil
+}
+
+func UnderCommand(output Output, dbFile, dir, showTime string) error {
+	if dir == "" {
+		output.Println("No directory given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	if !isShowTime(showTime) {
+		output.Printf("Unknown time format: %s\n", showTime)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.Under(dir, showTime)
+
+	return nil
+}
+
+func ByHashCommand(output Output, dbFile, prefix string) error {
+	if len(prefix) < minHashPrefixLength {
+		output.Printf("Hash prefix is too short, give at least %d characters\n", minHashPrefixLength)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.ByHash(prefix)
+
+	return nil
+}
+
+func TermsCommand(output Output, fileName string) error {
+	if fileName == "" {
+		output.Println("No file name given")
+		output.Exit(1)
+
+		return nil
+	}
+
+	for _, term := range splitLongTerms(pathToSearchTerms(fileName), defaultMaxTermLength) {
+		output.Println(term)
+	}
+
+	return nil
+}
+
+func RootsCommand(output Output, dbFile string) error {
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.Roots()
+
+	return nil
+}
+
+func CollisionsCommand(output Output, dbFile string) error {
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.Collisions()
+
+	return nil
+}
+
+func OrphansCommand(output Output, dbFile string, roots []string) error {
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	if len(roots) == 0 {
+		for root := range db.LastScans {
+			roots = append(roots, root)
+		}
+	}
+
+	if len(roots) == 0 {
+		output.Println("No roots given and no roots were scanned before")
+		output.Exit(1)
+
+		return nil
+	}
+
+	db.Orphans(roots)
+
+	return nil
+}
+
+type DuplicateOptions struct {
+	// SearchMinLength is the minimum length of search terms considered when looking for duplicates by search term
+	SearchMinLength int
+	// LimitPerGroup caps the number of files displayed (and selectable for deletion) per duplicate group
+	LimitPerGroup int
+	// Mode selects how duplicates are grouped, see the duplicateMode constants
+	Mode string
+	// IgnoreCase makes the exact-name and stem modes compare file names case-insensitively
+	IgnoreCase bool
+	// ReportFormat is either text (interactive review), or csv or tsv (non-interactive report of all groups)
+	ReportFormat string
+	// Preview is the number of lines printed from each file before the delete prompt (0 means no preview)
+	Preview int
+	// Trash makes deleted files move to the trash of the user instead of being removed permanently
+	Trash bool
+	// SummaryOnly prints counts per duplicate type only, without ever prompting or deleting
+	SummaryOnly bool
+	// Extensions restricts the files considered to the ones with these extensions (all files if empty)
+	Extensions []string
+	// DeleteEmptyDirs removes the directories which became empty by deleting files, stopping at scan roots
+	DeleteEmptyDirs bool
+	// HashAlgo is the hash algorithm of the hashes compared, see the hashAlgo constants
+	HashAlgo string
+	// PreferOlderThan makes files modified before this long ago suggested for deletion, 0 disables suggestions
+	PreferOlderThan time.Duration
+	// ConfirmEach asks for a confirmation before deleting each selected file
+	ConfirmEach bool
+	// SizeTolerance is the size difference in bytes up to which files with matching hashes are grouped
+	SizeTolerance int64
+	// SizeTolerancePct is the size difference in percent of the smaller file up to which files are grouped
+	SizeTolerancePct float64
+	// ShowTime shows the modification time of the files, see the showTime constants, empty for not showing it
+	ShowTime string
+	// MoveTo is the directory the duplicates are moved into instead of being reviewed, empty for reviewing them
+	MoveTo string
+	// ByType prints the reclaimable bytes of the duplicates by size and hash per file extension, without prompting
+	ByType bool
+	// Plan is the file the selected deletions are written to instead of deleting the files, see apply-plan
+	Plan string
+	// Auto resolves the groups with matching hashes by the KeepPattern rule instead of prompting
+	Auto bool
+	// KeepPattern matches the path of the file kept of each group when resolving duplicates automatically
+	KeepPattern *regexp.Regexp
+	// MinGroupSize hides the groups with fewer files than this, groups always have at least two files
+	MinGroupSize int
+	// HashMissing hashes the files stored without a hash which have the same size as other files, e.g. after scanning
+	// with --no-hash, and stores the hashes
+	HashMissing bool
+	// IncludeEmpty groups the zero-byte files by size and hash as well. They all share the same hash, so by default
+	// they are only counted.
+	IncludeEmpty bool
+}
+
+func EmptyCommand(output Output, dbFile string) error {
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.Empty()
+
+	return nil
+}
+
+func DuplicateCommand(output Output, dbFile string, options DuplicateOptions) error {
+	// Reports don't change the catalog, so they can be made of a DB read from stdin, unless missing hashes are stored
+	readOnly := options.SummaryOnly || options.ByType || options.Plan != "" || options.ReportFormat == formatCSV || options.ReportFormat == formatTSV
+	readOnly = readOnly && !options.HashMissing
+	if !readOnly && rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	if !readOnly {
+		unlock, ok := lockDB(output, dbFile)
+		if !ok {
+			return nil
+		}
+		defer unlock()
+	}
+
+	switch options.Mode {
+	case "", duplicateModeDefault, duplicateModeExactName, duplicateModeStem, duplicateModeStat:
+	default:
+		output.Printf("Unknown duplicate mode: %s\n", options.Mode)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if !isHashAlgo(options.HashAlgo) {
+		output.Printf("Unknown hash algorithm: %s\n", options.HashAlgo)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if !isShowTime(options.ShowTime) {
+		output.Printf("Unknown time format: %s\n", options.ShowTime)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if options.MoveTo != "" && options.Mode != "" && options.Mode != duplicateModeDefault {
+		output.Printf("Moving duplicates is only supported in the %s mode\n", duplicateModeDefault)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if options.Auto && options.KeepPattern == nil {
+		output.Println("Resolving duplicates automatically requires a rule, use --keep-pattern")
+		output.Exit(1)
+
+		return nil
+	}
+
+	if options.Auto && options.Mode != "" && options.Mode != duplicateModeDefault {
+		output.Printf("Resolving duplicates automatically is only supported in the %s mode\n", duplicateModeDefault)
+		output.Exit(1)
+
+		return nil
+	}
+
+	// Files grouped by the size tolerance aren't identical, so they are only offered for review, never resolved in bulk
+	sizeTolerant := options.SizeTolerance > 0 || options.SizeTolerancePct > 0
+	if sizeTolerant && (options.Auto || options.Plan != "" || options.MoveTo != "") {
+		output.Println("The size tolerance can't be used with --auto, --plan or --move-duplicates-to")
+		output.Exit(1)
+
+		return nil
+	}
+
+	if options.ByType && options.Mode != "" && options.Mode != duplicateModeDefault {
+		output.Printf("The breakdown by file type is only supported in the %s mode\n", duplicateModeDefault)
+		output.Exit(1)
+
+		return nil
+	}
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	changed := db.Duplicates(options)
+
+	// Writing the unchanged catalog would only churn the file, and without holding the lock it could overwrite the
+	// changes of another process
+	if readOnly || !changed {
+		return nil
+	}
+
+	err := db.Write()
+	if err != nil {
+		output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+// errDBLocked is returned when another process holds the lock of the DB file
+var errDBLocked = errors.New("the DB is locked by another process")
+
+// lockDB takes the lock of the DB file for the load-modify-write cycle of a command, so that concurrent invocations
+// can't overwrite each other's changes. A second invocation fails fast instead of waiting. The returned function
+// releases the lock.
+func lockDB(output Output, dbFile string) (func(), bool) {
+	unlock, err := lockFile(dbFile + lockFileSuffix)
+	if errors.Is(err, errDBLocked) {
+		output.Printf("The DB %s is in use by another process, try again later\n", dbFile)
+		output.Exit(1)
+
+		return nil, false
+	}
+
+	if err != nil {
+		output.Errorf(errCodeLockDB, "Error locking DB: %v\n", err)
+		output.Exit(1)
+
+		return nil, false
+	}
+
+	return unlock, true
+}
+
+// rejectStdinDB reports an error if the DB is read from stdin, as commands changing the catalog can't write it back.
+func rejectStdinDB(output Output, dbFile string) bool {
+	if dbFile != stdinDBFile {
+		return false
+	}
+
+	output.Println("The DB read from stdin can't be modified")
+	output.Exit(1)
+
+	return true
+}
+
+func SnapshotCommand(output Output, dbFile string) error {
+	if rejectStdinDB(output, dbFile) {
+		return nil
+	}
+
+	unlock, ok := lockDB(output, dbFile)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	current := db.Snapshot(time.Now())
+
+	err := appendSnapshot(dbFile+historyFileSuffix, current)
+	if err != nil {
+		output.Errorf(errCodeWriteFile, "Error writing history: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	output.Printf(
+		"Snapshot recorded: %s files, %s, %s unique hashes, %s duplicate waste\n",
+		formatCount(current.Records),
+		formatBytes(current.Bytes),
+		formatCount(current.UniqueHashes),
+		formatBytes(current.Waste),
+	)
+
+	return nil
+}
+
+func TrendCommand(output Output, dbFile, format string) error {
+	switch format {
+	case "", formatTable, formatSparkline:
+	default:
+		output.Printf("Unknown format: %s\n", format)
+		output.Exit(1)
+
+		return nil
+	}
+
+	snapshots, err := readSnapshots(dbFile + historyFileSuffix)
+	if err != nil {
+		output.Errorf(errCodeReadFile, "Error reading history: %v\n", err)
+		output.Exit(1)
+
+		return nil
+	}
+
+	if len(snapshots) == 0 {
+		output.Println("No snapshots recorded yet")
+
+		return nil
+	}
+
+	if format == formatSparkline {
+		printSparklines(output, snapshots)
+
+		return nil
+	}
+
+	output.Printf("%-20s %12s %12s %12s %12s\n", "time", "files", "size", "hashes", "waste")
+	for _, snap := range snapshots {
+		output.Printf(
+			"%-20s %12s %12s %12s %12s\n",
+			snap.Time.Format(time.DateTime),
+			formatCount(snap.Records),
+			formatBytes(snap.Bytes),
+			formatCount(snap.UniqueHashes),
+			formatBytes(snap.Waste),
+		)
+	}
+
+	return nil
+}
+
+func StatsCommand(output Output, dbFile string, searchMinLength, topTerms int, metricsFile string) error {
+	db := NewDB(output, dbFile)
+
+	db.Load()
+
+	db.Stats(searchMinLength, topTerms)
+
+	if metricsFile == "" {
+		return nil
+	}
+
+	err := db.recordArtifact(metricsFile)
+	if err == nil {
+		err = appendMetrics(metricsFile, db.Snapshot(time.Now()))
+	}
+
+	if err != nil {
+		output.Errorf(errCodeWriteFile, "Error writing metrics: %v\n", err)
+		output.Exit(1)
+	}
+
+	return nil
+}
+
+type Output interface {
+	Println(a ...any)
+	Printf(format string, a ...any)
+	// Errorf reports an error, the code identifies the kind of the error for machine readers
+	Errorf(code, format string, a ...any)
+	// Input returns the reader of the standard input, e.g. for reading a piped DB
+	Input() io.Reader
+	Scanln(a *string) error
+	Exit(code int)
+}
+
+type StdOut struct {
+	input *bufio.Reader
+}
+
 func (out *StdOut) Println(a ...any) {
 	fmt.Println(a...)
 }
 
-func (out *StdOut) Printf(format string, a ...any) {
-	fmt.Printf(format, a...)
+func (out *StdOut) Printf(format string, a ...any) {
+	fmt.Printf(format, a...)
+}
+
+func (out *StdOut) Errorf(_, format string, a ...any) {
+	fmt.Printf(format, a...)
+}
+
+// Scanln reads a whole line of input, so that empty lines and spaces are accepted. At the end of the input (e.g. when
+// the input is piped or closed) io.EOF is returned, so that callers don't keep waiting for answers.
+func (out *StdOut) Scanln(a *string) error {
+	line, err := out.input.ReadString('\n')
+
+	*a = strings.TrimRight(line, "\r\n")
+
+	if errors.Is(err, io.EOF) && line != "" {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("error scanning input: %w", err)
+	}
+
+	return nil
+}
+
+func (out *StdOut) Input() io.Reader {
+	return out.input
+}
+
+func (out *StdOut) Exit(code int) {
+	os.Exit(code)
+}
+
+func NewStdOut() *StdOut {
+	return &StdOut{input: bufio.NewReader(os.Stdin)}
+}
+
+// JSONErrorOutput wraps an output, reporting errors as JSON objects with a code and a message on a separate writer
+// (stderr by default), so that automation can react to them.
+type JSONErrorOutput struct {
+	Output
+	writer io.Writer
+}
+
+func NewJSONErrorOutput(output Output, writer io.Writer) *JSONErrorOutput {
+	return &JSONErrorOutput{Output: output, writer: writer}
+}
+
+type jsonError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (out *JSONErrorOutput) Errorf(code, format string, a ...any) {
+	message := strings.TrimSpace(fmt.Sprintf(format, a...))
+
+	_ = json.NewEncoder(out.writer).Encode(jsonError{Code: code, Message: message})
+}
+
+type Record struct {
+	Path        string
+	Size        int
+	Hash        string
+	ModTime     time.Time
+	Tags        []string
+	SearchTerms []string
+	// SamplePosition is the part of the file which was hashed, empty for the default (head)
+	SamplePosition string
+	// CRC32 is the checksum of the hashed sample in hex, empty if it was not calculated
+	CRC32 string
+	// AlgoHashes are the hashes calculated with algorithms other than md5, keyed by algorithm
+	AlgoHashes map[string]string
+	// HashMode is the scheme the hashes were calculated with, empty for the current scheme (samples of one MB), tree
+	// for tree hashes of the whole file or full-md5 for the md5 hashes of the whole file. Hashes of any other mode (e.g.
+	// full or sample-512k of earlier versions) are outdated.
+	HashMode string
+	// Root is the scan root the file was found under, empty if it's unknown
+	Root string
+	// Mode is the permission bits of the file in octal, e.g. 0644, empty if they were not stored
+	Mode string
+	// Owner is the uid and gid of the file, e.g. 1000:1000, empty if it was not stored or the platform has none
+	Owner string
+	// Sparse marks files which occupy less space on disk than their size, e.g. VM images
+	Sparse bool
+	// DiskSize is the number of bytes allocated on disk for sparse files
+	DiskSize int
+	// Canonical marks the copy chosen to be kept among the files of the same hash
+	Canonical bool
+}
+
+// diskSize returns the bytes the file occupies on disk, which is its size unless it's sparse.
+func (r Record) diskSize() int {
+	if r.Sparse {
+		return r.DiskSize
+	}
+
+	return r.Size
+}
+
+// hash returns the hash of the record calculated with the algorithm, empty if it was not calculated.
+func (r Record) hash(algo string) string {
+	if algo == "" || algo == hashAlgoMD5 {
+		return r.Hash
+	}
+
+	return r.AlgoHashes[algo]
+}
+
+func (r *Record) setHash(algo, hash string) {
+	if algo == "" || algo == hashAlgoMD5 {
+		r.Hash = hash
+
+		return
+	}
+
+	// The map is cloned, as it may still be shared with the record stored in the DB
+	r.AlgoHashes = maps.Clone(r.AlgoHashes)
+	if r.AlgoHashes == nil {
+		r.AlgoHashes = make(map[string]string)
+	}
+
+	r.AlgoHashes[algo] = hash
+}
+
+// hashAlgos returns the algorithms of the hashes stored for the record, md5 first. Records without any hashes
+// return md5, so that they are compared as before.
+func (r Record) hashAlgos() []string {
+	var algos []string
+	if r.Hash != "" || len(r.AlgoHashes) == 0 {
+		algos = append(algos, hashAlgoMD5)
+	}
+
+	return append(algos, slices.Sorted(maps.Keys(r.AlgoHashes))...)
+}
+
+func isHashAlgo(algo string) bool {
+	switch algo {
+	case "", hashAlgoMD5, hashAlgoSHA256:
+		return true
+	}
+
+	return false
+}
+
+// hashData hashes the sample with the algorithm.
+func hashData(data []byte, algo string) string {
+	if algo == hashAlgoSHA256 {
+		sum := sha256.Sum256(data)
+
+		return hex.EncodeToString(sum[:])
+	}
+
+	return md5Hex(data)
+}
+
+func formatAlgoHashes(hashes map[string]string) string {
+	parts := make([]string, 0, len(hashes))
+	for _, algo := range slices.Sorted(maps.Keys(hashes)) {
+		parts = append(parts, algo+algoHashSeparator+hashes[algo])
+	}
+
+	return strings.Join(parts, tagSeparator)
+}
+
+func parseAlgoHashes(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	hashes := make(map[string]string)
+	for _, part := range strings.Split(raw, tagSeparator) {
+		algo, hash, found := strings.Cut(part, algoHashSeparator)
+		if !found || algo == "" || hash == "" {
+			return nil, fmt.Errorf("invalid algorithm hash: '%s'", part)
+		}
+
+		hashes[algo] = hash
+	}
+
+	return hashes, nil
+}
+
+type ID string
+
+type DB struct {
+	mutex      *sync.RWMutex
+	indexMutex *sync.Mutex
+	Files      map[ID]Record
+	Sizes      map[int][]ID
+	Hashes     map[string][]ID
+	// AlgoHashes indexes the hashes of algorithms other than md5, keyed by algorithm
+	AlgoHashes  map[string]map[string][]ID
+	SearchTerms map[string][]ID
+	Extensions  map[string][]ID
+	Tags        map[string][]ID
+	LastScans   map[string]time.Time
+	output      Output
+	dbFile      string
+	// sortedIDs are the IDs of all files sorted by path, for binary searching paths and directories
+	sortedIDs []ID
+	// loading is set while records are streamed from the DB file, deferring the sorting of IDs
+	loading bool
+	// unflushed is the number of files scanned since the DB file was last written during a scan
+	unflushed   int
+	hashedBytes int64
+	readLimiter *rateLimiter
+	// minTermLength is the length of the shortest search terms kept in the index
+	minTermLength int
+	// maxTermLength is the length above which search terms are split into chunks, 0 for the default
+	maxTermLength int
+	// delimiter is the field separator of the CSV DB file, detected on load and kept on write, 0 for comma
+	delimiter rune
+}
+
+func NewDB(output Output, dbFile string) *DB {
+	return &DB{
+		mutex:       &sync.RWMutex{},
+		indexMutex:  &sync.Mutex{},
+		Files:       make(map[ID]Record),
+		Sizes:       make(map[int][]ID),
+		Hashes:      make(map[string][]ID),
+		AlgoHashes:  make(map[string]map[string][]ID),
+		SearchTerms: make(map[string][]ID),
+		Extensions:  make(map[string][]ID),
+		Tags:        make(map[string][]ID),
+		LastScans:   make(map[string]time.Time),
+		output:      output,
+		dbFile:      dbFile,
+	}
+}
+
+// SetMaxReadRate limits the bytes read per second when hashing files, 0 means no limit.
+func (db *DB) SetMaxReadRate(bytesPerSecond int64) {
+	db.readLimiter = newRateLimiter(bytesPerSecond)
+}
+
+// Load reads the DB file and its meta file, exiting if they can't be read.
+func (db *DB) Load() {
+	err := db.load()
+	if err != nil {
+		db.output.Errorf(errCodeReadDB, "Error reading DB: %v\n", err)
+
+		db.output.Exit(1)
+	}
+}
+
+func (db *DB) load() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	// The meta file is loaded first, as its settings affect how records are indexed
+	err := db.loadMeta()
+	if err != nil {
+		return fmt.Errorf("unable to read DB meta file '%s', error: %w", db.dbFile+metaFileSuffix, err)
+	}
+
+	if isBinaryDB(db.dbFile) {
+		err = db.loadBinary()
+		if err != nil {
+			return fmt.Errorf("unable to read DB file '%s', error: %w", db.dbFile, err)
+		}
+
+		return nil
+	}
+
+	// Records are handled one by one as they are read, so that the raw rows are never held in memory all at once
+	sorted, lastPath := true, ""
+	db.loading = true
+
+	handle := func(record []string) {
+		if record[colPath] < lastPath {
+			sorted = false
+		}
+
+		lastPath = record[colPath]
+
+		db.handleRecord(record)
+	}
+
+	if db.dbFile == stdinDBFile {
+		db.delimiter, err = streamCsv(db.output.Input(), "stdin", handle)
+	} else {
+		db.delimiter, err = streamCsvFile(db.dbFile, handle)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read DB file '%s', error: %w", db.dbFile, err)
+	}
+
+	db.loading = false
+
+	// Written DB files are sorted by path, others need their IDs and indexes sorted to match
+	if !sorted {
+		slices.Sort(db.sortedIDs)
+		db.sortIndexes()
+	}
+
+	db.sortedIDs = slices.Compact(db.sortedIDs)
+
+	return nil
+}
+
+// sortIndexes sorts the IDs of each index by path, as if the records were added in sorted order
+func (db *DB) sortIndexes() {
+	for _, index := range []map[string][]ID{db.Hashes, db.SearchTerms, db.Extensions, db.Tags} {
+		for _, ids := range index {
+			slices.Sort(ids)
+		}
+	}
+
+	for _, index := range db.AlgoHashes {
+		for _, ids := range index {
+			slices.Sort(ids)
+		}
+	}
+
+	for _, ids := range db.Sizes {
+		slices.Sort(ids)
+	}
+}
+
+// DedupRecords loads the rows of the DB file, keeping only one row per path. Identical rows are simply dropped, while
+// of conflicting rows the one with the newest modification time is kept, or the last one if their times are equal.
+func (db *DB) DedupRecords() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	err := db.loadMeta()
+	if err != nil {
+		return err
+	}
+
+	// The records are cloned, as the streamed records are reused
+	var records [][]string
+
+	db.delimiter, err = streamCsvFile(db.dbFile, func(record []string) {
+		records = append(records, slices.Clone(record))
+	})
+	if err != nil {
+		return err
+	}
+
+	kept := make(map[string][]string)
+	identical, conflicting := 0, 0
+
+	for _, record := range records {
+		path := strings.TrimSpace(record[colPath])
+
+		previous, ok := kept[path]
+		if !ok {
+			kept[path] = record
+
+			continue
+		}
+
+		if slices.Equal(previous, record) {
+			identical++
+
+			continue
+		}
+
+		conflicting++
+
+		if recordModTime(record) >= recordModTime(previous) {
+			kept[path] = record
+		}
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(kept)) {
+		db.handleRecord(kept[path])
+	}
+
+	db.output.Printf("Removed %d identical and %d conflicting rows\n", identical, conflicting)
+
+	return nil
+}
+
+// recordModTime returns the modification time stored in a raw row as unix time, 0 if it's missing or invalid.
+func recordModTime(record []string) int64 {
+	if len(record) <= colModTime {
+		return 0
+	}
+
+	modTime, err := strconv.ParseInt(record[colModTime], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return modTime
+}
+
+func isBinaryDB(dbFile string) bool {
+	return strings.EqualFold(filepath.Ext(dbFile), binaryDBExtension)
+}
+
+// binaryDB is the content of a binary DB file. Calculating the search terms of the paths takes most of the time of
+// loading a CSV file, therefore the search terms of the records and their index are stored as well, together with the
+// settings they were calculated with. They are recalculated if the settings in the meta file changed since.
+type binaryDB struct {
+	Version       int
+	MinTermLength int
+	MaxTermLength int
+	Records       []binaryRecord
+	// SearchTerms is the search term index, referring to the records by their position
+	SearchTerms map[string][]int
+}
+
+type binaryRecord struct {
+	Path           string
+	Size           int
+	Hash           string
+	ModTime        int64
+	Tags           []string
+	SamplePosition string
+	CRC32          string
+	AlgoHashes     map[string]string
+	HashMode       string
+	Root           string
+	Mode           string
+	Owner          string
+	Sparse         bool
+	DiskSize       int
+	Canonical      bool
+	SearchTerms    []string
+}
+
+// loadBinary reads a binary DB file. An empty file is loaded as an empty catalog.
+func (db *DB) loadBinary() error {
+	file, err := os.Open(db.dbFile)
+	if err != nil {
+		return fmt.Errorf("unable to read input file '%s', err: %w", db.dbFile, err)
+	}
+	defer file.Close()
+
+	var content binaryDB
+
+	err = gob.NewDecoder(bufio.NewReader(file)).Decode(&content)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to decode binary DB file '%s', err: %w", db.dbFile, err)
+	}
+
+	if content.Version < 1 || content.Version > binaryDBVersion {
+		return fmt.Errorf("unsupported binary DB version: %d", content.Version)
+	}
+
+	storedTerms := content.Version >= 2 && content.MinTermLength == db.minTermLength && content.MaxTermLength == db.maxTermLength
+
+	// The stored search term index is loaded as a whole after the records
+	add := db.add
+	if storedTerms {
+		add = db.addRecord
+	}
+
+	for _, record := range content.Records {
+		var modTime time.Time
+		if record.ModTime != 0 {
+			modTime = time.Unix(record.ModTime, 0)
+		}
+
+		searchTerms := record.SearchTerms
+		if !storedTerms {
+			searchTerms = db.searchTerms(record.Path)
+		}
+
+		err = add(Record{
+			Path:           record.Path,
+			Size:           record.Size,
+			Hash:           record.Hash,
+			ModTime:        modTime,
+			Tags:           record.Tags,
+			SearchTerms:    searchTerms,
+			SamplePosition: record.SamplePosition,
+			CRC32:          record.CRC32,
+			AlgoHashes:     record.AlgoHashes,
+			HashMode:       record.HashMode,
+			Root:           cmp.Or(record.Root, db.rootOf(record.Path)),
+			Mode:           record.Mode,
+			Owner:          record.Owner,
+			Sparse:         record.Sparse,
+			DiskSize:       record.DiskSize,
+			Canonical:      record.Canonical,
+		})
+		if err != nil {
+			db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", record.Path, err)
+		}
+	}
+
+	if !storedTerms {
+		return nil
+	}
+
+	for term, positions := range content.SearchTerms {
+		ids := make([]ID, 0, len(positions))
+		for _, position := range positions {
+			if position < 0 || position >= len(content.Records) {
+				return fmt.Errorf("invalid record position in the index of search term '%s': %d", term, position)
+			}
+
+			ids = append(ids, ID(content.Records[position].Path))
+		}
+
+		db.SearchTerms[term] = ids
+	}
+
+	return nil
+}
+
+// loadMeta reads the last scan time of each root from the meta file stored next to the DB file.
+// A missing meta file is not an error, it simply means that no scan was recorded yet.
+func (db *DB) loadMeta() error {
+	metaFile := db.dbFile + metaFileSuffix
+
+	if _, err := os.Stat(metaFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	records, err := readCsvFile(metaFile)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if len(record) == 3 && record[0] == metaSetting {
+			err = db.handleSetting(record[1], record[2])
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if len(record) < 2 {
+			continue
+		}
+
+		lastScan, err := time.Parse(time.RFC3339Nano, record[1])
+		if err != nil {
+			return fmt.Errorf("unable to parse last scan time for root '%s', err: %w", record[0], err)
+		}
+
+		db.LastScans[record[0]] = lastScan
+	}
+
+	return nil
+}
+
+func readCsvFile(filePath string) ([][]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read input file '%s', err: %w", filePath, err)
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse file as CSV for '%s', err: %w", filePath, err)
+	}
+
+	return records, nil
+}
+
+// streamCsvFile calls handle for each record of the CSV DB file as it's read, see streamCsv
+func streamCsvFile(filePath string, handle func(record []string)) (rune, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read input file '%s', err: %w", filePath, err)
+	}
+	defer f.Close()
+
+	return streamCsv(f, filePath, handle)
+}
+
+// streamCsv calls handle for each record of a CSV DB read from the reader, the name identifies the source in errors.
+// The delimiter is detected from the marker line, and returned, 0 for comma.
+func streamCsv(r io.Reader, name string, handle func(record []string)) (rune, error) {
+	buffered := bufio.NewReader(r)
+
+	delimiter, err := readDelimiterMarker(buffered)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse file as CSV for '%s', err: %w", name, err)
+	}
+
+	csvReader := csv.NewReader(buffered)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	if delimiter != 0 {
+		csvReader.Comma = delimiter
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return delimiter, nil
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse file as CSV for '%s', err: %w", name, err)
+		}
+
+		handle(record)
+	}
+}
+
+// readDelimiterMarker reads the delimiter marker line if the reader starts with one, returning the delimiter. Without
+// a marker nothing is read, and 0 is returned for comma.
+func readDelimiterMarker(r *bufio.Reader) (rune, error) {
+	prefix, err := r.Peek(len(delimiterMarker))
+	if err != nil || string(prefix) != delimiterMarker {
+		return 0, nil
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	delimiter, err := parseDelimiter(strings.TrimRight(strings.TrimPrefix(line, delimiterMarker), "\r\n"))
+	if err != nil {
+		return 0, err
+	}
+
+	if delimiter == ',' {
+		return 0, nil
+	}
+
+	return delimiter, nil
+}
+
+// parseDelimiter parses a CSV field separator: a single character, or tab. Empty means comma.
+func parseDelimiter(raw string) (rune, error) {
+	switch raw {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	delimiter, size := utf8.DecodeRuneInString(raw)
+	if size != len(raw) || delimiter == utf8.RuneError || delimiter == '"' || delimiter == '\r' || delimiter == '\n' {
+		return 0, fmt.Errorf("'%s' can't separate fields, use a single character or tab", raw)
+	}
+
+	return delimiter, nil
+}
+
+// formatDelimiter formats the delimiter for the marker line, the reverse of parseDelimiter.
+func formatDelimiter(delimiter rune) string {
+	if delimiter == '\t' {
+		return "tab"
+	}
+
+	return string(delimiter)
+}
+
+func (db *DB) handleRecord(record []string) {
+	filePath := record[0]
+
+	filePath = strings.TrimSpace(filePath)
+
+	if len(filePath) == 0 {
+		return
+	}
+
+	size, err := strconv.Atoi(record[1])
+	if err != nil {
+		db.output.Errorf(errCodeReadDB, "Unable to parse size from record. File path: %s Raw data: %s, error: %v\n", record[0], record[1], err)
+
+		return
+	}
+
+	hash := record[colHash]
+
+	var modTime time.Time
+	if len(record) > colModTime && record[colModTime] != "" {
+		unix, err := strconv.ParseInt(record[colModTime], 10, 64)
+		if err != nil {
+			db.output.Errorf(errCodeReadDB, "Unable to parse modification time from record. File path: %s Raw data: %s, error: %v\n", record[0], record[colModTime], err)
+
+			return
+		}
+
+		modTime = time.Unix(unix, 0)
+	}
+
+	var tags []string
+	if len(record) > colTags && record[colTags] != "" {
+		tags = strings.Split(record[colTags], tagSeparator)
+	}
+
+	samplePosition := ""
+	if len(record) > colSamplePosition {
+		samplePosition = record[colSamplePosition]
+	}
+
+	crc := ""
+	if len(record) > colCRC32 {
+		crc = record[colCRC32]
+	}
+
+	var algoHashes map[string]string
+	if len(record) > colAlgoHashes {
+		algoHashes, err = parseAlgoHashes(record[colAlgoHashes])
+		if err != nil {
+			db.output.Errorf(errCodeReadDB, "Unable to parse hashes from record. File path: %s Raw data: %s, error: %v\n", record[0], record[colAlgoHashes], err)
+
+			return
+		}
+	}
+
+	hashMode := ""
+	if len(record) > colHashMode {
+		hashMode = record[colHashMode]
+	}
+
+	// Records written before roots were stored get the root of the last scans containing them
+	root := ""
+	if len(record) > colRoot {
+		root = record[colRoot]
+	}
+
+	if root == "" {
+		root = db.rootOf(filePath)
+	}
+
+	mode, owner := "", ""
+	if len(record) > colOwner {
+		mode, owner = record[colMode], record[colOwner]
+	}
+
+	// The disk size is only stored for sparse files
+	sparse, diskSize := false, 0
+	if len(record) > colDiskSize && record[colDiskSize] != "" {
+		diskSize, err = strconv.Atoi(record[colDiskSize])
+		if err != nil {
+			db.output.Errorf(errCodeReadDB, "Unable to parse disk size from record. File path: %s Raw data: %s, error: %v\n", record[0], record[colDiskSize], err)
+
+			return
+		}
+
+		sparse = true
+	}
+
+	canonical := false
+	if len(record) > colCanonical && record[colCanonical] != "" {
+		canonical, err = strconv.ParseBool(record[colCanonical])
+		if err != nil {
+			db.output.Errorf(errCodeReadDB, "Unable to parse canonical mark from record. File path: %s Raw data: %s, error: %v\n", record[0], record[colCanonical], err)
+
+			return
+		}
+	}
+
+	searchTerms := db.searchTerms(filePath)
+
+	err = db.add(Record{Path: filePath, Size: size, Hash: hash, ModTime: modTime, Tags: tags, SearchTerms: searchTerms, SamplePosition: samplePosition, CRC32: crc, AlgoHashes: algoHashes, HashMode: hashMode, Root: root, Mode: mode, Owner: owner, Sparse: sparse, DiskSize: diskSize, Canonical: canonical})
+	if err != nil {
+		db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", filePath, err)
+	}
+}
+
+func (db *DB) Scan(options ScanOptions, roots ...string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	start := time.Now()
+
+	results := make([]rootScanResult, len(roots))
+
+	if options.Parallel {
+		wg := sync.WaitGroup{}
+		for i, root := range roots {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				results[i] = db.scanRoot(root, options)
+			}()
+		}
+
+		wg.Wait()
+	} else {
+		for i, root := range roots {
+			results[i] = db.scanRoot(root, options)
+			if results[i].err != nil {
+				break
+			}
+		}
+	}
+
+	foundFiles := 0
+
+	var walkErrors []walkError
+
+	for _, result := range results {
+		if result.err != nil {
+			return result.err
+		}
+
+		foundFiles += result.foundFiles
+		walkErrors = append(walkErrors, result.walkErrors...)
+	}
+
+	db.printWalkErrors(walkErrors, options.Verbose)
+
+	db.printThroughput(foundFiles, time.Since(start))
+
+	return nil
+}
+
+func (db *DB) printWalkErrors(walkErrors []walkError, verbose bool) {
+	if len(walkErrors) == 0 {
+		return
+	}
+
+	db.output.Printf("%d paths could not be read\n", len(walkErrors))
+
+	if !verbose {
+		return
+	}
+
+	for _, walkErr := range walkErrors {
+		db.output.Printf("  - %s: %v\n", walkErr.path, walkErr.err)
+	}
+}
+
+type rootScanResult struct {
+	foundFiles int
+	walkErrors []walkError
+	err        error
+}
+
+// scanRoot scans a single root. Roots may be scanned concurrently, therefore the indexes are only accessed while
+// holding the index mutex, which is released during file system operations.
+func (db *DB) scanRoot(root string, options ScanOptions) rootScanResult {
+	scanStart := time.Now()
+
+	files, walkErrors, err := collectFiles(root, db.artifacts(), options)
+	if err != nil {
+		return rootScanResult{err: fmt.Errorf("unable to collect files in root %s, err: %w", root, err)}
+	}
+
+	db.handleMatches(root, files, walkErrors, options)
+
+	db.indexMutex.Lock()
+	db.LastScans[root] = scanStart
+	db.indexMutex.Unlock()
+
+	return rootScanResult{foundFiles: len(files), walkErrors: walkErrors}
+}
+
+func (db *DB) printThroughput(foundFiles int, elapsed time.Duration) {
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		seconds = time.Nanosecond.Seconds()
+	}
+
+	db.output.Printf(
+		"Scanned %s files (%s hashed) in %s - %.0f files/s, %.1f MB/s\n",
+		formatCount(foundFiles),
+		formatBytes(db.hashedBytes),
+		elapsed.Round(time.Millisecond),
+		float64(foundFiles)/seconds,
+		float64(db.hashedBytes)/MB/seconds,
+	)
+}
+
+// formatCount formats a number using comma as thousands separator, e.g. 12000 -> "12,000".
+func formatCount(n int) string {
+	str := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+
+	for i := len(str) - 3; i > 0; i -= 3 {
+		str = str[:i] + "," + str[i:]
+	}
+
+	return str
+}
+
+// formatBytes formats a byte count in a human-readable way, e.g. 1536 -> "1.5 KB".
+func formatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// walkError is an error encountered while walking a path, e.g. a directory which could not be read.
+type walkError struct {
+	path string
+	err  error
+}
+
+// collectFiles walks root and returns the files found with their sizes. Paths which could not be read are returned
+// separately, so that the walk can continue past them. Paths which no longer exist (e.g. a removed root) are not
+// considered errors. Excluded files (given as absolute paths) are skipped, and so are the subtrees under the excluded
+// roots of the options and hidden files and directories unless requested otherwise.
+func collectFiles(root string, excluded []string, options ScanOptions) (map[string]int64, []walkError, error) {
+	result := make(map[string]int64)
+
+	var walkErrors []walkError
+
+	excludedPaths := excludedWalkPaths(root, excluded)
+
+	var absExcludedRoots []string
+	for _, excludedRoot := range options.ExcludeRoots {
+		absExcludedRoot, err := filepath.Abs(excludedRoot)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid excluded root %s, err: %w", excludedRoot, err)
+		}
+
+		absExcludedRoots = append(absExcludedRoots, absExcludedRoot)
+	}
+
+	excludedRoots := slices.Collect(maps.Keys(excludedWalkPaths(root, absExcludedRoots)))
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if !options.IncludeHidden && path != root && strings.HasPrefix(filepath.Base(path), ".") {
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		// The root itself is never skipped, as that would remove all of its files from the catalog
+		if path != root && slices.ContainsFunc(excludedRoots, func(excludedRoot string) bool {
+			return isUnderRoot(path, excludedRoot)
+		}) {
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				walkErrors = append(walkErrors, walkError{path: path, err: err})
+			}
+
+			return nil
+		}
+
+		if _, ok := excludedPaths[path]; ok {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.IsDir() {
+			result[path] = info.Size()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to walk directory %s, err: %w", root, err)
+	}
+
+	return result, walkErrors, nil
+}
+
+// excludedWalkPaths converts absolute paths inside root to the form filepath.Walk reports them for root.
+func excludedWalkPaths(root string, excluded []string) map[string]struct{} {
+	result := make(map[string]struct{})
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return result
+	}
+
+	for _, excludedPath := range excluded {
+		rel, err := filepath.Rel(absRoot, excludedPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		result[filepath.Join(root, rel)] = struct{}{}
+	}
+
+	return result
+}
+
+// artifacts returns the absolute paths of the files and directories created by the catalog itself, which should never
+// be catalogued: the DB file, the files stored next to it and the paths recorded in its artifacts file.
+func (db *DB) artifacts() []string {
+	var result []string
+
+	artifacts := []string{
+		db.dbFile,
+		db.dbFile + metaFileSuffix,
+		db.dbFile + lockFileSuffix,
+		db.dbFile + artifactsFileSuffix,
+		db.dbFile + historyFileSuffix,
+		db.dbFile + tempFileSuffix,
+	}
+
+	recorded, err := readPathList(db.dbFile + artifactsFileSuffix)
+	if err != nil {
+		db.output.Errorf(errCodeReadDB, "Unable to read the recorded artifacts, err: %v\n", err)
+	}
+
+	for _, artifact := range slices.Sorted(maps.Keys(recorded)) {
+		artifacts = append(artifacts, artifact)
+	}
+
+	for _, artifact := range artifacts {
+		absPath, err := filepath.Abs(artifact)
+		if err != nil {
+			continue
+		}
+
+		result = append(result, absPath)
+	}
+
+	return result
+}
+
+// recordArtifact adds a file or directory written by a command to the artifacts file next to the DB file, so that
+// scans don't catalog it. Nothing is recorded for DBs read from stdin.
+func (db *DB) recordArtifact(path string) error {
+	if db.dbFile == stdinDBFile {
+		return nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("unable to resolve path %s, err: %w", path, err)
+	}
+
+	artifactsFile := db.dbFile + artifactsFileSuffix
+
+	recorded, err := readPathList(artifactsFile)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := recorded[absPath]; ok {
+		return nil
+	}
+
+	file, err := os.OpenFile(artifactsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open artifacts file %s, err: %w", artifactsFile, err)
+	}
+
+	_, err = fmt.Fprintln(file, absPath)
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("unable to write artifacts file %s, err: %w", artifactsFile, err)
+	}
+
+	return file.Close()
+}
+
+func (db *DB) handleMatches(root string, files map[string]int64, walkErrors []walkError, options ScanOptions) {
+	db.indexMutex.Lock()
+	lastScan, scannedBefore := db.LastScans[root]
+	checkChanges := options.SinceScan && scannedBefore
+
+	var tracker *progressTracker
+	if options.Progress {
+		tracker = db.newProgressTracker(files, options, checkChanges)
+	}
+
+	var inspected map[string]struct{}
+	if options.InspectArchives {
+		inspected = db.inspectedArchives()
+	}
+	db.indexMutex.Unlock()
+
+	// Add files found to the database, if not already there
+	skipped := 0
+	created := 0
+	updated := 0
+
+	var createdIDs []ID
+	for filename, size := range files {
+		db.indexMutex.Lock()
+		record, ok := db.Files[ID(filename)]
+		db.indexMutex.Unlock()
+
+		if !ok {
+			err := db.handleMatch(root, filename, options)
+			tracker.add(size)
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "%v\n", err)
+
+				continue
+			}
+
+			created++
+			createdIDs = append(createdIDs, ID(filename))
+
+			db.flushIfDue(options)
+
+			continue
+		}
+
+		// Files catalogued before roots were stored are assigned to the root they are found under
+		if record.Root == "" {
+			db.indexMutex.Lock()
+			record.Root = root
+			db.Files[ID(filename)] = record
+			db.indexMutex.Unlock()
+		}
+
+		if options.Resume {
+			changed, err := db.handleResumedMatch(root, record, options)
+			tracker.add(size)
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "%v\n", err)
+
+				continue
+			}
+
+			if !changed {
+				skipped++
+
+				continue
+			}
+
+			updated++
+
+			db.flushIfDue(options)
+
+			continue
+		}
+
+		if options.HashMissing && record.hash(options.HashAlgo) == "" {
+			err := db.fillHash(ID(filename), options)
+			tracker.add(size)
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "%v\n", err)
+
+				continue
+			}
+
+			updated++
+
+			continue
+		}
+
+		if !checkChanges {
+			if db.inspectPendingArchive(root, filename, inspected, options) {
+				updated++
+			} else {
+				skipped++
+			}
+
+			continue
+		}
+
+		changed, err := db.handleKnownMatch(root, filename, lastScan, options)
+		tracker.add(size)
+		if err != nil {
+			db.output.Errorf(errCodeReadFile, "%v\n", err)
+
+			continue
+		}
+
+		if changed || db.inspectPendingArchive(root, filename, inspected, options) {
+			updated++
+		} else {
+			skipped++
+		}
+	}
+
+	// Remove the files from the database which can no longer be found in the file system
+	// Files in paths which could not be read are kept, as they may still exist
+	var vanished []ID
+
+	db.indexMutex.Lock()
+	for _, record := range db.Files {
+		if !isUnderRoot(record.Path, root) {
+			continue
+		}
+
+		if slices.ContainsFunc(walkErrors, func(walkErr walkError) bool {
+			return isUnderRoot(record.Path, walkErr.path)
+		}) {
+			continue
+		}
+
+		// Archive entries exist as long as their archive does
+		path, _, _ := splitArchiveEntry(record.Path)
+
+		// Hidden files catalogued earlier are kept, as the walk skipping them doesn't mean they are gone
+		if !options.IncludeHidden && isHiddenUnderRoot(path, root) {
+			continue
+		}
+
+		if _, ok := files[path]; !ok {
+			vanished = append(vanished, ID(record.Path))
+		}
+	}
+
+	renamed := db.handleRenames(vanished, createdIDs, options)
+	for _, id := range vanished {
+		db.remove(id)
+	}
+	db.indexMutex.Unlock()
+
+	created -= renamed
+	deleted := len(vanished) - renamed
+
+	db.output.Printf("root: %s, %d found files, %d skipped, %d created, %d updated, %d renamed, %d deleted\n", root, len(files), skipped, created, updated, renamed, deleted)
+}
+
+// handleRenames pairs the records of vanished files with the records created in the same scan by their hash and size,
+// and carries the tags and the canonical mark of the vanished records over to their new paths. Files without a hash
+// and archive entries are never paired. The number of files renamed is returned, the vanished records are left for
+// the caller to remove.
+func (db *DB) handleRenames(vanished, created []ID, options ScanOptions) int {
+	type content struct {
+		hash string
+		size int
+	}
+
+	candidates := make(map[content][]ID)
+	for _, id := range slices.Sorted(slices.Values(created)) {
+		record, ok := db.Files[id]
+		if !ok || record.hash(options.HashAlgo) == "" {
+			continue
+		}
+
+		key := content{hash: record.hash(options.HashAlgo), size: record.Size}
+		candidates[key] = append(candidates[key], id)
+	}
+
+	renamed := 0
+
+	for _, id := range slices.Sorted(slices.Values(vanished)) {
+		record := db.Files[id]
+		if record.hash(options.HashAlgo) == "" || isArchiveEntry(record.Path) {
+			continue
+		}
+
+		key := content{hash: record.hash(options.HashAlgo), size: record.Size}
+		if len(candidates[key]) == 0 {
+			continue
+		}
+
+		newID := candidates[key][0]
+		candidates[key] = candidates[key][1:]
+
+		newRecord := db.Files[newID]
+		newRecord.Canonical = record.Canonical
+		db.Files[newID] = newRecord
+
+		err := db.tag(newID, record.Tags...)
+		if err != nil {
+			db.output.Errorf(errCodeUpdateDB, "Unable to keep the tags of renamed file, file path: %s, error: %v\n", newID, err)
+		}
+
+		renamed++
+	}
+
+	return renamed
+}
+
+// progressTracker reports the progress of a scan in 10% steps, based on the bytes processed rather than the number of
+// files, as file sizes can vary wildly. A nil progressTracker reports nothing.
+type progressTracker struct {
+	output   Output
+	total    int64
+	done     int64
+	lastStep int64
+}
+
+// newProgressTracker creates a tracker for the files which will be processed: the ones not in the database yet, plus
+// the known ones if they are to be checked for changes or hashed as well.
+func (db *DB) newProgressTracker(files map[string]int64, options ScanOptions, checkChanges bool) *progressTracker {
+	tracker := &progressTracker{output: db.output}
+
+	for filename, size := range files {
+		record, ok := db.Files[ID(filename)]
+		if ok && !checkChanges && (!options.HashMissing || record.hash(options.HashAlgo) != "") {
+			continue
+		}
+
+		tracker.total += size
+	}
+
+	return tracker
+}
+
+func (p *progressTracker) add(size int64) {
+	if p == nil || p.total == 0 {
+		return
+	}
+
+	p.done += size
+
+	step := p.done * 10 / p.total
+	if step <= p.lastStep {
+		return
+	}
+
+	p.lastStep = step
+
+	p.output.Printf("Progress: %d%% (%s / %s)\n", step*10, formatBytes(p.done), formatBytes(p.total))
+}
+
+// handleKnownMatch re-hashes a file already in the database if it was modified since the last scan.
+func (db *DB) handleKnownMatch(root, filename string, lastScan time.Time, options ScanOptions) (bool, error) {
+	fileInfo, err := os.Stat(filename)
+	if err != nil {
+		return false, fmt.Errorf("unable to stat file %s, err: %w", filename, err)
+	}
+
+	if fileInfo.ModTime().Before(lastScan) {
+		return false, nil
+	}
+
+	err = db.replaceMatch(root, filename, options)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// handleResumedMatch re-hashes a file already in the database, unless its hash was stored with the same size and
+// modification time the file has now, which means it was completed by an earlier, possibly interrupted scan.
+func (db *DB) handleResumedMatch(root string, record Record, options ScanOptions) (bool, error) {
+	fileInfo, err := os.Stat(record.Path)
+	if err != nil {
+		return false, fmt.Errorf("unable to stat file %s, err: %w", record.Path, err)
+	}
+
+	if record.hash(options.HashAlgo) != "" && int64(record.Size) == fileInfo.Size() && record.ModTime.Unix() == fileInfo.ModTime().Unix() {
+		return false, nil
+	}
+
+	err = db.replaceMatch(root, record.Path, options)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// replaceMatch re-catalogs a file already in the database, keeping its tags. The canonical mark is only kept if the
+// content of the file did not change.
+func (db *DB) replaceMatch(root, filename string, options ScanOptions) error {
+	db.indexMutex.Lock()
+	old := db.Files[ID(filename)]
+	tags := old.Tags
+	db.remove(ID(filename))
+	if isArchive(filename) {
+		db.removeArchiveEntries(filename)
+	}
+	db.indexMutex.Unlock()
+
+	err := db.handleMatch(root, filename, options)
+	if err != nil {
+		return err
+	}
+
+	db.indexMutex.Lock()
+	defer db.indexMutex.Unlock()
+
+	if record := db.Files[ID(filename)]; old.Canonical && old.Hash != "" && record.Hash == old.Hash {
+		record.Canonical = true
+		db.Files[ID(filename)] = record
+	}
+
+	return db.tag(ID(filename), tags...)
+}
+
+func (db *DB) handleMatch(root, filename string, options ScanOptions) error {
+	fileInfo, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("unable to stat file %s, err: %w", filename, err)
+	}
+
+	size := fileInfo.Size()
+	searchTerms := db.searchTerms(filename)
+
+	hash, crc := "", ""
+	if !options.NoHash {
+		hash, crc, err = db.hashSample(filename, size, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	record := Record{
+		Path:           filename,
+		Size:           int(size),
+		ModTime:        fileInfo.ModTime(),
+		SearchTerms:    searchTerms,
+		SamplePosition: samplePosition(size, options.SamplePosition),
+		CRC32:          crc,
+		Root:           root,
+	}
+	record.setHash(options.HashAlgo, hash)
+
+	if options.TreeHash && hash != "" {
+		record.HashMode = hashModeTree
+	}
+
+	record.Sparse, record.DiskSize = sparseDiskSize(fileInfo)
+
+	if options.StorePerms {
+		record.Mode = formatPerm(fileInfo.Mode())
+		record.Owner = fileOwner(fileInfo)
+	}
+
+	db.indexMutex.Lock()
+	err = db.add(record)
+	db.indexMutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("unable to add record to DB, file path: %s, err: %w", filename, err)
+	}
+
+	if options.InspectArchives && isArchive(filename) {
+		db.inspectArchive(root, filename)
+	}
+
+	return nil
+}
+
+// inspectArchive catalogs the entries of an archive. Errors are only reported, as the archive itself is catalogued.
+func (db *DB) inspectArchive(root, filename string) {
+	entries, err := readArchiveEntries(filename, db.readLimiter)
+	if err != nil {
+		db.output.Errorf(errCodeReadFile, "Unable to inspect archive %s, err: %v\n", filename, err)
+
+		return
+	}
+
+	db.indexMutex.Lock()
+	defer db.indexMutex.Unlock()
+
+	for _, entry := range entries {
+		path := filename + archiveSeparator + entry.name
+
+		db.hashedBytes += min(entry.size, MB)
+
+		err = db.add(Record{Path: path, Size: int(entry.size), Hash: entry.hash, ModTime: entry.modTime, SearchTerms: db.searchTerms(path), Root: root})
+		if err != nil {
+			db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, err: %v\n", path, err)
+		}
+	}
+}
+
+// inspectedArchives returns the paths of the archives with catalogued entries.
+func (db *DB) inspectedArchives() map[string]struct{} {
+	result := make(map[string]struct{})
+
+	for id := range db.Files {
+		if archivePath, _, ok := splitArchiveEntry(string(id)); ok {
+			result[archivePath] = struct{}{}
+		}
+	}
+
+	return result
+}
+
+// inspectPendingArchive catalogs the entries of a known archive which has none catalogued yet, e.g. because it was
+// scanned before archives were inspected. Archives without any entries are read again on each scan. It returns whether
+// the archive was inspected.
+func (db *DB) inspectPendingArchive(root, filename string, inspected map[string]struct{}, options ScanOptions) bool {
+	if !options.InspectArchives || !isArchive(filename) {
+		return false
+	}
+
+	if _, ok := inspected[filename]; ok {
+		return false
+	}
+
+	db.inspectArchive(root, filename)
+
+	return true
+}
+
+// removeArchiveEntries removes all catalogued entries of an archive.
+func (db *DB) removeArchiveEntries(filename string) {
+	for id := range db.Files {
+		if strings.HasPrefix(string(id), filename+archiveSeparator) {
+			db.remove(id)
+		}
+	}
+}
+
+// hashSample hashes the sample of a file used for identifying its content, respecting the read rate limit.
+// It returns the hash of the sample, and its CRC32 checksum if requested. With the tree hash the whole file is hashed
+// and no checksum is returned.
+func (db *DB) hashSample(filename string, size int64, options ScanOptions) (string, string, error) {
+	if options.TreeHash {
+		hash, err := treeHashFile(filename, options.HashAlgo, db.readLimiter)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to hash file %s, err: %w", filename, err)
+		}
+
+		db.indexMutex.Lock()
+		db.hashedBytes += size
+		db.indexMutex.Unlock()
+
+		return hash, "", nil
+	}
+
+	hashSize := MB
+	if size < MB {
+		hashSize = int(size)
+	}
+
+	db.readLimiter.wait(hashSize)
+
+	buf := samplePool.Get().(*[]byte)
+	defer samplePool.Put(buf)
+
+	data, err := readSampleInto(filename, *buf, hashSize, options.SamplePosition)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to hash file %s, err: %w", filename, err)
+	}
+
+	db.indexMutex.Lock()
+	db.hashedBytes += int64(hashSize)
+	db.indexMutex.Unlock()
+
+	crc := ""
+	if options.CRC32 {
+		crc = crc32Hex(data)
+	}
+
+	return hashData(data, options.HashAlgo), crc, nil
+}
+
+// fillHash calculates the missing hash of a record stored without one.
+func (db *DB) fillHash(id ID, options ScanOptions) error {
+	db.indexMutex.Lock()
+	record := db.Files[id]
+	db.indexMutex.Unlock()
+
+	hash, crc, err := db.hashSample(record.Path, int64(record.Size), options)
+	if err != nil {
+		return err
+	}
+
+	db.indexMutex.Lock()
+	defer db.indexMutex.Unlock()
+
+	db.remove(id)
+
+	record.setHash(options.HashAlgo, hash)
+	record.SamplePosition = samplePosition(int64(record.Size), options.SamplePosition)
+	record.CRC32 = crc
+
+	if options.TreeHash {
+		record.HashMode = hashModeTree
+	}
+
+	return db.add(record)
+}
+
+func (db *DB) add(record Record) error {
+	err := db.addRecord(record)
+	if err != nil {
+		return err
+	}
+
+	id := ID(record.Path)
+	for _, term := range record.SearchTerms {
+		db.SearchTerms[term] = append(db.SearchTerms[term], id)
+	}
+
+	return nil
+}
+
+// addRecord adds a record to the database and all indexes except for the search terms, which are loaded from binary
+// DB files as they are.
+func (db *DB) addRecord(record Record) error {
+	id := ID(record.Path)
+
+	// While loading, IDs are appended and sorted once the load is complete
+	if db.loading {
+		db.sortedIDs = append(db.sortedIDs, id)
+	} else {
+		db.sortedIDs = insertSorted(db.sortedIDs, id)
+	}
+	db.Files[id] = record
+	db.Sizes[record.Size] = append(db.Sizes[record.Size], id)
+	// Records scanned without hashing are not indexed by hash, so they are never considered duplicates by content
+	if record.Hash != "" {
+		db.Hashes[record.Hash] = append(db.Hashes[record.Hash], id)
+	}
+	for algo, hash := range record.AlgoHashes {
+		if db.AlgoHashes[algo] == nil {
+			db.AlgoHashes[algo] = make(map[string][]ID)
+		}
+		db.AlgoHashes[algo][hash] = append(db.AlgoHashes[algo][hash], id)
+	}
+	ext := pathToExtension(record.Path)
+	db.Extensions[ext] = append(db.Extensions[ext], id)
+	for _, tag := range record.Tags {
+		db.Tags[tag] = append(db.Tags[tag], id)
+	}
+
+	return nil
+}
+
+// Tag adds tags to a record already in the database. Tags are case-insensitive, and adding a tag twice is a no-op.
+func (db *DB) Tag(id ID, tags ...string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.tag(id, tags...)
+}
+
+func (db *DB) tag(id ID, tags ...string) error {
+	record, ok := db.Files[id]
+	if !ok {
+		return fmt.Errorf("file not found in DB: %s", id)
+	}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || strings.Contains(tag, tagSeparator) {
+			return fmt.Errorf("invalid tag: '%s'", tag)
+		}
+
+		if slices.Contains(record.Tags, tag) {
+			continue
+		}
+
+		record.Tags = append(record.Tags, tag)
+		db.Tags[tag] = append(db.Tags[tag], id)
+	}
+
+	db.Files[id] = record
+
+	return nil
+}
+
+// SetCanonical marks a record as the canonical copy of its hash, removing the mark from the other records of the same
+// hash, or removes the mark from the record.
+func (db *DB) SetCanonical(id ID, mark bool) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	record, ok := db.Files[id]
+	if !ok {
+		return fmt.Errorf("file not found in DB: %s", id)
+	}
+
+	if mark && record.Hash == "" {
+		return fmt.Errorf("file has no hash: %s", id)
+	}
+
+	if mark {
+		for _, other := range db.Hashes[record.Hash] {
+			if otherRecord := db.Files[other]; otherRecord.Canonical {
+				otherRecord.Canonical = false
+				db.Files[other] = otherRecord
+			}
+		}
+	}
+
+	record.Canonical = mark
+	db.Files[id] = record
+
+	return nil
+}
+
+// remove deletes a record from the database, including all of its indexes.
+func (db *DB) remove(id ID) {
+	record, ok := db.Files[id]
+	if !ok {
+		return
+	}
+
+	delete(db.Files, id)
+
+	if i, found := slices.BinarySearch(db.sortedIDs, id); found {
+		db.sortedIDs = slices.Delete(db.sortedIDs, i, i+1)
+	}
+
+	db.Sizes[record.Size] = removeID(db.Sizes[record.Size], id)
+	if len(db.Sizes[record.Size]) == 0 {
+		delete(db.Sizes, record.Size)
+	}
+
+	for _, term := range record.SearchTerms {
+		db.SearchTerms[term] = removeID(db.SearchTerms[term], id)
+		if len(db.SearchTerms[term]) == 0 {
+			delete(db.SearchTerms, term)
+		}
+	}
+
+	db.Hashes[record.Hash] = removeID(db.Hashes[record.Hash], id)
+	if len(db.Hashes[record.Hash]) == 0 {
+		delete(db.Hashes, record.Hash)
+	}
+
+	for algo, hash := range record.AlgoHashes {
+		db.AlgoHashes[algo][hash] = removeID(db.AlgoHashes[algo][hash], id)
+		if len(db.AlgoHashes[algo][hash]) == 0 {
+			delete(db.AlgoHashes[algo], hash)
+		}
+	}
+
+	ext := pathToExtension(record.Path)
+	db.Extensions[ext] = removeID(db.Extensions[ext], id)
+	if len(db.Extensions[ext]) == 0 {
+		delete(db.Extensions, ext)
+	}
+
+	for _, tag := range record.Tags {
+		db.Tags[tag] = removeID(db.Tags[tag], id)
+		if len(db.Tags[tag]) == 0 {
+			delete(db.Tags, tag)
+		}
+	}
+}
+
+// insertSorted inserts the ID into the sorted IDs, unless it's already there. Appending is the fast path, as records
+// are usually added in sorted order while loading.
+func insertSorted(ids []ID, id ID) []ID {
+	if len(ids) == 0 || ids[len(ids)-1] < id {
+		return append(ids, id)
+	}
+
+	i, found := slices.BinarySearch(ids, id)
+	if found {
+		return ids
+	}
+
+	return slices.Insert(ids, i, id)
+}
+
+// idsUnder returns the IDs of the files under the directory (or the file itself), sorted by path. Files under a
+// directory form a contiguous range of the sorted IDs, so they are found by binary search.
+func (db *DB) idsUnder(dir string) []ID {
+	clean := filepath.Clean(dir)
+
+	// Relative roots are matched by isUnderRoot only
+	if clean == "." {
+		return slices.DeleteFunc(slices.Clone(db.sortedIDs), func(id ID) bool {
+			return !isUnderRoot(string(id), dir)
+		})
+	}
+
+	var ids []ID
+	if i, found := slices.BinarySearch(db.sortedIDs, ID(clean)); found {
+		ids = append(ids, db.sortedIDs[i])
+	}
+
+	prefix := clean
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	start, _ := slices.BinarySearch(db.sortedIDs, ID(prefix))
+	for _, id := range db.sortedIDs[start:] {
+		if !strings.HasPrefix(string(id), prefix) {
+			break
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func removeID(ids []ID, id ID) []ID {
+	return slices.DeleteFunc(ids, func(current ID) bool {
+		return current == id
+	})
+}
+
+func (db *DB) Write() error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.write()
+}
+
+// flushIfDue writes the DB file during a scan after every FlushEvery new or updated files, so that an interrupted scan
+// can be resumed without hashing the same files again. It must be called without holding the index mutex.
+func (db *DB) flushIfDue(options ScanOptions) {
+	if options.FlushEvery <= 0 {
+		return
+	}
+
+	db.indexMutex.Lock()
+	defer db.indexMutex.Unlock()
+
+	db.unflushed++
+	if db.unflushed < options.FlushEvery {
+		return
+	}
+
+	db.unflushed = 0
+
+	err := db.write()
+	if err != nil {
+		db.output.Errorf(errCodeWriteDB, "Error writing DB: %v\n", err)
+	}
+}
+
+// write writes the DB file, the caller is responsible for locking. The DB is written to a temporary file next to the
+// DB file, which replaces the DB file once it's synced to the disk, so that an interrupted write (e.g. a crash during a
+// flush of a long scan) never leaves a truncated DB file behind.
+func (db *DB) write() error {
+	if db.dbFile == stdinDBFile {
+		return errors.New("the DB read from stdin can't be written")
+	}
+
+	// A symlinked DB file is kept, the file it points to is replaced instead
+	target := db.dbFile
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(target); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tempFile := target + tempFileSuffix
+
+	file, err := os.OpenFile(tempFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("unable to create DB file %s, err: %w", tempFile, err)
+	}
+	defer os.Remove(tempFile)
+	defer file.Close()
+
+	// Records are written sorted by path, so that unchanged catalogs are written byte-identical
+	ids := make([]ID, 0, len(db.Files))
+	for id := range db.Files {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	if isBinaryDB(db.dbFile) {
+		err = db.writeBinary(file, ids)
+	} else {
+		err = db.writeCSV(file, ids)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to sync DB file %s, err: %w", tempFile, err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close DB file %s, err: %w", tempFile, err)
+	}
+
+	err = os.Rename(tempFile, target)
+	if err != nil {
+		return fmt.Errorf("unable to replace DB file %s, err: %w", target, err)
+	}
+
+	return db.writeMeta()
+}
+
+func (db *DB) writeCSV(file io.Writer, ids []ID) error {
+	writer := csv.NewWriter(file)
+
+	// The marker makes loading detect the delimiter, files separated by commas have none for compatibility
+	if db.delimiter != 0 && db.delimiter != ',' {
+		_, err := fmt.Fprintf(file, "%s%s\n", delimiterMarker, formatDelimiter(db.delimiter))
+		if err != nil {
+			return fmt.Errorf("unable to write DB file %s, err: %w", db.dbFile, err)
+		}
+
+		writer.Comma = db.delimiter
+	}
+
+	for _, id := range ids {
+		record := []string{
+			db.Files[id].Path,
+			strconv.Itoa(db.Files[id].Size),
+			db.Files[id].Hash,
+			formatModTime(db.Files[id].ModTime),
+			strings.Join(db.Files[id].Tags, tagSeparator),
+			db.Files[id].SamplePosition,
+			db.Files[id].CRC32,
+			formatAlgoHashes(db.Files[id].AlgoHashes),
+			db.Files[id].HashMode,
+			db.Files[id].Root,
+			db.Files[id].Mode,
+			db.Files[id].Owner,
+			formatDiskSize(db.Files[id]),
+			formatCanonical(db.Files[id]),
+		}
+		err := writer.Write(record)
+		if err != nil {
+			return fmt.Errorf("unable to write record to DB file %s, err: %w", db.dbFile, err)
+		}
+	}
+
+	writer.Flush()
+
+	err := writer.Error()
+	if err != nil {
+		return fmt.Errorf("unable to write DB file %s, err: %w", db.dbFile, err)
+	}
+
+	return nil
+}
+
+func (db *DB) writeBinary(file io.Writer, ids []ID) error {
+	content := binaryDB{
+		Version:       binaryDBVersion,
+		MinTermLength: db.minTermLength,
+		MaxTermLength: db.maxTermLength,
+		Records:       make([]binaryRecord, 0, len(ids)),
+		SearchTerms:   make(map[string][]int, len(db.SearchTerms)),
+	}
+
+	for position, id := range ids {
+		record := db.Files[id]
+
+		for _, term := range record.SearchTerms {
+			content.SearchTerms[term] = append(content.SearchTerms[term], position)
+		}
+
+		var modTime int64
+		if !record.ModTime.IsZero() {
+			modTime = record.ModTime.Unix()
+		}
+
+		content.Records = append(content.Records, binaryRecord{
+			Path:           record.Path,
+			Size:           record.Size,
+			Hash:           record.Hash,
+			ModTime:        modTime,
+			Tags:           record.Tags,
+			SamplePosition: record.SamplePosition,
+			CRC32:          record.CRC32,
+			AlgoHashes:     record.AlgoHashes,
+			HashMode:       record.HashMode,
+			Root:           record.Root,
+			Mode:           record.Mode,
+			Owner:          record.Owner,
+			Sparse:         record.Sparse,
+			DiskSize:       record.DiskSize,
+			Canonical:      record.Canonical,
+			SearchTerms:    record.SearchTerms,
+		})
+	}
+
+	writer := bufio.NewWriter(file)
+
+	err := gob.NewEncoder(writer).Encode(content)
+	if err != nil {
+		return fmt.Errorf("unable to write binary DB file %s, err: %w", db.dbFile, err)
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("unable to write binary DB file %s, err: %w", db.dbFile, err)
+	}
+
+	return nil
+}
+
+func formatModTime(modTime time.Time) string {
+	if modTime.IsZero() {
+		return ""
+	}
+
+	return strconv.FormatInt(modTime.Unix(), 10)
+}
+
+// writeMeta stores the last scan time of each root in the meta file next to the DB file.
+func (db *DB) writeMeta() error {
+	if len(db.LastScans) == 0 && db.minTermLength == 0 && db.maxTermLength == 0 {
+		return nil
+	}
+
+	metaFile := db.dbFile + metaFileSuffix
+
+	file, err := os.Create(metaFile)
+	if err != nil {
+		return fmt.Errorf("unable to create DB meta file %s, err: %w", metaFile, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	roots := make([]string, 0, len(db.LastScans))
+	for root := range db.LastScans {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	for _, root := range roots {
+		err = writer.Write([]string{root, db.LastScans[root].Format(time.RFC3339Nano)})
+		if err != nil {
+			return fmt.Errorf("unable to write record to DB meta file %s, err: %w", metaFile, err)
+		}
+	}
+
+	if db.minTermLength > 0 {
+		err = writer.Write([]string{metaSetting, metaSettingMinTermLength, strconv.Itoa(db.minTermLength)})
+		if err != nil {
+			return fmt.Errorf("unable to write setting to DB meta file %s, err: %w", metaFile, err)
+		}
+	}
+
+	if db.maxTermLength > 0 {
+		err = writer.Write([]string{metaSetting, metaSettingMaxTermLength, strconv.Itoa(db.maxTermLength)})
+		if err != nil {
+			return fmt.Errorf("unable to write setting to DB meta file %s, err: %w", metaFile, err)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) handleSetting(name, value string) error {
+	switch name {
+	case metaSettingMinTermLength:
+		minTermLength, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse setting '%s', err: %w", name, err)
+		}
+
+		db.minTermLength = minTermLength
+	case metaSettingMaxTermLength:
+		maxTermLength, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse setting '%s', err: %w", name, err)
+		}
+
+		db.maxTermLength = maxTermLength
+	}
+
+	return nil
+}
+
+// SetMinTermLength changes the length of the shortest search terms kept in the index and rebuilds the index.
+func (db *DB) SetMinTermLength(minTermLength int) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.minTermLength = minTermLength
+
+	db.reindex()
+}
+
+// SetMaxTermLength changes the length above which search terms are split into chunks and rebuilds the index.
+func (db *DB) SetMaxTermLength(maxTermLength int) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.maxTermLength = maxTermLength
+
+	db.reindex()
+}
+
+// Reindex rebuilds all indexes from the records, repairing them should they ever drift from the records.
+func (db *DB) Reindex() {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.reindex()
+
+	db.output.Printf("Reindexed %d files\n", len(db.Files))
+}
+
+// UpdateOutdatedHashes re-hashes the files which were hashed with an outdated hash mode, so that their hashes can be
+// compared to the ones of other files again. All stored hashes and the CRC32 checksum are recalculated.
+func (db *DB) UpdateOutdatedHashes() {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	ids := make([]ID, 0, len(db.Files))
+	for id, record := range db.Files {
+		if record.HashMode != "" && record.HashMode != hashModeTree && record.HashMode != hashModeFullMD5 {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	// A single buffer is reused for all samples
+	buf := make([]byte, MB)
+
+	updated, failed := 0, 0
+	for _, id := range ids {
+		record := db.Files[id]
+
+		// Archive entries can't be re-hashed without extracting them
+		if isArchiveEntry(record.Path) {
+			failed++
+
+			continue
+		}
+
+		data, err := readSampleInto(record.Path, buf, MB, record.SamplePosition)
+		if err != nil {
+			db.output.Errorf(errCodeReadFile, "%v\n", err)
+			failed++
+
+			continue
+		}
+
+		db.remove(id)
+
+		for _, algo := range record.hashAlgos() {
+			record.setHash(algo, hashData(data, algo))
+		}
+
+		if record.CRC32 != "" {
+			record.CRC32 = crc32Hex(data)
+		}
+
+		record.HashMode = ""
+
+		err = db.add(record)
+		if err != nil {
+			db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", record.Path, err)
+			failed++
+
+			continue
+		}
+
+		updated++
+	}
+
+	db.output.Printf("Updated %d outdated hashes, %d failed\n", updated, failed)
+}
+
+// recomputeHash hashes the file of the record the same way it was hashed when stored: the sample already read into
+// data, or the whole file for tree and full hashes.
+func (db *DB) recomputeHash(record Record, data []byte, algo string) (string, error) {
+	switch record.HashMode {
+	case hashModeTree:
+		return treeHashFile(record.Path, algo, db.readLimiter)
+	case hashModeFullMD5:
+		return hashWholeFile(record.Path, algo)
+	}
+
+	return hashData(data, algo), nil
+}
+
+// Rehash calculates the hashes missing for the algorithm, keeping the hashes of other algorithms.
+func (db *DB) Rehash(algo string) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	ids := make([]ID, 0, len(db.Files))
+	for id := range db.Files {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	// A single buffer is reused for all samples
+	buf := make([]byte, MB)
+
+	rehashed, failed := 0, 0
+	for _, id := range ids {
+		record := db.Files[id]
+
+		// Archive entries can't be re-hashed without extracting them
+		if record.hash(algo) != "" || isArchiveEntry(record.Path) {
+			continue
+		}
+
+		var (
+			data []byte
+			err  error
+		)
+		if record.HashMode != hashModeTree && record.HashMode != hashModeFullMD5 {
+			data, err = readSampleInto(record.Path, buf, MB, record.SamplePosition)
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "%v\n", err)
+				failed++
+
+				continue
+			}
+		}
+
+		hash, err := db.recomputeHash(record, data, algo)
+		if err != nil {
+			db.output.Errorf(errCodeReadFile, "%v\n", err)
+			failed++
+
+			continue
+		}
+
+		db.remove(id)
+
+		record.setHash(algo, hash)
+
+		err = db.add(record)
+		if err != nil {
+			db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", record.Path, err)
+			failed++
+
+			continue
+		}
+
+		rehashed++
+	}
+
+	db.output.Printf("Rehashed %d files with %s, %d failed\n", rehashed, algo, failed)
+}
+
+func (db *DB) reindex() {
+	ids := make([]ID, 0, len(db.Files))
+	for id := range db.Files {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	files := db.Files
+
+	db.Files = make(map[ID]Record, len(files))
+	db.Sizes = make(map[int][]ID)
+	db.Hashes = make(map[string][]ID)
+	db.AlgoHashes = make(map[string]map[string][]ID)
+	db.SearchTerms = make(map[string][]ID)
+	db.Extensions = make(map[string][]ID)
+	db.Tags = make(map[string][]ID)
+	db.sortedIDs = nil
+
+	for _, id := range ids {
+		record := files[id]
+		record.SearchTerms = db.searchTerms(record.Path)
+
+		err := db.add(record)
+		if err != nil {
+			db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", record.Path, err)
+		}
+	}
+}
+
+// searchTerms returns the search terms of a path which are long enough to be indexed. Too long terms are split into
+// chunks first. Repeated terms (e.g. of foo-foo-bar.txt) are only returned once, so that a file is indexed under each
+// term only once.
+func (db *DB) searchTerms(filePath string) []string {
+	maxLength := db.maxTermLength
+	if maxLength <= 0 {
+		maxLength = defaultMaxTermLength
+	}
+
+	terms := splitLongTerms(pathToSearchTerms(filePath), maxLength)
+
+	seen := make(map[string]struct{}, len(terms))
+
+	return slices.DeleteFunc(terms, func(term string) bool {
+		if len(term) < db.minTermLength {
+			return true
+		}
+
+		if _, ok := seen[term]; ok {
+			return true
+		}
+
+		seen[term] = struct{}{}
+
+		return false
+	})
+}
+
+func pathToSearchTerms(filePath string) []string {
+	var terms []string
+	for _, span := range pathTermSpans(filePath) {
+		terms = append(terms, span.term)
+	}
+
+	return terms
+}
+
+// splitLongTerms splits the terms longer than maxLength bytes into chunks of at most maxLength bytes, without splitting
+// runes. Very long file names (e.g. base64 blobs) would otherwise produce giant terms which bloat the index and never
+// match a query typed by a human.
+func splitLongTerms(terms []string, maxLength int) []string {
+	result := make([]string, 0, len(terms))
+	for _, term := range terms {
+		for len(term) > maxLength {
+			cut := maxLength
+			for cut > 0 && !utf8.RuneStart(term[cut]) {
+				cut--
+			}
+
+			// A rune longer than the maximum is kept whole
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(term)
+			}
+
+			result = append(result, term[:cut])
+			term = term[cut:]
+		}
+
+		result = append(result, term)
+	}
+
+	return result
+}
+
+// termSpan is a search term of a path, with the byte range of the part of the path it was derived from.
+type termSpan struct {
+	term       string
+	start, end int
+}
+
+// pathTermSpans splits the file name of a path into search terms, keeping track of where each term is in the path, so
+// that the terms matched by a search can be highlighted in the path.
+func pathTermSpans(filePath string) []termSpan {
+	offset := 0
+
+	// Archive entries are searched by their own name
+	if archivePath, _, ok := splitArchiveEntry(filePath); ok {
+		offset = len(archivePath) + len(archiveSeparator)
+	}
+
+	dir, fileName := filepath.Split(filePath[offset:])
+	offset += len(dir)
+
+	var spans []termSpan
+	for _, part := range strings.Split(fileName, "-") {
+		start := offset + len(part) - len(strings.TrimLeftFunc(part, unicode.IsSpace))
+		trimmed := strings.TrimSpace(part)
+
+		// Terms are normalized to NFC, so that names stored decomposed (e.g. on macOS) match the composed ones
+		spans = append(spans, termSpan{term: norm.NFC.String(strings.ToLower(trimmed)), start: start, end: start + len(trimmed)})
+
+		offset += len(part) + 1
+	}
+
+	return spans
+}
+
+// pathToExtension returns the lowercase extension of a file without the leading dot, e.g. "IMG_01.JPG" -> "jpg".
+func pathToExtension(filePath string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(filePath)), ".")
+}
+
+type QueryField string
+
+const (
+	QueryFieldExt QueryField = "ext"
+	QueryFieldTag QueryField = "tag"
+)
+
+// QueryFilter is a node of a query matching a field of the records exactly, e.g. "ext:jpg".
+type QueryFilter struct {
+	Field QueryField
+	Value string
+}
+
+// Query is a conjunction of plain search terms and field filters.
+type Query struct {
+	Terms   []string
+	Filters []QueryFilter
+}
+
+// ParseQuery turns raw search arguments into a query. Arguments prefixed by a known field (e.g. "ext:jpg", "tag:keep")
+// become filters, everything else is a plain search term.
+func ParseQuery(args []string) (Query, error) {
+	var query Query
+
+	for _, arg := range args {
+		field, value, found := strings.Cut(arg, ":")
+		if !found {
+			query.Terms = append(query.Terms, norm.NFC.String(arg))
+
+			continue
+		}
+
+		switch QueryField(strings.ToLower(field)) {
+		case QueryFieldExt:
+			value = strings.TrimPrefix(value, ".")
+		case QueryFieldTag:
+		default:
+			query.Terms = append(query.Terms, norm.NFC.String(arg))
+
+			continue
+		}
+
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			return Query{}, fmt.Errorf("missing value for '%s' in '%s'", field, arg)
+		}
+
+		query.Filters = append(query.Filters, QueryFilter{Field: QueryField(strings.ToLower(field)), Value: value})
+	}
+
+	if len(query.Terms) == 0 && len(query.Filters) == 0 {
+		return Query{}, fmt.Errorf("empty query")
+	}
+
+	return query, nil
+}
+
+func (db *DB) Search(options SearchOptions, query Query) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	intersected, stop := db.find(options, query)
+
+	// Machine-readable formats only get the results, a search without any is printed as an empty result set
+	isMachineReadable := options.Format == formatCSV || options.Format == formatTSV || options.Format == formatJSON
+	if stop != nil && isMachineReadable {
+		if stop.tooBroad {
+			db.output.Errorf(errCodeSearch, "%s\n", stop.message)
+			db.output.Exit(1)
+
+			return
+		}
+
+		intersected = nil
+	}
+
+	if stop != nil && !isMachineReadable {
+		if stop.message != "" {
+			db.output.Println(stop.message)
+		}
+
+		db.output.Println("No results found.")
+
+		return
+	}
+
+	switch options.Format {
+	case formatCSV:
+		db.PrintCSV(intersected)
+
+		return
+	case formatTSV:
+		db.PrintTSV(intersected, options.ShowTime != "")
+
+		return
+	case formatJSON:
+		db.PrintJSON(intersected)
+
+		return
+	}
+
+	printOptions := PrintOptions{ShowTime: options.ShowTime, ShowPerms: options.ShowPerms, Dedupe: options.Dedupe, SearchMode: options.Mode, Limit: options.Limit}
+	if options.ShowMatches {
+		printOptions.MatchMode = options.Mode
+	}
+
+	db.PrintIDs(intersected, query.Terms, printOptions)
+}
+
+// Repl answers the search queries read line by line until EOF or :quit. Lines starting with a colon change the
+// options of the following searches: :fast and :slow switch the search mode, :limit N caps the printed results.
+func (db *DB) Repl(options SearchOptions) {
+	db.output.Printf("Loaded %d files, enter search queries (:fast, :slow, :limit N, :quit)\n", len(db.Files))
+
+	for {
+		line := ""
+
+		err := db.output.Scanln(&line)
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if !strings.HasPrefix(fields[0], ":") {
+			query, err := ParseQuery(fields)
+			if err != nil {
+				db.output.Errorf(errCodeSearch, "Error parsing query: %v\n", err)
+
+				continue
+			}
+
+			db.Search(options, query)
+
+			continue
+		}
+
+		switch {
+		case fields[0] == ":quit":
+			return
+		case fields[0] == ":fast" || fields[0] == ":slow":
+			options.Mode = strings.TrimPrefix(fields[0], ":")
+			db.output.Printf("Search mode: %s\n", options.Mode)
+		case fields[0] == ":limit" && len(fields) == 2:
+			limit, err := strconv.Atoi(fields[1])
+			if err != nil || limit < 1 {
+				db.output.Printf("Invalid limit: %s\n", fields[1])
+
+				continue
+			}
+
+			options.Limit = limit
+			db.output.Printf("Limit: %d\n", limit)
+		default:
+			db.output.Printf("Unknown command: %s\n", line)
+		}
+	}
+}
+
+// find returns the IDs of the files matching the query. Found is false if one of the terms or filters has no match.
+// searchStop explains why a search was stopped without results. The message is a sentence meant for the user, empty
+// if there is nothing to explain. Too broad searches may have results, they were only stopped for matching too many
+// files.
+type searchStop struct {
+	message  string
+	tooBroad bool
+}
+
+// find returns the IDs matching the query, or the reason the search was stopped without results. The IDs returned may
+// be the slice of an index, so they must not be modified.
+func (db *DB) find(options SearchOptions, query Query) ([]ID, *searchStop) {
+	var (
+		allIDs [][]ID
+		stop   *searchStop
+	)
+
+	switch options.Mode {
+	case fast:
+		allIDs, stop = db.fastCollectIDs(query.Terms)
+	case slow:
+		allIDs, stop = db.slowCollectIDs(query.Terms, options.MaxCandidates, options.MaxResults)
+	}
+
+	if stop != nil {
+		return nil, stop
+	}
+
+	if len(query.Terms) > 0 && len(allIDs) == 0 {
+		return nil, &searchStop{}
+	}
+
+	filterIDs, stop := db.filterCollectIDs(query.Filters)
+	if stop != nil {
+		return nil, stop
+	}
+
+	allIDs = append(allIDs, filterIDs...)
+
+	if len(allIDs) == 0 {
+		return nil, &searchStop{}
+	}
+
+	collected := 0
+	for _, ids := range allIDs {
+		collected += len(ids)
+	}
+
+	if options.MaxResults > 0 && collected > options.MaxResults {
+		return nil, maxResultsStop(options.MaxResults)
+	}
+
+	return intersectAllIDs(allIDs), nil
+}
+
+type searchResult struct {
+	Path    string    `json:"path"`
+	Size    int       `json:"size"`
+	Hash    string    `json:"hash"`
+	ModTime time.Time `json:"modTime"`
+	Tags    []string  `json:"tags"`
+}
+
+// Handler returns the HTTP API of the catalog. GET /search takes the same query as termSearch in the q parameter
+// (separated by spaces) and the search mode in the mode parameter, and returns the matching files as JSON. Searches
+// matching more than maxResults files are rejected with 422 Unprocessable Entity.
+func (db *DB) Handler(maxResults int) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /search", func(w http.ResponseWriter, r *http.Request) {
+		options := SearchOptions{Mode: r.URL.Query().Get("mode"), MaxResults: maxResults}
+		if options.Mode == "" {
+			options.Mode = slow
+		}
+
+		if options.Mode != fast && options.Mode != slow {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown search mode: %s", options.Mode)})
+
+			return
+		}
+
+		query, err := ParseQuery(strings.Fields(r.URL.Query().Get("q")))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+
+			return
+		}
+
+		db.mutex.RLock()
+		defer db.mutex.RUnlock()
+
+		// The IDs may be shared with the indexes, which must not be reordered while other requests read them
+		ids, stop := db.find(options, query)
+		if stop != nil && stop.tooBroad {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": stop.message})
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string][]searchResult{"results": db.searchResults(ids)})
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (db *DB) filterCollectIDs(filters []QueryFilter) ([][]ID, *searchStop) {
+	var results [][]ID
+
+	for _, filter := range filters {
+		var index map[string][]ID
+
+		switch filter.Field {
+		case QueryFieldExt:
+			index = db.Extensions
+		case QueryFieldTag:
+			index = db.Tags
+		}
+
+		ids, ok := index[filter.Value]
+		if !ok || len(ids) == 0 {
+			return nil, &searchStop{message: fmt.Sprintf("No results found for filter '%s:%s'.", filter.Field, filter.Value)}
+		}
+
+		results = append(results, ids)
+	}
+
+	return results, nil
+}
+
+func (db *DB) fastCollectIDs(searchedTerms []string) ([][]ID, *searchStop) {
+	var results [][]ID
+
+	for _, searchedTerm := range searchedTerms {
+		termIDs, ok := db.SearchTerms[searchedTerm]
+		if !ok {
+			return nil, &searchStop{message: fmt.Sprintf("No results found for search term '%s'.", searchedTerm)}
+		}
+
+		if len(termIDs) == 0 {
+			return nil, &searchStop{}
+		}
+
+		results = append(results, termIDs)
+	}
+
+	return results, nil
+}
+
+// slowCollectIDs collects the IDs of files with search terms containing each searched term. If a searched term
+// matches more than maxCandidates files, or all searched terms more than maxResults files, the search is abandoned
+// instead of intersecting huge sets of IDs.
+func (db *DB) slowCollectIDs(searchedTerms []string, maxCandidates, maxResults int) ([][]ID, *searchStop) {
+	var results [][]ID
+
+	collected := 0
+
+	for _, searchedTerm := range searchedTerms {
+		found := make(map[ID]struct{})
+
+		for term, ids := range db.SearchTerms {
+			if !strings.Contains(term, searchedTerm) {
+				continue
+			}
+
+			for _, id := range ids {
+				found[id] = struct{}{}
+			}
+
+			if maxCandidates > 0 && len(found) > maxCandidates {
+				return nil, &searchStop{
+					message:  fmt.Sprintf("Search term '%s' is too broad, it matches more than %d files. Add more specific terms.", searchedTerm, maxCandidates),
+					tooBroad: true,
+				}
+			}
+
+			if maxResults > 0 && collected+len(found) > maxResults {
+				return nil, maxResultsStop(maxResults)
+			}
+		}
+
+		if len(found) == 0 {
+			return nil, &searchStop{message: fmt.Sprintf("No results found for search term '%s'.", searchedTerm)}
+		}
+
+		uniqueIDs := []ID{}
+		for id := range found {
+			uniqueIDs = append(uniqueIDs, id)
+		}
+
+		results = append(results, uniqueIDs)
+
+		collected += len(uniqueIDs)
+	}
+
+	return results, nil
+}
+
+func maxResultsStop(maxResults int) *searchStop {
+	return &searchStop{
+		message:  fmt.Sprintf("Search stopped, the terms match more than %d files together. Add more specific terms or raise --%s.", maxResults, flagMaxResults),
+		tooBroad: true,
+	}
+}
+
+// intersectAllIDs returns the IDs of the first group which are present in all the other groups. The groups are
+// intersected starting from the smallest one, which keeps the intermediate results small and finds an empty
+// intersection early. The result keeps the order (and repetitions) of the first group.
+func intersectAllIDs(idGroups [][]ID) []ID {
+	if len(idGroups) == 1 {
+		return idGroups[0]
+	}
+
+	bySize := slices.Clone(idGroups)
+	slices.SortStableFunc(bySize, func(a, b []ID) int {
+		return cmp.Compare(len(a), len(b))
+	})
+
+	idGroup := bySize[0]
+	for _, termIDs := range bySize[1:] {
+		idGroup = intersectIDs(idGroup, termIDs)
+
+		if len(idGroup) == 0 {
+			return nil
+		}
+	}
+
+	found := make(map[ID]struct{}, len(idGroup))
+	for _, id := range idGroup {
+		found[id] = struct{}{}
+	}
+
+	var result []ID
+	for _, id := range idGroups[0] {
+		if _, ok := found[id]; ok {
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
+
+func intersectIDs(a, b []ID) []ID {
+	var result []ID
+
+	for _, id := range a {
+		if slices.Contains(b, id) {
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
+
+type PrintOptions struct {
+	// ShowTime shows the modification time of the files, see the showTime constants, empty for not showing it
+	ShowTime string
+	// MatchMode shows the stored search terms matched by the search terms, using the search mode (fast or slow).
+	// Empty for not showing them.
+	MatchMode string
+	// ShowPerms shows the stored permission bits and owner of the files
+	ShowPerms bool
+	// SearchMode is the search mode (fast or slow) the search terms were matched in, so that the highlights show the
+	// terms the index matched. Empty for highlighting them like slow searches.
+	SearchMode string
+	// Dedupe prints each path only once, even if the IDs contain it multiple times
+	Dedupe bool
+	// Limit caps the number of files printed, 0 for the default of maxLines
+	Limit int
+}
+
+func (db *DB) PrintIDs(ids []ID, searchTerms []string, options PrintOptions) {
+	// The IDs are sorted into a copy before truncating, so that the first files by path are shown, and the slice of
+	// the caller (e.g. an index) is not reordered or overwritten by compacting
+	ids = slices.Sorted(slices.Values(ids))
+	if options.Dedupe {
+		ids = slices.Compact(ids)
+	}
+
+	// The total is captured before truncating, so that only really truncated lists are reported as such
+	limit := maxLines
+	if options.Limit > 0 {
+		limit = options.Limit
+	}
+
+	total := len(ids)
+	if total > limit {
+		ids = ids[:limit]
+	}
+
+	now := time.Now()
+
+	for i, id := range ids {
+		record := db.Files[id]
+
+		path := FindHighlights(record.Path, searchTerms, options.SearchMode)
+
+		line := fmt.Sprintf("[%d] %s (%d MB)", i+1, path, record.Size/MB)
+
+		if options.ShowTime != "" {
+			line += " - " + formatModTimeFor(record.ModTime, options.ShowTime, now)
+		}
+
+		if options.ShowPerms {
+			line += " [" + formatPerms(record) + "]"
+		}
+
+		if options.MatchMode != "" {
+			line += " [matched: " + strings.Join(matchedTerms(record, options.MatchMode, searchTerms), ", ") + "]"
+		}
+
+		db.output.Println(line)
+	}
+
+	if total > len(ids) {
+		db.output.Printf("... (showing %d of %d)\n", len(ids), total)
+	}
+}
+
+// matchedTerms returns the stored search terms of the record matched by the searched terms, either exactly (fast) or
+// by containing them (slow).
+func matchedTerms(record Record, mode string, searchedTerms []string) []string {
+	var matched []string
+	for _, term := range record.SearchTerms {
+		if slices.ContainsFunc(searchedTerms, func(searchedTerm string) bool {
+			if mode == fast {
+				return term == searchedTerm
+			}
+
+			return strings.Contains(term, searchedTerm)
+		}) {
+			matched = append(matched, term)
+		}
+	}
+
+	return matched
+}
+
+// sparseDiskSize detects sparse files, which have less bytes allocated on disk than their size. It returns the
+// allocated bytes for them. Files are never detected as sparse where the platform doesn't report the allocation.
+func sparseDiskSize(fileInfo os.FileInfo) (bool, int) {
+	usage, ok := diskUsage(fileInfo)
+	if !ok || !fileInfo.Mode().IsRegular() || usage >= fileInfo.Size() {
+		return false, 0
+	}
+
+	return true, int(usage)
+}
+
+// formatDiskSize formats the disk size stored for sparse files, empty for other files.
+func formatDiskSize(record Record) string {
+	if !record.Sparse {
+		return ""
+	}
+
+	return strconv.Itoa(record.DiskSize)
+}
+
+// formatCanonical formats the canonical mark of a record, empty for records not marked.
+func formatCanonical(record Record) string {
+	if !record.Canonical {
+		return ""
+	}
+
+	return strconv.FormatBool(true)
+}
+
+// formatPerm formats the permission bits of a file mode in octal, e.g. 0644.
+func formatPerm(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// formatPerms formats the stored permission bits and owner of a record, e.g. -rw-r--r-- 1000:1000.
+func formatPerms(record Record) string {
+	if record.Mode == "" {
+		return "perms unknown"
+	}
+
+	perms := record.Mode
+
+	perm, err := strconv.ParseUint(record.Mode, 8, 32)
+	if err == nil {
+		perms = os.FileMode(perm).String()
+	}
+
+	if record.Owner == "" {
+		return perms
+	}
+
+	return perms + " " + record.Owner
+}
+
+func isShowTime(showTime string) bool {
+	switch showTime {
+	case "", showTimeRelative, showTimeAbsolute:
+		return true
+	}
+
+	return false
+}
+
+// formatModTimeFor formats the modification time for displaying it, either relative to now or as a date.
+func formatModTimeFor(modTime time.Time, showTime string, now time.Time) string {
+	if modTime.IsZero() {
+		return "unknown time"
+	}
+
+	if showTime == showTimeAbsolute {
+		return modTime.Local().Format("2006-01-02 15:04")
+	}
+
+	return formatAge(now.Sub(modTime))
+}
+
+// formatAge formats a duration as a rough age, e.g. 3 months ago.
+func formatAge(age time.Duration) string {
+	const (
+		day   = 24 * time.Hour
+		month = 30 * day
+		year  = 365 * day
+	)
+
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", year},
+		{"month", month},
+		{"day", day},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+
+	if age < 0 {
+		return "in the future"
+	}
+
+	for _, unit := range units {
+		n := int(age / unit.size)
+		if n == 0 {
+			continue
+		}
+
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit.name)
+		}
+
+		return fmt.Sprintf("%d %ss ago", n, unit.name)
+	}
+
+	return "just now"
+}
+
+// PrintCSV prints the records as CSV with a header row, for further processing by other tools.
+func (db *DB) PrintCSV(ids []ID) {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+
+	rows := [][]string{{"path", "size", "hash"}}
+	for _, id := range ids {
+		record := db.Files[id]
+
+		rows = append(rows, []string{record.Path, strconv.Itoa(record.Size), record.Hash})
+	}
+
+	db.printCSVRows(rows)
+}
+
+// PrintJSON prints the files as a JSON object, in the same format as the results of the HTTP API.
+func (db *DB) PrintJSON(ids []ID) {
+	content, err := json.Marshal(map[string][]searchResult{"results": db.searchResults(ids)})
+	if err != nil {
+		db.output.Errorf(errCodeSearch, "Error encoding results: %v\n", err)
+
+		return
+	}
+
+	db.output.Println(string(content))
+}
+
+// searchResults converts the files to search results sorted by path.
+func (db *DB) searchResults(ids []ID) []searchResult {
+	results := make([]searchResult, 0, len(ids))
+	for _, id := range slices.Sorted(slices.Values(ids)) {
+		record := db.Files[id]
+
+		results = append(results, searchResult{Path: record.Path, Size: record.Size, Hash: record.Hash, ModTime: record.ModTime, Tags: record.Tags})
+	}
+
+	return results
+}
+
+// PrintTSV prints the files as tab-separated values with a header row, optionally with their modification times.
+func (db *DB) PrintTSV(ids []ID, withModTime bool) {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+
+	header := []string{"path", "size", "hash"}
+	if withModTime {
+		header = append(header, "mtime")
+	}
+
+	rows := [][]string{header}
+	for _, id := range ids {
+		record := db.Files[id]
+
+		row := []string{record.Path, strconv.Itoa(record.Size), record.Hash}
+		if withModTime {
+			modTime := ""
+			if !record.ModTime.IsZero() {
+				modTime = record.ModTime.Local().Format(time.RFC3339)
+			}
+
+			row = append(row, modTime)
+		}
+
+		rows = append(rows, row)
+	}
+
+	db.printTSVRows(rows)
+}
+
+// tsvEscaper escapes the characters which would break the columns or rows of TSV output
+var tsvEscaper = strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// printTSVRows prints the rows as tab-separated values. Tabs and line breaks in the values are escaped as \t, \n and
+// \r, so that each row stays on one line with the same number of columns.
+func (db *DB) printTSVRows(rows [][]string) {
+	buf := &strings.Builder{}
+
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+
+			buf.WriteString(tsvEscaper.Replace(value))
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	db.output.Printf("%s", buf.String())
+}
+
+func (db *DB) printCSVRows(rows [][]string) {
+	buf := &bytes.Buffer{}
+
+	writer := csv.NewWriter(buf)
+
+	err := writer.WriteAll(rows)
+	if err != nil {
+		db.output.Errorf(errCodeWriteFile, "Unable to write CSV output, err: %v\n", err)
+
+		return
+	}
+
+	db.output.Printf("%s", buf.String())
+}
+
+// FindHighlights highlights the needles in the path, as matched in the search mode (fast or slow, empty for slow).
+func FindHighlights(haystack string, needles []string, mode string) string {
+	var highlights [][2]int
+
+	spans := pathTermSpans(haystack)
+
+	for _, searchTerm := range needles {
+		highlight, ok := findHighlight(haystack, spans, searchTerm, mode)
+		if !ok {
+			continue
+		}
+
+		highlights = append(highlights, highlight)
+	}
+
+	sort.Slice(highlights, func(i, j int) bool {
+		return highlights[i][0] < highlights[j][0]
+	})
+
+	var parts []string
+
+	tmp := 0
+	for _, highlight := range highlights {
+		// This means that ranges overlap. Let's abort highlighting for the sake of simplicity.
+		if tmp > 0 && tmp > highlight[0] {
+			return blueBold + haystack + reset
+		}
+
+		parts = append(parts,
+			haystack[tmp:highlight[0]],
+			redBold+haystack[highlight[0]:highlight[1]]+reset)
+
+		tmp = highlight[1]
+	}
+
+	if tmp < len(haystack) {
+		parts = append(parts, haystack[tmp:])
+	}
+
+	if len(parts) <= 1 {
+		return yellowBold + haystack + reset
+	}
+
+	return strings.Join(parts, "")
+}
+
+// findHighlight returns the byte range of the path to highlight for a searched term. The term is looked for in the
+// search terms of the path first, the same way the index matches it, so that matched files always show why they
+// matched, even if the term also occurs elsewhere in the path (e.g. in a directory name) or lowercasing changes the
+// length of the path. Terms not matching any search term (e.g. ones spanning multiple terms) are looked for in the
+// whole path. Fast searches only match whole terms, so a term equal to the searched one is preferred to the ones only
+// containing it.
+func findHighlight(haystack string, spans []termSpan, searchTerm, mode string) ([2]int, bool) {
+	if mode == fast {
+		for _, span := range spans {
+			if span.term == searchTerm {
+				return [2]int{span.start, span.end}, true
+			}
+		}
+	}
+
+	for _, span := range spans {
+		if !strings.Contains(span.term, searchTerm) {
+			continue
+		}
+
+		// The term is highlighted within the matched part if lowercasing kept its byte offsets, otherwise the whole part is
+		original := haystack[span.start:span.end]
+		if idx := strings.Index(strings.ToLower(original), searchTerm); idx >= 0 && len(span.term) == len(original) {
+			return [2]int{span.start + idx, span.start + idx + len(searchTerm)}, true
+		}
+
+		return [2]int{span.start, span.end}, true
+	}
+
+	lower := strings.ToLower(haystack)
+	if len(lower) != len(haystack) {
+		return [2]int{}, false
+	}
+
+	idx := strings.Index(lower, searchTerm)
+	if idx == -1 {
+		return [2]int{}, false
+	}
+
+	return [2]int{idx, idx + len(searchTerm)}, true
+}
+
+// Verify re-hashes catalogued files and compares the results with the stored hashes.
+// If a checkpoint file is given, paths verified OK are appended to it as the verification progresses, and paths
+// already listed are skipped, so that an interrupted verification can be resumed. The checkpoint file is removed
+// once all files were processed.
+func (db *DB) Verify(options VerifyOptions) error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	verified := make(map[string]struct{})
+
+	var checkpoint *os.File
+	if options.Checkpoint != "" {
+		var err error
+
+		verified, err = readPathList(options.Checkpoint)
+		if err != nil {
+			return err
+		}
+
+		err = db.recordArtifact(options.Checkpoint)
+		if err != nil {
+			return err
+		}
+
+		checkpoint, err = os.OpenFile(options.Checkpoint, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("unable to open checkpoint file %s, err: %w", options.Checkpoint, err)
+		}
+		defer checkpoint.Close()
+	}
+
+	ids := make([]ID, 0, len(db.Files))
+	for id := range db.Files {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	if options.SamplePercent > 0 {
+		total := len(ids)
+		ids = sampleIDs(ids, options.SamplePercent, options.Seed)
+
+		db.output.Printf("Sampled %d of %d files (seed: %d)\n", len(ids), total, options.Seed)
+	}
+
+	// A single buffer is reused for all samples
+	buf := make([]byte, MB)
+
+	ok, mismatched, missing, skipped := 0, 0, 0, 0
+	for _, id := range ids {
+		record := db.Files[id]
+
+		if _, found := verified[record.Path]; found {
+			skipped++
+
+			continue
+		}
+
+		// Archive entries can't be re-hashed without extracting them
+		if isArchiveEntry(record.Path) {
+			skipped++
+
+			continue
+		}
+
+		if _, err := os.Stat(record.Path); os.IsNotExist(err) {
+			db.output.Printf("Missing: %s\n", record.Path)
+			missing++
+
+			continue
+		}
+
+		// Tree and full hashes are calculated from the whole file, so no sample is read for them
+		var (
+			data []byte
+			err  error
+		)
+		if record.HashMode != hashModeTree && record.HashMode != hashModeFullMD5 {
+			db.readLimiter.wait(min(record.Size, MB))
+
+			data, err = readSampleInto(record.Path, buf, MB, record.SamplePosition)
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "%v\n", err)
+				mismatched++
+
+				continue
+			}
+		}
+
+		// The stored checksum rejects changed files without calculating their hashes. It is calculated over the sample
+		// already read, so unchanged files only pay for the cheap checksum on top of their hashes.
+		if record.CRC32 != "" && data != nil {
+			if crc := crc32Hex(data); crc != record.CRC32 {
+				db.output.Printf("Mismatch: %s (stored crc32: %s, actual: %s)\n", record.Path, record.CRC32, crc)
+				mismatched++
+
+				continue
+			}
+		}
+
+		mismatch := false
+		for _, algo := range record.hashAlgos() {
+			hash, err := db.recomputeHash(record, data, algo)
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "%v\n", err)
+				mismatch = true
+
+				break
+			}
+
+			if hash == record.hash(algo) {
+				continue
+			}
+
+			if algo == hashAlgoMD5 {
+				db.output.Printf("Mismatch: %s (stored: %s, actual: %s)\n", record.Path, record.Hash, hash)
+			} else {
+				db.output.Printf("Mismatch: %s (stored %s: %s, actual: %s)\n", record.Path, algo, record.hash(algo), hash)
+			}
+
+			mismatch = true
+
+			break
+		}
+
+		if mismatch {
+			mismatched++
+
+			continue
+		}
+
+		ok++
+
+		if checkpoint != nil {
+			if _, err := fmt.Fprintln(checkpoint, record.Path); err != nil {
+				return fmt.Errorf("unable to write checkpoint file %s, err: %w", options.Checkpoint, err)
+			}
+		}
+	}
+
+	db.output.Printf("Verified %d files: %d ok, %d mismatched, %d missing, %d skipped\n", ok+mismatched+missing, ok, mismatched, missing, skipped)
+
+	if checkpoint != nil {
+		if err := checkpoint.Close(); err != nil {
+			return fmt.Errorf("unable to close checkpoint file %s, err: %w", options.Checkpoint, err)
+		}
+
+		if err := os.Remove(options.Checkpoint); err != nil {
+			return fmt.Errorf("unable to remove checkpoint file %s, err: %w", options.Checkpoint, err)
+		}
+	}
+
+	db.reportStaleHashGroups()
+
+	return nil
+}
+
+// sampleIDs returns a random sample of about the given percent of the sorted IDs, at least one if there are any. The
+// sample is sorted as well and depends only on the IDs and the seed.
+func sampleIDs(ids []ID, percent float64, seed int64) []ID {
+	if len(ids) == 0 {
+		return ids
+	}
+
+	count := max(int(float64(len(ids))*percent/100+0.5), 1)
+
+	sample := slices.Clone(ids)
+
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	rng.Shuffle(len(sample), func(i, j int) {
+		sample[i], sample[j] = sample[j], sample[i]
+	})
+
+	sample = sample[:min(count, len(sample))]
+	slices.Sort(sample)
+
+	return sample
+}
+
+// reportStaleHashGroups reports groups of files sharing a hash where some of the members no longer exist on disk,
+// as these groups would show misleading duplicates.
+func (db *DB) reportStaleHashGroups() {
+	hashes := make([]string, 0, len(db.Hashes))
+	for hash, ids := range db.Hashes {
+		if len(ids) < 2 {
+			continue
+		}
+
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	stale := 0
+	for _, hash := range hashes {
+		ids := slices.Clone(db.Hashes[hash])
+		slices.Sort(ids)
+
+		var missing, present []string
+		for _, id := range ids {
+			path := db.Files[id].Path
+			archivePath, _, _ := splitArchiveEntry(path)
+
+			if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+				missing = append(missing, path)
+			} else {
+				present = append(present, path)
+			}
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+
+		stale++
+
+		db.output.Printf("Stale hash group: %s (%d missing, %d present)\n", hash, len(missing), len(present))
+		for _, path := range missing {
+			db.output.Printf("  missing: %s\n", path)
+		}
+		for _, path := range present {
+			db.output.Printf("  present: %s\n", path)
+		}
+	}
+
+	if stale > 0 {
+		db.output.Printf("%d hash groups have missing members\n", stale)
+	}
+}
+
+// readPathList reads the paths listed in a file one per line, e.g. a checkpoint. A missing file is an empty list.
+func readPathList(filePath string) (map[string]struct{}, error) {
+	result := make(map[string]struct{})
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s, err: %w", filePath, err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		result[line] = struct{}{}
+	}
+
+	return result, nil
+}
+
+// rateLimiter is a token bucket limiting throughput to a number of units (e.g. bytes) per second.
+// It is safe to share between goroutines. A nil rateLimiter does not limit at all.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond int64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		rate:   float64(perSecond),
+		tokens: float64(perSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n units can be consumed. Requests larger than the bucket are allowed, the caller will then
+// wait for the deficit to be refilled.
+func (l *rateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+
+	deficit := -l.tokens
+
+	l.mutex.Unlock()
+
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / l.rate * float64(time.Second)))
+	}
+}
+
+// parseByteSize parses sizes like "512", "100KB", "50MB" or "1.5GB" into bytes. Units are binary (1KB = 1024B).
+// An empty string is parsed as 0.
+func parseByteSize(raw string) (int64, error) {
+	raw = strings.ToUpper(strings.TrimSpace(raw))
+	if raw == "" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(raw, unit.suffix) {
+			multiplier = unit.multiplier
+			raw = strings.TrimSpace(strings.TrimSuffix(raw, unit.suffix))
+
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: '%s'", raw)
+	}
+
+	return int64(value * multiplier), nil
+}
+
+// readHead reads at most n bytes from the beginning of a file.
+func readHead(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open file: %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	data := make([]byte, n)
+
+	read, err := io.ReadFull(f, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("can't read file: %s, err: %w", path, err)
+	}
+
+	return data[:read], nil
+}
+
+// archiveEntry is a regular file stored inside an archive.
+type archiveEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// isArchive reports whether the file is an archive which can be inspected.
+func isArchive(path string) bool {
+	path = strings.ToLower(path)
+
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitArchiveEntry splits the path of an archive entry into the path of the archive and the path of the entry inside
+// it. Paths which only contain the separator without an archive before it (e.g. a file named notes::draft.txt) are not
+// archive entries, they are returned unchanged.
+func splitArchiveEntry(path string) (string, string, bool) {
+	for start := 0; ; {
+		idx := strings.Index(path[start:], archiveSeparator)
+		if idx < 0 {
+			return path, "", false
+		}
+
+		end := start + idx
+		if isArchive(path[:end]) {
+			return path[:end], path[end+len(archiveSeparator):], true
+		}
+
+		start = end + len(archiveSeparator)
+	}
+}
+
+// isArchiveEntry tells whether the path is the path of an entry inside an archive.
+func isArchiveEntry(path string) bool {
+	_, _, ok := splitArchiveEntry(path)
+
+	return ok
+}
+
+// readArchiveEntries lists the regular files in a zip or tar archive. Entries are hashed the same way as files, so that
+// they can be compared to each other.
+func readArchiveEntries(path string, limiter *rateLimiter) ([]archiveEntry, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		return readZipEntries(path, limiter)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open file: %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(path), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("can't decompress file: %s, err: %w", path, err)
+		}
+		defer gz.Close()
+
+		r = gz
+	}
+
+	var entries []archiveEntry
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't read tar archive: %s, err: %w", path, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		limiter.wait(int(min(header.Size, MB)))
+
+		hash, err := hashReader(tr, header.Size)
+		if err != nil {
+			return nil, fmt.Errorf("can't hash entry %s in archive: %s, err: %w", header.Name, path, err)
+		}
+
+		entries = append(entries, archiveEntry{name: header.Name, size: header.Size, modTime: header.ModTime, hash: hash})
+	}
+
+	return entries, nil
+}
+
+func readZipEntries(path string, limiter *rateLimiter) ([]archiveEntry, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open zip archive: %s, err: %w", path, err)
+	}
+	defer zr.Close()
+
+	var entries []archiveEntry
+
+	for _, file := range zr.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		size := int64(file.UncompressedSize64)
+
+		limiter.wait(int(min(size, MB)))
+
+		r, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("can't open entry %s in archive: %s, err: %w", file.Name, path, err)
+		}
+
+		hash, err := hashReader(r, size)
+		r.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("can't hash entry %s in archive: %s, err: %w", file.Name, path, err)
+		}
+
+		entries = append(entries, archiveEntry{name: file.Name, size: size, modTime: file.Modified, hash: hash})
+	}
+
+	return entries, nil
+}
+
+// hashReader hashes the first MB of the content, the same sample hashFile uses by default.
+func hashReader(r io.Reader, size int64) (string, error) {
+	data := make([]byte, min(size, MB))
+
+	_, err := io.ReadFull(r, data)
+	if err != nil {
+		return "", err
+	}
+
+	return md5Hex(data), nil
+}
+
+// samplePosition returns the sample position stored for a file. Files not larger than the sample are hashed in full,
+// so the position is irrelevant for them and the default is stored.
+func samplePosition(size int64, position string) string {
+	if size <= MB || position == samplePositionHead {
+		return ""
+	}
+
+	return position
+}
+
+func hashFile(path string, sampleSize int, position string) (string, error) {
+	data, err := readSample(path, sampleSize, position)
+	if err != nil {
+		return "", err
+	}
+
+	return md5Hex(data), nil
+}
+
+// hashWholeFile hashes the whole content of the file with the algorithm, like md5sum or sha256sum does.
+func hashWholeFile(path, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("can't open file: %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	var h hash.Hash = md5.New()
+	if algo == hashAlgoSHA256 {
+		h = sha256.New()
+	}
+
+	if _, err = io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("can't read file: %s, err: %w", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func crc32Hex(data []byte) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))
+}
+
+// readSample reads the sample of the file which is hashed. The sample is taken from the beginning of the file by
+// default, from the end for the tail position, or half from both ends for the both position, so that the IO cost is
+// the same.
+func readSample(path string, sampleSize int, position string) ([]byte, error) {
+	return readSampleInto(path, nil, sampleSize, position)
+}
+
+// samplePool holds the buffers samples are read into while scanning, shared by the workers of parallel scans
+var samplePool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, MB)
+
+		return &buf
+	},
+}
+
+// readSampleInto reads the sample like readSample, but into buf if it's large enough, so that buffers can be reused.
+// The returned data is only valid until buf is reused. It is always fully overwritten, so no data of previously read
+// files is returned.
+func readSampleInto(path string, buf []byte, sampleSize int, position string) ([]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't stat file: %s, err: %w", path, err)
+	}
+
+	if fi.Size() < MB {
+		sampleSize = int(fi.Size())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open file: %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	if cap(buf) < sampleSize {
+		buf = make([]byte, sampleSize)
+	}
+
+	data := buf[:sampleSize]
+
+	switch {
+	case int64(sampleSize) >= fi.Size() || position == "" || position == samplePositionHead:
+		_, err = io.ReadFull(f, data)
+	case position == samplePositionTail:
+		_, err = f.ReadAt(data, fi.Size()-int64(sampleSize))
+	default:
+		headSize := sampleSize / 2
+
+		_, err = io.ReadFull(f, data[:headSize])
+		if err == nil {
+			_, err = f.ReadAt(data[headSize:], fi.Size()-int64(sampleSize-headSize))
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't read file: %s, err: %w", path, err)
+	}
+
+	if err = f.Close(); err != nil {
+		return nil, fmt.Errorf("can't close file: %s, err: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// treeHashFile hashes the whole file by hashing chunks of treeHashChunkSize in parallel, then hashing the
+// concatenated chunk hashes into the final hash (a Merkle-style root). Chunks and the root are hashed with different
+// prefixes, so a tree hash never equals the plain hash of any content. Reads respect the rate limiter.
+func treeHashFile(path, algo string, limiter *rateLimiter) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("can't open file: %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("can't stat file: %s, err: %w", path, err)
+	}
+
+	size := fi.Size()
+	chunks := max(1, int((size+treeHashChunkSize-1)/treeHashChunkSize))
+	chunkHashes := make([]string, chunks)
+	errs := make([]error, chunks)
+
+	// The number of chunks in memory at the same time is limited to the number of workers
+	sem := make(chan struct{}, runtime.NumCPU())
+	wg := sync.WaitGroup{}
+
+	for i := range chunks {
+		offset := int64(i) * treeHashChunkSize
+		length := min(treeHashChunkSize, size-offset)
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			limiter.wait(int(length))
+
+			data := make([]byte, 1+length)
+			if _, err := f.ReadAt(data[1:], offset); err != nil {
+				errs[i] = fmt.Errorf("can't read file: %s, err: %w", path, err)
+
+				return
+			}
+
+			chunkHashes[i] = hashData(data, algo)
+		}()
+	}
+
+	wg.Wait()
+
+	if err = errors.Join(errs...); err != nil {
+		return "", err
+	}
+
+	return hashData([]byte("\x01"+strings.Join(chunkHashes, "")), algo), nil
+}
+
+// Orphans lists the catalogued files which are not inside any of the roots, sorted by path.
+func (db *DB) Orphans(roots []string) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var paths []string
+	for _, record := range db.Files {
+		if slices.ContainsFunc(roots, func(root string) bool {
+			return isRecordUnderRoot(record, root)
+		}) {
+			continue
+		}
+
+		paths = append(paths, record.Path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		db.output.Println(path)
+	}
+
+	db.output.Printf("Orphaned files: %d\n", len(paths))
+}
+
+// Empty prints the catalogued zero-byte files, sorted by path.
+func (db *DB) Empty() {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	paths := make([]string, 0, len(db.Sizes[0]))
+	for _, id := range db.Sizes[0] {
+		paths = append(paths, db.Files[id].Path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		db.output.Println(path)
+	}
+
+	db.output.Printf("Empty files: %d\n", len(paths))
+}
+
+// UniqueTo prints the files under the root which have no copy with the same hash and size outside of the root.
+// Files without a hash can't be compared, so they are listed as unique as well, marked as not hashed.
+func (db *DB) UniqueTo(root string) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var paths []string
+	for _, id := range db.idsUnder(root) {
+		record := db.Files[id]
+		if !isRecordUnderRoot(record, root) {
+			continue
+		}
+
+		if record.Hash == "" {
+			paths = append(paths, record.Path+" (not hashed)")
+
+			continue
+		}
+
+		if slices.ContainsFunc(db.Hashes[record.Hash], func(id ID) bool {
+			other := db.Files[id]
+
+			return other.Size == record.Size && other.SamplePosition == record.SamplePosition && !isRecordUnderRoot(other, root)
+		}) {
+			continue
+		}
+
+		paths = append(paths, record.Path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		db.output.Println(path)
+	}
+
+	db.output.Printf("Files unique to %s: %d\n", root, len(paths))
+}
+
+// Overlap lists the files of the other catalog which have no copy with the same hash and size in this catalog, i.e.
+// the files which would be lost by retiring the other drive, and summarizes the share of the other catalog present.
+func (db *DB) Overlap(other *DB) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+
+	var (
+		missing                  []string
+		present                  int
+		presentBytes, totalBytes int64
+	)
+
+	for _, record := range other.Files {
+		totalBytes += int64(record.Size)
+
+		if record.Hash == "" {
+			missing = append(missing, record.Path+" (not hashed)")
+
+			continue
+		}
+
+		if db.hasContentOf(record) {
+			present++
+			presentBytes += int64(record.Size)
+
+			continue
+		}
+
+		missing = append(missing, record.Path)
+	}
+	sort.Strings(missing)
+
+	for _, path := range missing {
+		db.output.Println(path)
+	}
+
+	db.output.Printf("Files missing from %s: %d\n", db.dbFile, len(missing))
+	db.output.Printf("Files of %s present in %s: %d of %d (%s of %s)\n", other.dbFile, db.dbFile, present, len(other.Files), formatBytes(presentBytes), formatBytes(totalBytes))
+}
+
+// hasContentOf returns true if the catalog contains a file with the same hash and size as the record, hashed from the
+// same sample. Records without a hash are never found.
+func (db *DB) hasContentOf(record Record) bool {
+	if record.Hash == "" {
+		return false
+	}
+
+	return slices.ContainsFunc(db.Hashes[record.Hash], func(id ID) bool {
+		own := db.Files[id]
+
+		return own.Size == record.Size && own.SamplePosition == record.SamplePosition
+	})
+}
+
+// Reconcile prints the actions which would make the target catalog match this one by content (hash and size): the
+// files to copy, which have no copy in the target, and the files to delete, whose content is not in this catalog.
+// Files of the target without a hash are never listed for deletion, as their content is unknown. Files are not
+// touched, it's only a plan.
+func (db *DB) Reconcile(target *DB) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	target.mutex.RLock()
+	defer target.mutex.RUnlock()
+
+	var (
+		toCopy, toDelete       []string
+		copyBytes, deleteBytes int64
+		unhashed               int
+	)
+
+	for _, record := range db.Files {
+		if target.hasContentOf(record) {
+			continue
+		}
+
+		path := record.Path
+		if record.Hash == "" {
+			path += " (not hashed)"
+		}
+
+		toCopy = append(toCopy, path)
+		copyBytes += int64(record.Size)
+	}
+	sort.Strings(toCopy)
+
+	for _, record := range target.Files {
+		if record.Hash == "" {
+			unhashed++
+
+			continue
+		}
+
+		if db.hasContentOf(record) {
+			continue
+		}
+
+		toDelete = append(toDelete, record.Path)
+		deleteBytes += int64(record.Size)
+	}
+	sort.Strings(toDelete)
+
+	for _, path := range toCopy {
+		db.output.Printf("copy %s\n", path)
+	}
+
+	for _, path := range toDelete {
+		db.output.Printf("delete %s\n", path)
+	}
+
+	db.output.Printf("Files to copy to %s: %d (%s)\n", target.dbFile, len(toCopy), formatBytes(copyBytes))
+	db.output.Printf("Files to delete from %s: %d (%s)\n", target.dbFile, len(toDelete), formatBytes(deleteBytes))
+
+	if unhashed > 0 {
+		db.output.Printf("Files of %s kept without a hash to compare: %d\n", target.dbFile, unhashed)
+	}
+}
+
+// ByHash prints the files whose hash starts with the prefix, grouped by hash. A prefix matching multiple hashes is
+// reported as ambiguous.
+func (db *DB) ByHash(prefix string) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	prefix = strings.ToLower(prefix)
+
+	var hashes []string
+	for hash := range db.Hashes {
+		if strings.HasPrefix(hash, prefix) {
+			hashes = append(hashes, hash)
+		}
+	}
+	slices.Sort(hashes)
+
+	if len(hashes) == 0 {
+		db.output.Printf("No files found with hash prefix %s\n", prefix)
+
+		return
+	}
+
+	if len(hashes) > 1 {
+		db.output.Printf("Warning: hash prefix %s is ambiguous, it matches %d hashes\n", prefix, len(hashes))
+	}
+
+	for _, hash := range hashes {
+		db.output.Printf("%s:\n", hash)
+
+		// The IDs are cloned, as printing sorts them and the index must not be reordered
+		db.PrintIDs(slices.Clone(db.Hashes[hash]), nil, PrintOptions{})
+	}
+}
+
+// Under prints the files under the directory.
+func (db *DB) Under(dir, showTime string) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	ids := db.idsUnder(dir)
+	if len(ids) == 0 {
+		db.output.Printf("No files found under %s\n", dir)
+
+		return
+	}
+
+	db.PrintIDs(ids, nil, PrintOptions{ShowTime: showTime})
+}
+
+// Collisions prints the groups of paths which are equal when compared case-insensitively, e.g. Foo.txt and foo.txt.
+func (db *DB) Collisions() {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	folded := make(map[string][]string)
+	for _, record := range db.Files {
+		key := strings.ToLower(record.Path)
+		folded[key] = append(folded[key], record.Path)
+	}
+
+	var groups [][]string
+	for _, paths := range folded {
+		if len(paths) < 2 {
+			continue
+		}
+
+		sort.Strings(paths)
+		groups = append(groups, paths)
+	}
+
+	slices.SortFunc(groups, func(a, b []string) int {
+		return strings.Compare(a[0], b[0])
+	})
+
+	for _, paths := range groups {
+		for _, path := range paths {
+			db.output.Println(path)
+		}
+
+		db.output.Println()
+	}
+
+	db.output.Printf("Case collisions: %d\n", len(groups))
+}
+
+// rootOf returns the most specific scan root containing the path, empty if it's not under any of them
+func (db *DB) rootOf(path string) string {
+	found := ""
+
+	for root := range db.LastScans {
+		if len(root) > len(found) && isUnderRoot(path, root) {
+			found = root
+		}
+	}
+
+	return found
+}
+
+// Roots prints the roots the catalogued files were found under with their file counts and total sizes. Files without
+// a known root are counted under their top-level directory, marked as derived.
+func (db *DB) Roots() {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if len(db.Files) == 0 {
+		db.output.Println("No files catalogued")
+
+		return
+	}
+
+	type rootStats struct {
+		files   int
+		bytes   int64
+		derived bool
+	}
+
+	stats := make(map[string]rootStats)
+	for _, record := range db.Files {
+		root, derived := record.Root, false
+		if root == "" {
+			root, derived = topLevelDir(record.Path), true
+		}
+
+		current := stats[root]
+		current.files++
+		current.bytes += int64(record.Size)
+		current.derived = current.derived || derived
+		stats[root] = current
+	}
+
+	for _, root := range slices.Sorted(maps.Keys(stats)) {
+		line := fmt.Sprintf("%s: %s files, %s", root, formatCount(stats[root].files), formatBytes(stats[root].bytes))
+		if stats[root].derived {
+			line += " (derived)"
+		}
+
+		db.output.Println(line)
+	}
+}
+
+// topLevelDir returns the first directory of a path, e.g. /data for /data/photos/foo.jpg or . for a file name only.
+func topLevelDir(path string) string {
+	// Archive entries belong to the directory of their archive
+	path, _, _ = splitArchiveEntry(path)
+
+	volume := filepath.VolumeName(path)
+	rest := strings.TrimLeft(path[len(volume):], string(filepath.Separator))
+	prefix := path[:len(path)-len(rest)]
+
+	first, _, found := strings.Cut(rest, string(filepath.Separator))
+	if !found {
+		return cmp.Or(prefix, ".")
+	}
+
+	return prefix + first
+}
+
+// isUnderRoot reports whether a path is the root itself or inside of it. Unlike a plain prefix check, /data2/foo.txt
+// is not considered to be inside /data.
+func isUnderRoot(path, root string) bool {
+	root = filepath.Clean(root)
+
+	if root == "." {
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+	}
+
+	if path == root {
+		return true
+	}
+
+	if strings.HasSuffix(root, string(filepath.Separator)) {
+		return strings.HasPrefix(path, root)
+	}
+
+	return strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+// isHiddenUnderRoot reports whether a path inside of a root is hidden, or inside of a hidden directory, the way the
+// scan skips them. The root itself is never considered hidden.
+func isHiddenUnderRoot(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+
+	return slices.ContainsFunc(strings.Split(rel, string(filepath.Separator)), func(part string) bool {
+		return strings.HasPrefix(part, ".") && part != ".."
+	})
+}
+
+// isRecordUnderRoot reports whether a record belongs to the root by the scan root it was found under. The path is only
+// checked if the scan root is unknown or the root is a directory inside of the scan root.
+func isRecordUnderRoot(record Record, root string) bool {
+	if record.Root == "" {
+		return isUnderRoot(record.Path, root)
+	}
+
+	recordRoot := filepath.Clean(record.Root)
+	if isUnderRoot(recordRoot, root) {
+		return true
+	}
+
+	return isUnderRoot(root, recordRoot) && isUnderRoot(record.Path, root)
+}
+
+// TreeReport prints the total size of catalogued files per directory, largest directories first.
+// Sizes are aggregated from the catalog only, so the report works for offline drives as well.
+func (db *DB) TreeReport(depth int) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	dirSizes := make(map[string]int64)
+	for _, record := range db.Files {
+		dir := filepath.Dir(record.Path)
+		for {
+			dirSizes[dir] += int64(record.Size)
+
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+
+			dir = parent
+		}
+	}
+
+	dirs := make([]string, 0, len(dirSizes))
+	for dir := range dirSizes {
+		if depth > 0 && pathDepth(dir) > depth {
+			continue
+		}
+
+		dirs = append(dirs, dir)
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirSizes[dirs[i]] != dirSizes[dirs[j]] {
+			return dirSizes[dirs[i]] > dirSizes[dirs[j]]
+		}
+
+		return dirs[i] < dirs[j]
+	})
+
+	if len(dirs) > maxLines {
+		dirs = dirs[:maxLines]
+	}
+
+	for _, dir := range dirs {
+		db.output.Printf("%10s  %s\n", formatBytes(dirSizes[dir]), dir)
+	}
+}
+
+// pathDepth returns the number of elements in a directory path, e.g. "/home/user" -> 2, "." -> 0.
+func pathDepth(dir string) int {
+	depth := 0
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(dir)), "/") {
+		if part != "" && part != "." {
+			depth++
+		}
+	}
+
+	return depth
+}
+
+// PartialDuplicates reports files whose content is a prefix of a larger file, e.g. interrupted downloads.
+// Hashes are calculated from the first MB of files, so files of at least one MB sharing a hash but having different
+// sizes are candidates. Candidates are verified by comparing their content before reporting.
+func (db *DB) PartialDuplicates() {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	hashes := make([]string, 0, len(db.Hashes))
+	for hash, ids := range db.Hashes {
+		if len(ids) < 2 {
+			continue
+		}
+
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	found := 0
+	for _, hash := range hashes {
+		records := make([]Record, 0, len(db.Hashes[hash]))
+		for _, id := range db.Hashes[hash] {
+			// Only head samples show that files start with the same content
+			if record, ok := db.Files[id]; ok && record.Size >= MB && record.SamplePosition == "" {
+				records = append(records, record)
+			}
+		}
+
+		sort.Slice(records, func(i, j int) bool {
+			if records[i].Size != records[j].Size {
+				return records[i].Size < records[j].Size
+			}
+
+			return records[i].Path < records[j].Path
+		})
+
+		for i, smaller := range records {
+			for _, larger := range records[i+1:] {
+				if larger.Size == smaller.Size {
+					continue
+				}
+
+				isPrefix, err := isFilePrefix(smaller.Path, larger.Path)
+				if err != nil {
+					db.output.Errorf(errCodeReadFile, "%v\n", err)
+
+					continue
+				}
+
+				if !isPrefix {
+					continue
+				}
+
+				found++
+
+				db.output.Printf("Partial duplicate: %s is a prefix of %s (%s of %s)\n", smaller.Path, larger.Path, formatBytes(int64(smaller.Size)), formatBytes(int64(larger.Size)))
+			}
+		}
+	}
+
+	db.output.Printf("Partial duplicates found: %d\n", found)
+}
+
+// isSameContent checks whether two files have exactly the same content, comparing them byte by byte.
+func isSameContent(path, otherPath string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("can't stat file: %s, err: %w", path, err)
+	}
+
+	otherInfo, err := os.Stat(otherPath)
+	if err != nil {
+		return false, fmt.Errorf("can't stat file: %s, err: %w", otherPath, err)
+	}
+
+	if info.Size() != otherInfo.Size() {
+		return false, nil
+	}
+
+	return isFilePrefix(path, otherPath)
+}
+
+// isFilePrefix checks whether the full content of the file at prefixPath is the beginning of the file at path.
+func isFilePrefix(prefixPath, path string) (bool, error) {
+	prefixFile, err := os.Open(prefixPath)
+	if err != nil {
+		return false, fmt.Errorf("can't open file: %s, err: %w", prefixPath, err)
+	}
+	defer prefixFile.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("can't open file: %s, err: %w", path, err)
+	}
+	defer file.Close()
+
+	const chunkSize = 64 * 1024
+
+	prefixChunk := make([]byte, chunkSize)
+	chunk := make([]byte, chunkSize)
+
+	for {
+		n, err := io.ReadFull(prefixFile, prefixChunk)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return false, fmt.Errorf("can't read file: %s, err: %w", prefixPath, err)
+		}
+
+		if n == 0 {
+			return true, nil
+		}
+
+		m, err := io.ReadFull(file, chunk[:n])
+		if err != nil || m != n {
+			return false, nil
+		}
+
+		if !bytes.Equal(prefixChunk[:n], chunk[:n]) {
+			return false, nil
+		}
+	}
+}
+
+func (db *DB) Stats(minLength, topTerms int) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	db.output.Printf("Total records: %d\n", len(db.Files))
+	db.output.Printf("Total unique sizes: %d\n", len(db.Sizes))
+	db.output.Printf("Total unique search terms: %d\n", len(db.SearchTerms))
+	db.output.Printf("Total unique hashes: %d\n", len(db.Hashes))
+
+	db.sizeStats()
+	db.hashStats()
+	db.wasteStats()
+	db.fileSizeStats()
+	db.sparseStats()
+
+	db.searchTermStats(minLength)
+
+	if topTerms > 0 {
+		db.topTermStats(minLength, topTerms)
+	}
+}
+
+// catalogSnapshot is a summary of the catalog at a point in time, stored in the history file.
+type catalogSnapshot struct {
+	Time         time.Time
+	Records      int
+	Bytes        int64
+	UniqueHashes int
+	// Waste is the number of bytes which could be reclaimed by deleting duplicates by size and hash
+	Waste int64
+}
+
+// Snapshot summarizes the catalog.
+func (db *DB) Snapshot(now time.Time) catalogSnapshot {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	current := catalogSnapshot{
+		Time:         now,
+		Records:      len(db.Files),
+		UniqueHashes: len(db.Hashes),
+	}
+
+	current.Bytes, current.Waste = db.reclaimableBytes()
+
+	return current
+}
+
+// reclaimableBytes returns the total catalogued bytes and the bytes which could be reclaimed by keeping only one file
+// of each group of duplicates by size and hash. Sparse files count with the bytes they occupy on disk.
+func (db *DB) reclaimableBytes() (total, reclaimable int64) {
+	for _, record := range db.Files {
+		total += int64(record.diskSize())
+	}
+
+	// Copies of sparse files may occupy different amounts of disk space, the largest one is assumed to be kept
+	for _, group := range db.duplicatesBySizeAndHash(DuplicateOptions{}) {
+		var groupTotal, largest int64
+		for _, id := range group.IDs {
+			size := int64(db.Files[id].diskSize())
+			groupTotal += size
+			largest = max(largest, size)
+		}
+
+		reclaimable += groupTotal - largest
+	}
+
+	return total, reclaimable
+}
+
+func appendSnapshot(historyFile string, current catalogSnapshot) error {
+	file, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open history file %s, err: %w", historyFile, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	err = writer.Write([]string{
+		current.Time.Format(time.RFC3339),
+		strconv.Itoa(current.Records),
+		strconv.FormatInt(current.Bytes, 10),
+		strconv.Itoa(current.UniqueHashes),
+		strconv.FormatInt(current.Waste, 10),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write history file %s, err: %w", historyFile, err)
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// metricsHeader is the header of the metrics CSV file, the columns must only ever be appended to
+var metricsHeader = []string{"timestamp", "totalRecords", "totalBytes", "uniqueHashes", "reclaimableBytes"}
+
+// appendMetrics appends the snapshot as a row to the metrics CSV file, writing the header first if the file is new.
+func appendMetrics(metricsFile string, current catalogSnapshot) error {
+	file, err := os.OpenFile(metricsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open metrics file %s, err: %w", metricsFile, err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat metrics file %s, err: %w", metricsFile, err)
+	}
+
+	writer := csv.NewWriter(file)
+
+	if fileInfo.Size() == 0 {
+		err = writer.Write(metricsHeader)
+		if err != nil {
+			return fmt.Errorf("unable to write metrics file %s, err: %w", metricsFile, err)
+		}
+	}
+
+	err = writer.Write([]string{
+		current.Time.Format(time.RFC3339),
+		strconv.Itoa(current.Records),
+		strconv.FormatInt(current.Bytes, 10),
+		strconv.Itoa(current.UniqueHashes),
+		strconv.FormatInt(current.Waste, 10),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write metrics file %s, err: %w", metricsFile, err)
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// readSnapshots reads the snapshots from the history file. A missing history file means no snapshots were recorded.
+func readSnapshots(historyFile string) ([]catalogSnapshot, error) {
+	records, err := readCsvFile(historyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]catalogSnapshot, 0, len(records))
+	for _, record := range records {
+		if len(record) < 5 {
+			return nil, fmt.Errorf("invalid history row: %v", record)
+		}
+
+		var (
+			snap catalogSnapshot
+			errs [5]error
+		)
+
+		snap.Time, errs[0] = time.Parse(time.RFC3339, record[0])
+		snap.Records, errs[1] = strconv.Atoi(record[1])
+		snap.Bytes, errs[2] = strconv.ParseInt(record[2], 10, 64)
+		snap.UniqueHashes, errs[3] = strconv.Atoi(record[3])
+		snap.Waste, errs[4] = strconv.ParseInt(record[4], 10, 64)
+
+		err = errors.Join(errs[:]...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history row: %v, err: %w", record, err)
+		}
+
+		snapshots = append(snapshots, snap)
+	}
+
+	return snapshots, nil
+}
+
+func printSparklines(output Output, snapshots []catalogSnapshot) {
+	metrics := []struct {
+		name   string
+		value  func(snap catalogSnapshot) int64
+		format func(n int64) string
+	}{
+		{"Files", func(snap catalogSnapshot) int64 { return int64(snap.Records) }, func(n int64) string { return formatCount(int(n)) }},
+		{"Size", func(snap catalogSnapshot) int64 { return snap.Bytes }, formatBytes},
+		{"Hashes", func(snap catalogSnapshot) int64 { return int64(snap.UniqueHashes) }, func(n int64) string { return formatCount(int(n)) }},
+		{"Waste", func(snap catalogSnapshot) int64 { return snap.Waste }, formatBytes},
+	}
+
+	for _, metric := range metrics {
+		values := make([]int64, 0, len(snapshots))
+		for _, snap := range snapshots {
+			values = append(values, metric.value(snap))
+		}
+
+		output.Printf("%-7s %s (%s - %s)\n", metric.name+":", sparkline(values), metric.format(slices.Min(values)), metric.format(slices.Max(values)))
+	}
+}
+
+// sparkline draws the values as bars scaled between their minimum and maximum.
+func sparkline(values []int64) string {
+	bars := []rune(sparklineBars)
+
+	lowest, highest := slices.Min(values), slices.Max(values)
+
+	var sb strings.Builder
+	for _, value := range values {
+		index := 0
+		if highest > lowest {
+			index = int((value - lowest) * int64(len(bars)-1) / (highest - lowest))
+		}
+
+		sb.WriteRune(bars[index])
+	}
+
+	return sb.String()
+}
+
+func (db *DB) sizeStats() {
+	sizesWithMultipleIDs := 0
+
+	for _, ids := range db.Sizes {
+		if len(ids) == 1 {
+			continue
+		}
+
+		sizesWithMultipleIDs++
+	}
+
+	db.output.Printf("Sizes with multiple records: %d\n", sizesWithMultipleIDs)
+}
+
+func (db *DB) hashStats() {
+	hashWithMultipleIDs := 0
+
+	// groupSizes counts the hashes by the number of their records, groups of 4 or more are counted together
+	groupSizes := make(map[int]int)
+
+	for _, ids := range db.Hashes {
+		if len(ids) == 1 {
+			continue
+		}
+
+		hashWithMultipleIDs++
+
+		groupSizes[min(len(ids), 4)]++
+	}
+
+	db.output.Printf("Hashes with multiple records: %d\n", hashWithMultipleIDs)
+
+	if hashWithMultipleIDs == 0 {
+		return
+	}
+
+	db.output.Printf("Hashes with 2 records: %d\n", groupSizes[2])
+	db.output.Printf("Hashes with 3 records: %d\n", groupSizes[3])
+	db.output.Printf("Hashes with 4+ records: %d\n", groupSizes[4])
+}
+
+// wasteStats prints the share of the catalogued bytes occupied by duplicates by size and hash
+func (db *DB) wasteStats() {
+	total, reclaimable := db.reclaimableBytes()
+	if total == 0 {
+		return
+	}
+
+	db.output.Printf("Duplicates occupy %.1f%% of catalogued bytes (%s of %s)\n", float64(reclaimable)*100/float64(total), formatBytes(reclaimable), formatBytes(total))
+}
+
+// fileSizeStats prints the mean and median file size. The median is found by walking the unique sizes in order and
+// counting their files, so that the sizes of all files don't have to be sorted.
+func (db *DB) fileSizeStats() {
+	if len(db.Files) == 0 {
+		return
+	}
+
+	var total int64
+	for _, record := range db.Files {
+		total += int64(record.Size)
+	}
+
+	db.output.Printf("Average file size: %s\n", formatBytes(total/int64(len(db.Files))))
+	db.output.Printf("Median file size: %s\n", formatBytes(db.medianSize()))
+}
+
+// sparseStats prints the logical and the physical size of the sparse files, if any were catalogued.
+func (db *DB) sparseStats() {
+	var count, logical, physical int64
+	for _, record := range db.Files {
+		if !record.Sparse {
+			continue
+		}
+
+		count++
+		logical += int64(record.Size)
+		physical += int64(record.DiskSize)
+	}
+
+	if count == 0 {
+		return
+	}
+
+	db.output.Printf("Sparse files: %d (%s logical, %s on disk)\n", count, formatBytes(logical), formatBytes(physical))
+}
+
+// medianSize returns the median of the file sizes, the mean of the two middle ones for an even number of files.
+func (db *DB) medianSize() int64 {
+	sizes := slices.Sorted(maps.Keys(db.Sizes))
+
+	// The positions of the middle files, equal for an odd number of files
+	lower, upper := (len(db.Files)-1)/2, len(db.Files)/2
+
+	var lowerSize, upperSize int64
+
+	seen := 0
+	for _, size := range sizes {
+		count := len(db.Sizes[size])
+		if seen <= lower && lower < seen+count {
+			lowerSize = int64(size)
+		}
+
+		if seen <= upper && upper < seen+count {
+			upperSize = int64(size)
+
+			break
+		}
+
+		seen += count
+	}
+
+	return (lowerSize + upperSize) / 2
+}
+
+func (db *DB) searchTermStats(minLength int) {
+	searchTermStats := make(map[int]int)
+	for searchTerm, ids := range db.SearchTerms {
+		if len(ids) < 2 {
+			continue
+		}
+
+		if len(searchTerm) < minLength {
+			continue
+		}
+
+		key := len(searchTerm) / 5
+
+		searchTermStats[key] += 1
+	}
+
+	// sort searchTerms by keys
+	keys := make([]int, 0, len(searchTermStats))
+	for k := range searchTermStats {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	db.output.Println()
+	db.output.Printf("Search term length distribution:\n")
+	for _, length := range keys {
+		db.output.Printf("Search terms with length %d: %d\n", length*5, searchTermStats[length])
+	}
+}
+
+// topTermStats lists the search terms shared by the most files, the most frequent first
+func (db *DB) topTermStats(minLength, limit int) {
+	terms := make([]string, 0, len(db.SearchTerms))
+	for searchTerm := range db.SearchTerms {
+		if len(searchTerm) < minLength {
+			continue
+		}
+
+		terms = append(terms, searchTerm)
+	}
+
+	slices.SortFunc(terms, func(a, b string) int {
+		if c := cmp.Compare(len(db.SearchTerms[b]), len(db.SearchTerms[a])); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	db.output.Println()
+	db.output.Printf("Top search terms:\n")
+	for _, searchTerm := range terms[:min(limit, len(terms))] {
+		db.output.Printf("%s: %d\n", searchTerm, len(db.SearchTerms[searchTerm]))
+	}
+}
+
+// Duplicates reviews, reports, moves or deletes the duplicates and reports whether the catalog changed.
+func (db *DB) Duplicates(options DuplicateOptions) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	hashed := 0
+	if options.HashMissing {
+		hashed = db.hashSameSizeFiles(options.HashAlgo)
+	}
+
+	return db.duplicates(options) || hashed > 0
+}
+
+// hashSameSizeFiles hashes the files stored without a hash of the algorithm, if other files have the same size, as
+// only those can have duplicates by content. The hashes are stored, the number of files hashed is returned.
+func (db *DB) hashSameSizeFiles(algo string) int {
+	hashed, failed := 0, 0
+
+	for _, size := range slices.Sorted(maps.Keys(db.Sizes)) {
+		if len(db.Sizes[size]) < 2 {
+			continue
+		}
+
+		for _, id := range slices.Clone(db.Sizes[size]) {
+			record := db.Files[id]
+
+			// Archive entries can't be hashed without extracting them
+			if record.hash(algo) != "" || isArchiveEntry(record.Path) {
+				continue
+			}
+
+			hash, _, err := db.hashSample(record.Path, int64(record.Size), ScanOptions{HashAlgo: algo, SamplePosition: record.SamplePosition})
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "%v\n", err)
+				failed++
+
+				continue
+			}
+
+			db.remove(id)
+
+			record.setHash(algo, hash)
+
+			err = db.add(record)
+			if err != nil {
+				db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", record.Path, err)
+				failed++
+
+				continue
+			}
+
+			hashed++
+		}
+	}
+
+	if hashed > 0 || failed > 0 {
+		db.output.Printf("Hashed %d files of the same size as others, %d failed\n", hashed, failed)
+	}
+
+	return hashed
+}
+
+func (db *DB) duplicates(options DuplicateOptions) bool {
+	var finders []func(options DuplicateOptions) map[string]SearchGroup
+
+	switch options.Mode {
+	case duplicateModeExactName:
+		finders = append(finders, db.duplicatesByExactName)
+	case duplicateModeStem:
+		finders = append(finders, db.duplicatesByStem)
+	case duplicateModeStat:
+		finders = append(finders, db.duplicatesByStat)
+	default:
+		finders = append(finders, db.duplicatesBySizeAndHash, db.duplicatesBySearchTerm)
+	}
+
+	if len(options.Extensions) > 0 {
+		for i, find := range finders {
+			finders[i] = db.filterByExtension(find)
+		}
+	}
+
+	// The count would break the machine-readable reports
+	isReport := options.ReportFormat == formatCSV || options.ReportFormat == formatTSV
+	if !options.IncludeEmpty && !isReport && (options.Mode == "" || options.Mode == duplicateModeDefault) {
+		if count := len(db.Sizes[0]); count >= minGroupSize(options) {
+			db.output.Printf("%d empty files (use `%s` command)\n", count, empty)
+		}
+	}
+
+	if !isReport && (options.Mode == "" || options.Mode == duplicateModeDefault) {
+		if count := db.canonicalGroups(options); count > 0 {
+			db.output.Printf("%d groups with a canonical copy skipped (use `%s --%s` to review them)\n", count, canonical, flagUnset)
+		}
+	}
+
+	if options.SummaryOnly {
+		db.printDuplicateSummary(finders, options)
+
+		return false
+	}
+
+	// Only files with matching content are wasted space, groups by search terms may contain different files
+	if options.ByType {
+		db.printDuplicatesByType(finders[0](options))
+
+		return false
+	}
+
+	if isReport {
+		db.printDuplicateGroupsReport(finders, options)
+
+		return false
+	}
+
+	// Only files with matching content are moved, groups by search terms may contain different files
+	if options.MoveTo != "" {
+		return db.moveDuplicates(finders[0](options), options.MoveTo, time.Now()) > 0
+	}
+
+	// The roots are collected before deleting, so that the roots of the deleted files are protected as well
+	var protected map[string]struct{}
+	if options.DeleteEmptyDirs {
+		protected = db.protectedDirs()
+	}
+
+	var deleted []ID
+
+	// kept maps the files selected for deletion by a plan to the copy kept of their group
+	kept := make(map[ID]ID)
+	if options.Auto {
+		// Only files with matching content are resolved automatically, groups by search terms may contain different files
+		deleted = db.resolveByKeepPattern(finders[0](options), options, kept)
+	} else {
+		for _, find := range finders {
+			deleted = append(deleted, db.handleDuplicateGroups(find(options), options, kept)...)
+		}
+	}
+
+	if options.Plan != "" {
+		err := db.writePlan(options.Plan, deleted, kept)
+		if err != nil {
+			db.output.Errorf(errCodeWriteFile, "Error writing plan: %v\n", err)
+			db.output.Exit(1)
+		}
+
+		return false
+	}
+
+	if options.DeleteEmptyDirs {
+		db.deleteEmptyDirs(deleted, protected)
+	}
+
+	return len(deleted) > 0
+}
+
+// moveDuplicates keeps the first file of each group and moves the others into a folder of the target directory named
+// after the current date, preserving their paths relative to their scan roots. The records are updated to the new
+// paths. Files which would overwrite an existing file are not moved. The number of files moved is returned.
+func (db *DB) moveDuplicates(groups map[string]SearchGroup, targetDir string, now time.Time) int {
+	dateDir := filepath.Join(targetDir, now.Format(time.DateOnly))
+
+	// The moved files would otherwise be catalogued again by scans covering the target directory
+	err := db.recordArtifact(targetDir)
+	if err != nil {
+		db.output.Errorf(errCodeWriteDB, "Unable to record the target directory: %v\n", err)
+	}
+
+	moved := 0
+	for _, key := range db.groupKeysBySize(groups) {
+		for _, id := range groups[key].IDs[1:] {
+			record := db.Files[id]
+
+			// Archive entries can't be moved without rewriting the archive
+			if isArchiveEntry(record.Path) {
+				continue
+			}
+
+			target := filepath.Join(dateDir, relativeToRoot(record.Path, record.Root))
+
+			if _, err := os.Lstat(target); err == nil {
+				db.output.Errorf(errCodeMoveFile, "Unable to move file: %s, err: %s already exists\n", record.Path, target)
+
+				continue
+			}
+
+			err := os.MkdirAll(filepath.Dir(target), 0o755)
+			if err == nil {
+				err = os.Rename(record.Path, target)
+			}
+
+			if err != nil {
+				db.output.Errorf(errCodeDeleteFile, "Unable to move file: %s, err: %v\n", record.Path, err)
+
+				continue
+			}
+
+			db.output.Printf("Moved %s to %s\n", record.Path, target)
+
+			db.remove(id)
+
+			record.Path = target
+			record.SearchTerms = db.searchTerms(target)
+			record.Root = db.rootOf(target)
+
+			err = db.add(record)
+			if err != nil {
+				db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", target, err)
+			}
+
+			moved++
+		}
+	}
+
+	db.output.Printf("Moved %d duplicates to %s\n", moved, dateDir)
+
+	return moved
+}
+
+// relativeToRoot returns the path relative to its scan root, or without its volume and leading separators if the root
+// is unknown.
+func relativeToRoot(path, root string) string {
+	if root != "" && isUnderRoot(path, root) {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			return rel
+		}
+	}
+
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+
+	return strings.TrimLeft(path, string(filepath.Separator))
+}
+
+// protectedDirs returns the directories which must not be removed even if they became empty: the scan roots, the roots
+// of the catalogued files and their top-level directories.
+func (db *DB) protectedDirs() map[string]struct{} {
+	protected := make(map[string]struct{})
+	for root := range db.LastScans {
+		protected[filepath.Clean(root)] = struct{}{}
+	}
+
+	for _, record := range db.Files {
+		if record.Root != "" {
+			protected[filepath.Clean(record.Root)] = struct{}{}
+		}
+
+		protected[filepath.Clean(topLevelDir(record.Path))] = struct{}{}
+	}
+
+	return protected
+}
+
+// deleteEmptyDirs removes the directories of the deleted files if they became empty, then their parents bottom-up.
+// Protected directories are never removed and parents are only removed inside scan roots, so without any roots scanned
+// only the directories which contained the deleted files are removed.
+func (db *DB) deleteEmptyDirs(deleted []ID, protected map[string]struct{}) {
+	dirs := make(map[string]struct{})
+	for _, id := range deleted {
+		dirs[filepath.Dir(string(id))] = struct{}{}
+	}
+
+	isRoot := func(dir string) bool {
+		_, ok := protected[dir]
+
+		return ok
+	}
+
+	isInsideRoot := func(dir string) bool {
+		for root := range db.LastScans {
+			if isUnderRoot(dir, root) && filepath.Clean(root) != dir {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// Deeper directories come first, so that parents are checked after their children
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if pathDepth(sorted[i]) != pathDepth(sorted[j]) {
+			return pathDepth(sorted[i]) > pathDepth(sorted[j])
+		}
+
+		return sorted[i] < sorted[j]
+	})
+
+	for _, dir := range sorted {
+		for !isRoot(dir) {
+			entries, err := os.ReadDir(dir)
+			if err != nil || len(entries) > 0 {
+				break
+			}
+
+			err = os.Remove(dir)
+			if err != nil {
+				db.output.Errorf(errCodeDeleteFile, "Unable to remove empty directory: %s, err: %v\n", dir, err)
+
+				break
+			}
+
+			db.output.Printf("Removed empty directory: %s\n", dir)
+
+			parent := filepath.Dir(dir)
+			if parent == dir || !isInsideRoot(parent) {
+				break
+			}
+
+			dir = parent
+		}
+	}
+}
+
+// filterByExtension wraps a finder, so that only files with the extensions selected are kept in the groups.
+func (db *DB) filterByExtension(find func(options DuplicateOptions) map[string]SearchGroup) func(options DuplicateOptions) map[string]SearchGroup {
+	return func(options DuplicateOptions) map[string]SearchGroup {
+		extensions := make(map[string]struct{}, len(options.Extensions))
+		for _, ext := range options.Extensions {
+			extensions[strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")] = struct{}{}
+		}
+
+		groups := find(options)
+		for key, group := range groups {
+			group.IDs = slices.DeleteFunc(slices.Clone(group.IDs), func(id ID) bool {
+				_, ok := extensions[pathToExtension(db.Files[id].Path)]
+
+				return !ok
+			})
+
+			if len(group.IDs) < minGroupSize(options) {
+				delete(groups, key)
+
+				continue
+			}
+
+			groups[key] = group
+		}
+
+		return groups
+	}
 }
 
-func (out *StdOut) Scanln(a *string) error {
-	_, err := fmt.Scanln(&a)
-	if err != nil {
-		return fmt.Errorf("error scanning input: %w", err)
+// largestOfGroup returns the file kept when calculating the reclaimable bytes of a group, the first of the largest ones
+func (db *DB) largestOfGroup(group SearchGroup) ID {
+	kept := group.IDs[0]
+	for _, id := range group.IDs[1:] {
+		if db.Files[id].Size > db.Files[kept].Size {
+			kept = id
+		}
 	}
 
-	return nil
+	return kept
 }
 
-func (out *StdOut) Exit(code int) {
-	os.Exit(code)
+// printDuplicatesByType prints the reclaimable bytes and files of the groups per file extension, the largest first.
+// The files of a group other than the kept one are counted by their own extensions.
+func (db *DB) printDuplicatesByType(groups map[string]SearchGroup) {
+	bytesByExt := make(map[string]int64)
+	filesByExt := make(map[string]int)
+
+	for _, group := range groups {
+		kept := db.largestOfGroup(group)
+		for _, id := range group.IDs {
+			if id == kept {
+				continue
+			}
+
+			ext := pathToExtension(db.Files[id].Path)
+			bytesByExt[ext] += int64(db.Files[id].Size)
+			filesByExt[ext]++
+		}
+	}
+
+	if len(bytesByExt) == 0 {
+		db.output.Println("No duplicates found")
+
+		return
+	}
+
+	exts := slices.Collect(maps.Keys(bytesByExt))
+	slices.SortFunc(exts, func(a, b string) int {
+		if bytesByExt[a] != bytesByExt[b] {
+			return cmp.Compare(bytesByExt[b], bytesByExt[a])
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	for _, ext := range exts {
+		name := ext
+		if name == "" {
+			name = "(no extension)"
+		}
+
+		db.output.Printf("%s: %s reclaimable in %d files\n", name, formatBytes(bytesByExt[ext]), filesByExt[ext])
+	}
 }
 
-func NewStdOut() *StdOut {
-	return &StdOut{}
+// printDuplicateSummary prints the number of groups, files and reclaimable bytes per duplicate type. Reclaimable bytes
+// are the bytes freed by keeping only the largest file of each group.
+func (db *DB) printDuplicateSummary(finders []func(options DuplicateOptions) map[string]SearchGroup, options DuplicateOptions) {
+	found := false
+
+	for _, find := range finders {
+		groups := find(options)
+
+		var searchType SearchType
+
+		files := 0
+		reclaimable := int64(0)
+		for _, group := range groups {
+			searchType = group.Type
+			files += len(group.IDs)
+
+			kept := db.largestOfGroup(group)
+			for _, id := range group.IDs {
+				if id != kept {
+					reclaimable += int64(db.Files[id].Size)
+				}
+			}
+		}
+
+		if searchType == "" {
+			continue
+		}
+
+		found = true
+
+		// Files grouped by their names may differ in content, deleting them would not only reclaim space
+		if searchType != SizeAndHash {
+			db.output.Printf("%s: %d groups, %d files\n", searchType, len(groups), files)
+
+			continue
+		}
+
+		db.output.Printf("%s: %d groups, %d files, %s reclaimable\n", searchType, len(groups), files, formatBytes(reclaimable))
+	}
+
+	if !found {
+		db.output.Println("No duplicates found")
+	}
 }
 
-type Record struct {
-	Path        string
-	Size        int
-	Hash        string
+// printDuplicateGroupsReport prints all duplicate groups as CSV or TSV with a header row, without any prompting.
+func (db *DB) printDuplicateGroupsReport(finders []func(options DuplicateOptions) map[string]SearchGroup, options DuplicateOptions) {
+	rows := [][]string{{"group", "type", "path", "size", "hash"}}
+
+	groupNum := 0
+	for _, find := range finders {
+		groups := find(options)
+
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			groupNum++
+
+			ids := slices.Clone(groups[key].IDs)
+			slices.Sort(ids)
+
+			for _, id := range ids {
+				record := db.Files[id]
+
+				rows = append(rows, []string{strconv.Itoa(groupNum), string(groups[key].Type), record.Path, strconv.Itoa(record.Size), record.hash(options.HashAlgo)})
+			}
+		}
+	}
+
+	if options.ReportFormat == formatTSV {
+		db.printTSVRows(rows)
+
+		return
+	}
+
+	db.printCSVRows(rows)
+}
+
+type SearchType string
+
+const (
+	SizeAndHash SearchType = "Size and hash"
+	SearchTerm  SearchType = "Search term"
+	ExactName   SearchType = "Exact name"
+	Stem        SearchType = "Name without extension and size"
+	Stat        SearchType = "Name, size and modification time"
+)
+
+type SearchGroup struct {
+	IDs         []ID
 	SearchTerms []string
+	Type        SearchType
 }
 
-type ID string
+func (db *DB) duplicatesBySizeAndHash(options DuplicateOptions) map[string]SearchGroup {
+	groups := make(map[string]SearchGroup)
 
-type DB struct {
-	mutex       *sync.RWMutex
-	Files       map[ID]Record
-	Sizes       map[int][]ID
-	Hashes      map[string][]ID
-	SearchTerms map[string][]ID
-	output      Output
-	dbFile      string
-	ids         []ID
+	index := db.Hashes
+	if options.HashAlgo != "" && options.HashAlgo != hashAlgoMD5 {
+		index = db.AlgoHashes[options.HashAlgo]
+	}
+
+	for hash, ids := range index {
+		// Empty files all share the same hash, grouping them would only produce one huge group of unrelated files
+		if !options.IncludeEmpty {
+			ids = slices.DeleteFunc(slices.Clone(ids), func(id ID) bool {
+				return db.Files[id].Size == 0
+			})
+		}
+
+		if len(ids) < minGroupSize(options) {
+			continue
+		}
+
+		// The duplicates of a canonical copy were already resolved by choosing the copy to keep
+		if db.hasCanonical(ids) {
+			continue
+		}
+
+		// Hashes of samples taken from different positions are not comparable
+		positions := make(map[string][]ID)
+		for _, id := range ids {
+			position := db.Files[id].SamplePosition
+			positions[position] = append(positions[position], id)
+		}
+
+		for position, positionIDs := range positions {
+			for _, sizeIDs := range db.clusterBySize(positionIDs, options) {
+				if len(sizeIDs) < minGroupSize(options) {
+					continue
+				}
+
+				groupID := fmt.Sprintf("%s-%d-%s", hash, db.Files[sizeIDs[0]].Size, position)
+
+				slices.Sort(sizeIDs)
+
+				groups[groupID] = SearchGroup{
+					IDs:         sizeIDs,
+					SearchTerms: []string{},
+					Type:        SizeAndHash,
+				}
+			}
+		}
+	}
+
+	return groups
 }
 
-func NewDB(output Output, dbFile string) *DB {
-	return &DB{
-		mutex:       &sync.RWMutex{},
-		Files:       make(map[ID]Record),
-		Sizes:       make(map[int][]ID),
-		Hashes:      make(map[string][]ID),
-		SearchTerms: make(map[string][]ID),
-		output:      output,
-		dbFile:      dbFile,
+// canonicalGroups counts the hashes shared by multiple files, one of which is marked as the canonical copy.
+func (db *DB) canonicalGroups(options DuplicateOptions) int {
+	count := 0
+
+	for _, ids := range db.Hashes {
+		if len(ids) >= minGroupSize(options) && db.hasCanonical(ids) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// hasCanonical tells whether any of the files is marked as the canonical copy of its hash.
+func (db *DB) hasCanonical(ids []ID) bool {
+	return slices.ContainsFunc(ids, func(id ID) bool {
+		return db.Files[id].Canonical
+	})
+}
+
+// clusterBySize splits the files into clusters of similar sizes. A file joins the current cluster if its size exceeds
+// the smallest size of the cluster by at most the size tolerance, so without a tolerance only equal sizes are grouped.
+// The first file of each cluster is the smallest one.
+func (db *DB) clusterBySize(ids []ID, options DuplicateOptions) [][]ID {
+	sorted := slices.Clone(ids)
+	slices.SortFunc(sorted, func(a, b ID) int {
+		return cmp.Or(cmp.Compare(db.Files[a].Size, db.Files[b].Size), strings.Compare(string(a), string(b)))
+	})
+
+	var clusters [][]ID
+	for _, id := range sorted {
+		if len(clusters) > 0 {
+			cluster := clusters[len(clusters)-1]
+			smallest := db.Files[cluster[0]].Size
+
+			if int64(db.Files[id].Size-smallest) <= sizeTolerance(smallest, options) {
+				clusters[len(clusters)-1] = append(cluster, id)
+
+				continue
+			}
+		}
+
+		clusters = append(clusters, []ID{id})
+	}
+
+	return clusters
+}
+
+// minGroupSize returns the number of files a group needs to be reported, at least two.
+func minGroupSize(options DuplicateOptions) int {
+	return max(2, options.MinGroupSize)
+}
+
+// sizeTolerance returns the size difference allowed for files of the given size, the larger of the absolute and the
+// relative tolerance.
+func sizeTolerance(size int, options DuplicateOptions) int64 {
+	return max(options.SizeTolerance, int64(float64(size)*options.SizeTolerancePct/100))
+}
+
+// parseSizeTolerance parses a size tolerance given either in bytes (e.g. 16B or 1KB) or in percent (e.g. 0.1%).
+func parseSizeTolerance(raw string) (int64, float64, error) {
+	raw = strings.TrimSpace(raw)
+
+	if percent, found := strings.CutSuffix(raw, "%"); found {
+		value, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || value < 0 {
+			return 0, 0, fmt.Errorf("invalid size tolerance: '%s'", raw)
+		}
+
+		return 0, value, nil
+	}
+
+	value, err := parseByteSize(raw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid size tolerance: '%s', err: %w", raw, err)
+	}
+
+	return value, 0, nil
+}
+
+func (db *DB) duplicatesBySearchTerm(options DuplicateOptions) map[string]SearchGroup {
+	groups := make(map[string]SearchGroup)
+
+	for term, ids := range db.SearchTerms {
+		if len(ids) < minGroupSize(options) {
+			continue
+		}
+
+		if len(term) < options.SearchMinLength {
+			continue
+		}
+
+		groups[term] = SearchGroup{
+			IDs:         ids,
+			SearchTerms: []string{term},
+			Type:        SearchTerm,
+		}
+	}
+
+	return groups
+}
+
+func (db *DB) duplicatesByExactName(options DuplicateOptions) map[string]SearchGroup {
+	groups := make(map[string]SearchGroup)
+
+	for id, record := range db.Files {
+		name := filepath.Base(record.Path)
+		if options.IgnoreCase {
+			name = strings.ToLower(name)
+		}
+
+		group := groups[name]
+		group.IDs = append(group.IDs, id)
+		group.SearchTerms = []string{strings.ToLower(name)}
+		group.Type = ExactName
+		groups[name] = group
+	}
+
+	for name, group := range groups {
+		if len(group.IDs) < minGroupSize(options) {
+			delete(groups, name)
+		}
+	}
+
+	return groups
+}
+
+// duplicatesByStem groups files of the same size whose names only differ in their extension,
+// e.g. photo.jpg and photo.jpeg or notes.txt and notes.bak.
+func (db *DB) duplicatesByStem(options DuplicateOptions) map[string]SearchGroup {
+	groups := make(map[string]SearchGroup)
+
+	for id, record := range db.Files {
+		name := filepath.Base(record.Path)
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		if options.IgnoreCase {
+			stem = strings.ToLower(stem)
+		}
+
+		key := fmt.Sprintf("%s-%d", stem, record.Size)
+
+		group := groups[key]
+		group.IDs = append(group.IDs, id)
+		group.SearchTerms = []string{strings.ToLower(stem)}
+		group.Type = Stem
+		groups[key] = group
+	}
+
+	for key, group := range groups {
+		if len(group.IDs) < minGroupSize(options) {
+			delete(groups, key)
+		}
+	}
+
+	return groups
+}
+
+// duplicatesByStat groups files by their name, size and modification time, which are all known without reading the
+// files. It's less accurate than comparing hashes, but works for catalogs scanned without hashing. Files without a
+// known modification time are not grouped.
+func (db *DB) duplicatesByStat(options DuplicateOptions) map[string]SearchGroup {
+	groups := make(map[string]SearchGroup)
+
+	for id, record := range db.Files {
+		if record.ModTime.IsZero() {
+			continue
+		}
+
+		name := filepath.Base(record.Path)
+		if options.IgnoreCase {
+			name = strings.ToLower(name)
+		}
+
+		key := fmt.Sprintf("%s-%d-%d", name, record.Size, record.ModTime.Unix())
+
+		group := groups[key]
+		group.IDs = append(group.IDs, id)
+		group.SearchTerms = []string{strings.ToLower(name)}
+		group.Type = Stat
+		groups[key] = group
+	}
+
+	for key, group := range groups {
+		if len(group.IDs) < minGroupSize(options) {
+			delete(groups, key)
+
+			continue
+		}
+
+		slices.Sort(group.IDs)
+	}
+
+	return groups
+}
+
+// printPreviews prints the beginning of each listed file, numbered the same way as PrintIDs numbers them.
+func (db *DB) printPreviews(ids []ID, lines int) {
+	if len(ids) > maxLines {
+		ids = ids[:maxLines]
+	}
+
+	for i, id := range ids {
+		record := db.Files[id]
+
+		db.output.Printf("Preview of [%d] %s:\n", i+1, record.Path)
+
+		if record.Size > maxPreviewSize {
+			db.output.Printf("  (skipped, file is larger than %d MB)\n", maxPreviewSize/MB)
+
+			continue
+		}
+
+		data, err := readHead(record.Path, previewReadSize)
+		if err != nil {
+			db.output.Printf("  (skipped, err: %v)\n", err)
+
+			continue
+		}
+
+		for _, line := range previewLines(data, lines) {
+			db.output.Printf("  | %s\n", line)
+		}
 	}
 }
 
-func (db *DB) Load() {
-	db.mutex.Lock()
-	defer db.mutex.Unlock()
-
-	records, err := readCsvFile(db.dbFile)
-	if err != nil {
-		db.output.Printf("Unable to read DB file '%s', error: %v", db.dbFile, err)
+// previewLines returns the first lines of text content or a hex dump of the beginning of binary content.
+func previewLines(data []byte, lines int) []string {
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		if len(data) > previewHexSize {
+			data = data[:previewHexSize]
+		}
 
-		db.output.Exit(1)
+		return strings.Split(strings.TrimSuffix(hex.Dump(data), "\n"), "\n")
 	}
 
-	for _, record := range records {
-		db.handleRecord(record)
+	result := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(result) > lines {
+		result = result[:lines]
 	}
+
+	return result
 }
 
-func readCsvFile(filePath string) ([][]string, error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read input file '%s', err: %w", filePath, err)
-	}
-	defer f.Close()
+// handleDuplicateGroups prompts for deleting files of each group and returns the files deleted, or the files selected
+// for deletion when a plan is made.
+func (db *DB) handleDuplicateGroups(searchGroups map[string]SearchGroup, options DuplicateOptions, kept map[ID]ID) []ID {
+	var deleted []ID
 
-	csvReader := csv.NewReader(f)
-	records, err := csvReader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse file as CSV for '%s', err: %w", filePath, err)
-	}
+	input := ""
+	iter := 1
 
-	return records, nil
-}
+	for _, key := range db.groupKeysBySize(searchGroups) {
+		group := searchGroups[key]
 
-func (db *DB) handleRecord(record []string) {
-	filePath := record[0]
+		db.output.Printf("Duplicates found: %d (%d / %d) - %s\n", len(group.IDs), iter, len(searchGroups), group.Type)
 
-	filePath = strings.TrimSpace(filePath)
+		iter++
 
-	if len(filePath) == 0 {
-		return
-	}
+		// Only the displayed subset of the group can be selected for deletion, so that numbering stays consistent
+		displayed := group.IDs
+		slices.Sort(displayed)
+		if options.LimitPerGroup > 0 && len(displayed) > options.LimitPerGroup {
+			displayed = displayed[:options.LimitPerGroup]
+		}
 
-	size, err := strconv.Atoi(record[1])
-	if err != nil {
-		db.output.Println("Unable to parse size from record. File path:", record[0], "Raw data:", record[1], ", error:", err.Error())
+		db.PrintIDs(displayed, group.SearchTerms, PrintOptions{ShowTime: options.ShowTime})
 
-		return
-	}
+		if len(displayed) < len(group.IDs) {
+			db.output.Printf("... (showing %d of %d files in this group)\n", len(displayed), len(group.IDs))
+		}
 
-	hash := record[2]
+		if options.Preview > 0 {
+			db.printPreviews(displayed, options.Preview)
+		}
 
-	searchTerms := pathToSearchTerms(filePath)
+		var suggested []string
+		if options.PreferOlderThan > 0 {
+			for _, num := range db.olderDeletionCandidates(displayed, time.Now().Add(-options.PreferOlderThan)) {
+				suggested = append(suggested, strconv.Itoa(num))
+			}
+		}
 
-	err = db.add(filePath, size, hash, searchTerms)
-	if err != nil {
-		db.output.Println("Unable to add record to DB, file path:", filePath, ", error:", err.Error())
-	}
-}
+		if len(suggested) > 0 {
+			db.output.Printf("Suggested for deletion (older than %s): %s\n", options.PreferOlderThan, strings.Join(suggested, ","))
+			db.output.Printf("Delete any files? (comma separated list of numbers, %s to delete the suggested ones)\n", acceptSuggestion)
+		} else {
+			db.output.Println("Delete any files? (comma separated list of numbers)")
+		}
 
-func (db *DB) Scan(roots ...string) error {
-	db.mutex.Lock()
-	defer db.mutex.Unlock()
+		err := db.output.Scanln(&input)
+		if errors.Is(err, io.EOF) {
+			// No answer will come anymore, skip the group as if nothing was selected
+			continue
+		}
 
-	for _, root := range roots {
-		files, err := collectFiles(root)
 		if err != nil {
-			return fmt.Errorf("unable to collect files in root %s, err: %w", root, err)
+			db.output.Println("Error scanning numbers. Scanned:", input)
+			db.output.Println()
+
+			continue
 		}
 
-		db.handleMatches(root, files)
-	}
+		if len(suggested) > 0 && strings.TrimSpace(input) == acceptSuggestion {
+			input = strings.Join(suggested, ",")
+		}
 
-	return nil
-}
+		if len(strings.TrimSpace(input)) == 0 {
+			continue
+		}
 
-func collectFiles(root string) (map[string]struct{}, error) {
-	result := make(map[string]struct{})
+		var planned []ID
 
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err == nil && !info.IsDir() {
-			result[path] = struct{}{}
+		numbers := strings.Split(input, ",")
+		for _, num := range numbers {
+			if options.ConfirmEach && !db.confirmDeletion(displayed, num) {
+				continue
+			}
+
+			// Planned deletions are only collected, they are executed later by apply-plan
+			if options.Plan != "" {
+				if id, ok := db.selectFile(displayed, num); ok {
+					db.output.Println("Planning to delete", id)
+
+					planned = append(planned, id)
+				}
+
+				continue
+			}
+
+			if id, ok := db.deleteFile(displayed, num, options); ok {
+				deleted = append(deleted, id)
+			}
 		}
 
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("unable to walk directory %s, err: %w", root, err)
+		// The first file of the group not selected is recorded as the kept copy, which apply-plan checks as well
+		if len(planned) > 0 {
+			members := slices.Sorted(slices.Values(group.IDs))
+			keep := slices.IndexFunc(members, func(id ID) bool {
+				return !slices.Contains(planned, id)
+			})
+
+			if keep < 0 {
+				db.output.Println("Not planning to delete every file of the group, keep at least one of them")
+			} else {
+				for _, id := range planned {
+					kept[id] = members[keep]
+				}
+
+				deleted = append(deleted, planned...)
+			}
+		}
+
+		db.output.Println()
 	}
 
-	return result, nil
+	return deleted
 }
 
-func (db *DB) handleMatches(root string, files map[string]struct{}) {
-	// Add files found to the database, if not already there
-	skipped := 0
-	created := 0
-	for filename := range files {
-		if _, ok := db.Files[ID(filename)]; ok {
-			skipped++
+// resolveByKeepPattern keeps the file of each group whose path matches the keep pattern and deletes the others, or
+// selects them for deletion when a plan is made. Groups where the pattern matches no file or multiple files are
+// skipped, as there is no safe choice for them. Files whose content differs from the kept file are skipped as well.
+// The files deleted or selected are returned.
+func (db *DB) resolveByKeepPattern(groups map[string]SearchGroup, options DuplicateOptions, planKept map[ID]ID) []ID {
+	var (
+		deleted []ID
+		skipped int
+	)
 
-			continue
+	for _, key := range db.groupKeysBySize(groups) {
+		ids := slices.Sorted(slices.Values(groups[key].IDs))
+
+		var kept []ID
+		for _, id := range ids {
+			if options.KeepPattern.MatchString(string(id)) {
+				kept = append(kept, id)
+			}
 		}
 
-		err := db.handleMatch(filename)
-		if err != nil {
-			db.output.Println(err.Error())
+		if len(kept) != 1 {
+			db.output.Printf("Skipping %d duplicates of %s: the keep pattern matches %d of them\n", len(ids), ids[0], len(kept))
+			skipped++
 
 			continue
 		}
 
-		created++
-	}
+		db.output.Println("Keeping", kept[0])
 
-	// Remove the files from the database which can no longer be found in the file system
-	deleted := 0
-	for _, record := range db.Files {
-		if !strings.HasPrefix(record.Path, root) {
-			continue
-		}
+		for _, id := range ids {
+			if id == kept[0] {
+				continue
+			}
 
-		if _, ok := files[record.Path]; !ok {
-			delete(db.Files, ID(record.Path))
+			if isArchiveEntry(string(id)) {
+				db.output.Errorf(errCodeDeleteFile, "Unable to delete file: %s, err: files inside archives can't be deleted\n", id)
 
-			deleted++
+				continue
+			}
+
+			// The hashes only cover a sample of the files, so they are compared in full before deleting without a prompt
+			same, err := isSameContent(string(kept[0]), string(id))
+			if err != nil {
+				db.output.Errorf(errCodeReadFile, "Skipping %s: %v\n", id, err)
+
+				continue
+			}
+
+			if !same {
+				db.output.Printf("Skipping %s: its content differs from %s\n", id, kept[0])
+
+				continue
+			}
+
+			if options.Plan != "" {
+				db.output.Println("Planning to delete", id)
+
+				deleted = append(deleted, id)
+				planKept[id] = kept[0]
+
+				continue
+			}
+
+			if db.removeFile(id, options.Trash) {
+				deleted = append(deleted, id)
+			}
 		}
 	}
 
-	db.output.Printf("root: %s, %d found files, %d skipped, %d created, %d deleted\n", root, len(files), skipped, created, deleted)
+	db.output.Printf("Resolved %d groups, skipped %d groups\n", len(groups)-skipped, skipped)
+
+	return deleted
 }
 
-func (db *DB) handleMatch(filename string) error {
-	fileInfo, err := os.Stat(filename)
-	if err != nil {
-		return fmt.Errorf("unable to stat file %s, err: %w", filename, err)
+// confirmDeletion asks whether the file selected by its number should really be deleted. Invalid numbers are not
+// asked about, they are reported when deleting.
+func (db *DB) confirmDeletion(ids []ID, num string) bool {
+	index, err := strconv.Atoi(strings.TrimSpace(num))
+	if err != nil || index < 1 || index > len(ids) {
+		return true
 	}
 
-	size := fileInfo.Size()
-	searchTerms := pathToSearchTerms(filename)
+	db.output.Printf("Delete %s? [y/N]\n", ids[index-1])
 
-	hashSize := MB
-	if size < MB {
-		hashSize = int(size)
-	}
+	answer := ""
 
-	hash, err := hashFile(filename, hashSize)
+	err = db.output.Scanln(&answer)
 	if err != nil {
-		return fmt.Errorf("unable to hash file %s, err: %w", filename, err)
+		return false
 	}
 
-	err = db.add(filename, int(size), hash, searchTerms)
-	if err != nil {
-		return fmt.Errorf("unable to add record to DB, file path: %s, err: %w", filename, err)
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
 	}
 
-	return nil
+	db.output.Println("Keeping", ids[index-1])
+
+	return false
 }
 
-func (db *DB) add(filePath string, size int, hash string, searchTerms []string) error {
-	id := ID(filePath)
+// olderDeletionCandidates returns the numbers of the files modified before the cutoff, as displayed for selection.
+// At least one file is always kept: if all files are older, the most recently modified one is not suggested. Files
+// without a known modification time are never suggested.
+func (db *DB) olderDeletionCandidates(ids []ID, cutoff time.Time) []int {
+	var candidates []int
+	for i, id := range ids {
+		modTime := db.Files[id].ModTime
+		if !modTime.IsZero() && modTime.Before(cutoff) {
+			candidates = append(candidates, i+1)
+		}
+	}
 
-	db.ids = append(db.ids, id)
-	db.Files[id] = Record{Path: filePath, Size: size, Hash: hash, SearchTerms: searchTerms}
-	db.Sizes[size] = append(db.Sizes[size], id)
-	for _, term := range searchTerms {
-		db.SearchTerms[term] = append(db.SearchTerms[term], id)
+	if len(candidates) < len(ids) {
+		return candidates
 	}
-	db.Hashes[hash] = append(db.Hashes[hash], id)
 
-	return nil
+	newest := 0
+	for i, id := range ids {
+		if db.Files[id].ModTime.After(db.Files[ids[newest]].ModTime) {
+			newest = i
+		}
+	}
+
+	return slices.DeleteFunc(candidates, func(num int) bool { return num == newest+1 })
 }
 
-func (db *DB) Write() error {
-	db.mutex.RLock()
-	defer db.mutex.RUnlock()
+// groupKeysBySize returns the keys of the groups ordered by the total size of their files, largest first, so that the
+// groups occupying the most space are reviewed first.
+func (db *DB) groupKeysBySize(groups map[string]SearchGroup) []string {
+	totals := make(map[string]int64, len(groups))
+	for key, group := range groups {
+		for _, id := range group.IDs {
+			totals[key] += int64(db.Files[id].Size)
+		}
+	}
+
+	keys := slices.Collect(maps.Keys(groups))
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(totals[b], totals[a]), strings.Compare(a, b))
+	})
+
+	return keys
+}
 
-	// write CSV file from db.Files
-	file, err := os.Create(db.dbFile)
+// hardLinkedIDs returns the other catalogued files pointing to the same inode as the given file.
+// Hardlinks always have the same size, so only records of the same size need to be checked.
+func (db *DB) hardLinkedIDs(id ID) []ID {
+	fileInfo, err := os.Stat(string(id))
 	if err != nil {
-		return fmt.Errorf("unable to create DB file %s, err: %w", db.dbFile, err)
+		return nil
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
 
-	ids := db.ids
+	var links []ID
+	for _, otherID := range db.Sizes[db.Files[id].Size] {
+		if otherID == id {
+			continue
+		}
 
-	sort.Slice(ids, func(i, j int) bool {
-		return ids[i] < ids[j]
-	})
+		if _, ok := db.Files[otherID]; !ok {
+			continue
+		}
 
-	for _, id := range db.ids {
-		record := []string{db.Files[id].Path, strconv.Itoa(db.Files[id].Size), db.Files[id].Hash}
-		err = writer.Write(record)
+		otherInfo, err := os.Stat(string(otherID))
 		if err != nil {
-			return fmt.Errorf("unable to write record to DB file %s, err: %w", db.dbFile, err)
+			continue
+		}
+
+		if os.SameFile(fileInfo, otherInfo) {
+			links = append(links, otherID)
 		}
 	}
 
-	return nil
+	return links
 }
 
-func pathToSearchTerms(filePath string) []string {
-	_, fileName := filepath.Split(filePath)
+// deleteFile deletes the file selected by its number and returns its ID if it was deleted.
+func (db *DB) deleteFile(ids []ID, num string, options DuplicateOptions) (ID, bool) {
+	id, ok := db.selectFile(ids, num)
+	if !ok {
+		return "", false
+	}
 
-	var terms []string
-	for _, term := range strings.Split(fileName, "-") {
-		terms = append(terms, strings.ToLower(strings.TrimSpace(term)))
+	if !db.removeFile(id, options.Trash) {
+		return "", false
 	}
 
-	return terms
+	return id, true
 }
 
-func (db *DB) Search(searchType string, searchTerms []string) {
-	db.mutex.RLock()
-	defer db.mutex.RUnlock()
-
-	var allIDs [][]ID
+// selectFile returns the ID of the file selected by its number, if it is valid and can be deleted.
+func (db *DB) selectFile(ids []ID, num string) (ID, bool) {
+	index, err := strconv.Atoi(strings.TrimSpace(num))
+	if err != nil {
+		db.output.Printf("Invalid number: %s, err: %v, skipping...\n", err, num)
 
-	switch searchType {
-	case fast:
-		allIDs = db.fastCollectIDs(searchTerms)
-	case slow:
-		allIDs = db.slowCollectIDs(searchTerms)
+		return "", false
 	}
 
-	if len(allIDs) == 0 {
-		db.output.Println("No results found.")
+	if index < 1 || index > len(ids) {
+		db.output.Printf("Invalid index: %d, skipping...\n", index)
 
-		return
+		return "", false
 	}
 
-	intersected := intersectAllIDs(allIDs)
-
-	db.PrintIDs(intersected, searchTerms)
-}
-
-func (db *DB) fastCollectIDs(searchedTerms []string) [][]ID {
-	var results [][]ID
-
-	for _, searchedTerm := range searchedTerms {
-		termIDs, ok := db.SearchTerms[searchedTerm]
-		if !ok {
-			db.output.Printf("No results found for search term '%s'.\n", searchedTerm)
-
-			return nil
-		}
+	id := ids[index-1]
 
-		if len(termIDs) == 0 {
-			return nil
-		}
+	if isArchiveEntry(string(id)) {
+		db.output.Errorf(errCodeDeleteFile, "Unable to delete file: %s, err: files inside archives can't be deleted\n", id)
 
-		results = append(results, termIDs)
+		return "", false
 	}
 
-	return results
+	return id, true
 }
 
-func (db *DB) slowCollectIDs(searchedTerms []string) [][]ID {
-	var results [][]ID
+// removeFile deletes a file, or moves it to the trash, and removes it from the catalog. It reports whether the file
+// was deleted.
+func (db *DB) removeFile(id ID, trash bool) bool {
+	db.output.Println("Deleting", id)
 
-	for _, searchedTerm := range searchedTerms {
-		found := make(map[ID]struct{})
+	if links := db.hardLinkedIDs(id); len(links) > 0 {
+		db.output.Printf("Warning: %s shares its inode with %d other catalogued file(s), no space will be reclaimed\n", id, len(links))
+	}
 
-		for term, ids := range db.SearchTerms {
-			if !strings.Contains(term, searchedTerm) {
-				continue
-			}
+	if trash {
+		err := moveToTrash(string(id))
+		if errors.Is(err, errTrashUnsupported) {
+			db.output.Errorf(errCodeDeleteFile, "Warning: %v, %s was not deleted\n", err, id)
 
-			for _, id := range ids {
-				found[id] = struct{}{}
-			}
+			return false
 		}
 
-		if len(found) == 0 {
-			db.output.Printf("No results found for search term '%s'.\n", searchedTerm)
+		if err != nil {
+			db.output.Errorf(errCodeDeleteFile, "Unable to move file to trash: %s, err: %v\n", id, err)
 
-			return nil
+			return false
 		}
+	} else {
+		err := os.Remove(string(id))
+		if err != nil {
+			db.output.Errorf(errCodeDeleteFile, "Unable to delete file: %s, err: %v\n", id, err)
 
-		uniqueIDs := []ID{}
-		for id := range found {
-			uniqueIDs = append(uniqueIDs, id)
+			return false
 		}
-
-		results = append(results, uniqueIDs)
 	}
 
-	return results
-}
-
-func intersectAllIDs(idGroups [][]ID) []ID {
-	idGroup := idGroups[0]
-	for _, termIDs := range idGroups[1:] {
-		idGroup = intersectIDs(idGroup, termIDs)
+	delete(db.Files, id)
 
-		if len(idGroup) == 0 {
-			return nil
-		}
-	}
+	return true
+}
 
-	return idGroup
+// planEntry is a file selected for deletion by duplicates --plan. The size and hash detect changes made to the file
+// since the plan was made.
+type planEntry struct {
+	Path           string
+	Size           int64
+	Hash           string
+	SamplePosition string
+	// HashMode is empty for sample hashes, see Record.HashMode for the others
+	HashMode string
+	// Kept is the copy of the group kept, which has to be unchanged for the file to be deleted, nil if none was recorded
+	Kept *planEntry
 }
 
-func intersectIDs(a, b []ID) []ID {
-	var result []ID
+// planColumns is the number of columns describing a file in a plan row, the deleted file is followed by the kept copy
+const planColumns = 5
 
-	for _, id := range a {
-		if slices.Contains(b, id) {
-			result = append(result, id)
-		}
+func newPlanEntry(record Record) planEntry {
+	return planEntry{
+		Path:           record.Path,
+		Size:           int64(record.Size),
+		Hash:           record.Hash,
+		SamplePosition: record.SamplePosition,
+		HashMode:       record.HashMode,
 	}
+}
 
-	return result
+func (entry planEntry) row() []string {
+	return []string{entry.Path, strconv.FormatInt(entry.Size, 10), entry.Hash, entry.SamplePosition, entry.HashMode}
 }
 
-func (db *DB) PrintIDs(ids []ID, searchTerms []string) {
-	if len(ids) > maxLines {
-		ids = ids[:maxLines]
+// writePlan writes the files selected for deletion to the plan file, each of them once, together with the copies kept.
+func (db *DB) writePlan(planFile string, ids []ID, kept map[ID]ID) error {
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	err := db.recordArtifact(planFile)
+	if err != nil {
+		return err
 	}
 
-	sort.Slice(ids, func(i, j int) bool {
-		return ids[i] < ids[j]
-	})
+	file, err := os.Create(planFile)
+	if err != nil {
+		return fmt.Errorf("unable to create plan file %s, err: %w", planFile, err)
+	}
+	defer file.Close()
 
-	for i, id := range ids {
-		record := db.Files[id]
+	writer := csv.NewWriter(file)
 
-		path := FindHighlights(record.Path, searchTerms)
+	for _, id := range ids {
+		row := newPlanEntry(db.Files[id]).row()
+		if keptID, ok := kept[id]; ok {
+			row = append(row, newPlanEntry(db.Files[keptID]).row()...)
+		}
 
-		db.output.Printf("[%d] %s (%d MB)\n", i+1, path, record.Size/MB)
+		err = writer.Write(row)
+		if err != nil {
+			return fmt.Errorf("unable to write plan file %s, err: %w", planFile, err)
+		}
 	}
 
-	if len(ids) >= maxLines {
-		db.output.Println("... (truncated)")
+	writer.Flush()
+
+	err = writer.Error()
+	if err != nil {
+		return fmt.Errorf("unable to write plan file %s, err: %w", planFile, err)
 	}
-}
 
-func FindHighlights(haystack string, needles []string) string {
-	var highlights [][2]int
+	db.output.Printf("Planned the deletion of %d files in %s\n", len(ids), planFile)
 
-	lower := strings.ToLower(haystack)
-	for _, searchTerm := range needles {
-		idx := strings.Index(lower, searchTerm)
-		if idx == -1 {
-			continue
-		}
+	return nil
+}
 
-		highlights = append(highlights, [2]int{idx, idx + len(searchTerm)})
+func readPlan(planFile string) ([]planEntry, error) {
+	records, err := readCsvFile(planFile)
+	if err != nil {
+		return nil, err
 	}
 
-	sort.Slice(highlights, func(i, j int) bool {
-		return highlights[i][0] < highlights[j][0]
-	})
+	entries := make([]planEntry, 0, len(records))
+	for _, record := range records {
+		entry, err := parsePlanEntry(record)
+		if err != nil {
+			return nil, err
+		}
 
-	var parts []string
+		if len(record) > planColumns {
+			kept, err := parsePlanEntry(record[planColumns:])
+			if err != nil {
+				return nil, err
+			}
 
-	tmp := 0
-	for _, highlight := range highlights {
-		// This means that ranges overlap. Let's abort highlighting for the sake of simplicity.
-		if tmp > 0 && tmp > highlight[0] {
-			return blueBold + haystack + reset
+			entry.Kept = &kept
 		}
 
-		parts = append(parts,
-			haystack[tmp:highlight[0]],
-			redBold+haystack[highlight[0]:highlight[1]]+reset)
+		entries = append(entries, entry)
+	}
 
-		tmp = highlight[1]
+	return entries, nil
+}
+
+func parsePlanEntry(record []string) (planEntry, error) {
+	if len(record) < 4 {
+		return planEntry{}, fmt.Errorf("invalid plan row: %v", record)
 	}
 
-	if tmp < len(haystack) {
-		parts = append(parts, haystack[tmp:])
+	size, err := strconv.ParseInt(record[1], 10, 64)
+	if err != nil {
+		return planEntry{}, fmt.Errorf("invalid plan row: %v, err: %w", record, err)
 	}
 
-	if len(parts) <= 1 {
-		return yellowBold + haystack + reset
+	entry := planEntry{Path: record[0], Size: size, Hash: record[2], SamplePosition: record[3]}
+	if len(record) > 4 {
+		entry.HashMode = record[4]
 	}
 
-	return strings.Join(parts, "")
+	return entry, nil
 }
 
-func hashFile(path string, sampleSize int) (string, error) {
-	fi, err := os.Stat(path)
-	if err != nil {
-		return "", fmt.Errorf("can't stat file: %s, err: %w", path, err)
+// ApplyPlan deletes the files of a plan after a final confirmation. Files which are missing or changed since the plan
+// was made are skipped, as the reasons for deleting them may no longer hold. So are the files whose kept copy is
+// missing, changed or deleted by the plan as well.
+func (db *DB) ApplyPlan(entries []planEntry, trash bool) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	planned := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		planned[entry.Path] = struct{}{}
 	}
 
-	if fi.Size() < MB {
-		sampleSize = int(fi.Size())
+	var (
+		ids   []ID
+		total int64
+	)
+
+	for _, entry := range entries {
+		err := checkPlanEntry(entry, planned)
+		if err != nil {
+			db.output.Errorf(errCodePlanEntry, "Skipping %s: %v\n", entry.Path, err)
+
+			continue
+		}
+
+		ids = append(ids, ID(entry.Path))
+		total += entry.Size
 	}
 
-	f, err := os.Open(path)
-	if err != nil {
-		return "", fmt.Errorf("can't open file: %s, err: %w", path, err)
+	if len(ids) == 0 {
+		db.output.Println("Nothing to delete")
+
+		return
 	}
 
-	data := make([]byte, sampleSize)
+	db.output.Printf("Delete %d files (%s)? [y/N]\n", len(ids), formatBytes(total))
+
+	answer := ""
 
-	_, err = f.Read(data)
+	err := db.output.Scanln(&answer)
 	if err != nil {
-		return "", fmt.Errorf("can't read file: %s, err: %w", path, err)
+		return
 	}
 
-	if err = f.Close(); err != nil {
-		return "", fmt.Errorf("can't close file: %s, err: %w", path, err)
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+	default:
+		db.output.Println("Nothing deleted")
+
+		return
 	}
 
-	md5Hasher := md5.New()
-	_, err = md5Hasher.Write(data)
-	if err != nil {
-		return "", fmt.Errorf("can't calculate md5 hash for file: %s, err: %w", path, err)
+	deleted := 0
+	for _, id := range ids {
+		if db.removeFile(id, trash) {
+			deleted++
+		}
 	}
-	sum := md5Hasher.Sum(nil)
 
-	return hex.EncodeToString(sum), nil
+	db.output.Printf("Deleted %d of %d planned files\n", deleted, len(entries))
 }
 
-func (db *DB) Stats(minLength int) {
-	db.mutex.RLock()
-	defer db.mutex.RUnlock()
+// ImportManifest catalogs the files listed in an md5sum manifest (lines of "<hash>  <path>") with the checksums of the
+// manifest, without hashing the files. Relative paths are resolved from the directory of the manifest. The files are
+// stat-ed for their size and modification time, files not found are imported without a size. Files already catalogued
+// are kept as they are.
+func (db *DB) ImportManifest(content, baseDir string) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 
-	db.output.Printf("Total records: %d\n", len(db.Files))
-	db.output.Printf("Total unique sizes: %d\n", len(db.Sizes))
-	db.output.Printf("Total unique search terms: %d\n", len(db.SearchTerms))
-	db.output.Printf("Total unique hashes: %d\n", len(db.Hashes))
+	imported, sizeless, known, invalid := 0, 0, 0, 0
 
-	db.sizeStats()
-	db.hashStats()
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
 
-	db.searchTermStats(minLength)
-}
+		hash, path, ok := parseManifestLine(line)
+		if !ok {
+			db.output.Printf("Skipping invalid line %d: %s\n", i+1, line)
+			invalid++
 
-func (db *DB) sizeStats() {
-	sizesWithMultipleIDs := 0
+			continue
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		if _, ok := db.Files[ID(path)]; ok {
+			known++
 
-	for _, ids := range db.Sizes {
-		if len(ids) == 1 {
 			continue
 		}
 
-		sizesWithMultipleIDs++
-	}
+		// The hashes of files not larger than the sample are the same as the ones calculated by scans
+		record := Record{Path: path, Hash: hash, HashMode: hashModeFullMD5, SearchTerms: db.searchTerms(path), Root: db.rootOf(path)}
 
-	db.output.Printf("Sizes with multiple records: %d\n", sizesWithMultipleIDs)
-}
+		fileInfo, err := os.Stat(path)
+		if err == nil {
+			record.Size = int(fileInfo.Size())
+			record.ModTime = fileInfo.ModTime()
 
-func (db *DB) hashStats() {
-	hashWithMultipleIDs := 0
+			if fileInfo.Size() <= MB {
+				record.HashMode = ""
+			}
+		} else {
+			sizeless++
+		}
+
+		err = db.add(record)
+		if err != nil {
+			db.output.Errorf(errCodeUpdateDB, "Unable to add record to DB, file path: %s, error: %v\n", path, err)
 
-	for _, ids := range db.Hashes {
-		if len(ids) == 1 {
 			continue
 		}
 
-		hashWithMultipleIDs++
+		imported++
 	}
 
-	db.output.Printf("Hashes with multiple records: %d\n", hashWithMultipleIDs)
+	db.output.Printf("Imported %d files (%d not found, imported without a size), skipped %d already catalogued and %d invalid lines\n", imported, sizeless, known, invalid)
 }
 
-func (db *DB) searchTermStats(minLength int) {
-	searchTermStats := make(map[int]int)
-	for searchTerm, ids := range db.SearchTerms {
-		if len(ids) < 2 {
-			continue
-		}
+// parseManifestLine parses a line of an md5sum manifest. The hash and the path are separated by a space and a space
+// (text mode) or an asterisk (binary mode).
+func parseManifestLine(line string) (string, string, bool) {
+	hash, path, ok := strings.Cut(line, " ")
+	if !ok || len(hash) != 32 || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+		return "", "", false
+	}
 
-		if len(searchTerm) < minLength {
-			continue
-		}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", "", false
+	}
 
-		key := len(searchTerm) / 5
+	return strings.ToLower(hash), path[1:], true
+}
 
-		searchTermStats[key] += 1
+// checkPlanEntry returns an error if the file of the entry can't be deleted safely anymore: if the file or the copy
+// kept changed since planning, or the kept copy is planned to be deleted as well.
+func checkPlanEntry(entry planEntry, planned map[string]struct{}) error {
+	if isArchiveEntry(entry.Path) {
+		return errors.New("files inside archives can't be deleted")
 	}
 
-	// sort searchTerms by keys
-	keys := make([]int, 0, len(searchTermStats))
-	for k := range searchTermStats {
-		keys = append(keys, k)
+	if entry.Kept == nil {
+		return errors.New("no kept copy was recorded")
 	}
-	sort.Ints(keys)
 
-	db.output.Println()
-	db.output.Printf("Search term length distribution:\n")
-	for _, length := range keys {
-		db.output.Printf("Search terms with length %d: %d\n", length*5, searchTermStats[length])
+	if _, ok := planned[entry.Kept.Path]; ok {
+		return fmt.Errorf("the kept copy %s is planned to be deleted as well", entry.Kept.Path)
 	}
-}
 
-func (db *DB) Duplicates(minLength int) {
-	db.mutex.Lock()
-	defer db.mutex.Unlock()
+	err := checkPlannedFile(entry)
+	if err != nil {
+		return err
+	}
 
-	db.duplicatesBySizeAndHash()
+	err = checkPlannedFile(*entry.Kept)
+	if err != nil {
+		return fmt.Errorf("kept copy %s: %w", entry.Kept.Path, err)
+	}
 
-	db.duplicatesBySearchTerm(minLength)
+	return nil
 }
 
-type SearchType string
+// checkPlannedFile returns an error if the file of the entry changed since planning.
+func checkPlannedFile(entry planEntry) error {
+	if entry.Hash == "" {
+		return errors.New("no hash was recorded to detect changes")
+	}
 
-const (
-	SizeAndHash SearchType = "Size and hash"
-	SearchTerm  SearchType = "Search term"
-)
+	fileInfo, err := os.Stat(entry.Path)
+	if err != nil {
+		return fmt.Errorf("unable to stat file, err: %w", err)
+	}
 
-type SearchGroup struct {
-	IDs         []ID
-	SearchTerms []string
-	Type        SearchType
+	if fileInfo.Size() != entry.Size {
+		return fmt.Errorf("size changed since planning (planned: %d, actual: %d)", entry.Size, fileInfo.Size())
+	}
+
+	var hash string
+	switch entry.HashMode {
+	case hashModeTree:
+		hash, err = treeHashFile(entry.Path, hashAlgoMD5, nil)
+	case hashModeFullMD5:
+		hash, err = hashWholeFile(entry.Path, hashAlgoMD5)
+	default:
+		hash, err = hashFile(entry.Path, MB, entry.SamplePosition)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if hash != entry.Hash {
+		return errors.New("content changed since planning")
+	}
+
+	return nil
 }
 
-func (db *DB) duplicatesBySizeAndHash() {
-	groups := make(map[string]SearchGroup)
+var errTrashUnsupported = errors.New("moving files to the trash is not supported on this platform")
 
-	for hash, ids := range db.Hashes {
-		if len(ids) < 2 {
-			continue
-		}
+// moveToTrash moves a file to the trash of the current user. The Finder trash is used on macOS, the XDG trash
+// specification is followed on other Unix-like systems.
+func moveToTrash(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("unable to determine absolute path of %s, err: %w", path, err)
+	}
 
-		sizes := make(map[int][]ID)
-		for _, id := range ids {
-			size := db.Files[id].Size
-			sizes[size] = append(sizes[size], id)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("unable to determine home directory, err: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		trashDir := filepath.Join(home, ".Trash")
+
+		for i := 1; ; i++ {
+			target := filepath.Join(trashDir, trashName(filepath.Base(absPath), i))
+			if _, err := os.Lstat(target); err == nil {
+				continue
+			}
+
+			return moveFile(absPath, target)
 		}
+	case "windows", "plan9", "js", "wasip1":
+		return errTrashUnsupported
+	}
 
-		for size, sizeIDs := range sizes {
-			groupID := fmt.Sprintf("%s-%d", hash, size)
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
 
-			slices.Sort(sizeIDs)
+	// Files on other volumes (e.g. external drives) go to the trash of their volume, so that they don't have to be
+	// copied. If that trash can't be used, they are copied to the trash in the home directory.
+	trashDir := filepath.Join(dataHome, "Trash")
+	trashedPath := absPath
 
-			groups[groupID] = SearchGroup{
-				IDs:         sizeIDs,
-				SearchTerms: []string{},
-				Type:        SizeAndHash,
-			}
+	if topdir, ok := foreignVolumeRoot(absPath, dataHome); ok {
+		if dir, err := topdirTrash(topdir, os.Getuid()); err == nil {
+			trashDir = dir
+
+			// The paths in the trash of a volume are relative to its top directory, so that they survive remounting
+			trashedPath, _ = filepath.Rel(topdir, absPath)
 		}
 	}
 
-	db.handleDuplicateGroups(groups)
-}
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
 
-func (db *DB) duplicatesBySearchTerm(minLength int) {
-	groups := make(map[string]SearchGroup)
+	for _, dir := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("unable to create trash directory %s, err: %w", dir, err)
+		}
+	}
 
-	for term, ids := range db.SearchTerms {
-		if len(ids) < 2 {
+	// The info file is created exclusively first to reserve the name in the trash, as required by the specification
+	for i := 1; ; i++ {
+		name := trashName(filepath.Base(absPath), i)
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+
+		info, err := os.OpenFile(infoPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if errors.Is(err, os.ErrExist) {
 			continue
 		}
+		if err != nil {
+			return fmt.Errorf("unable to create trash info file %s, err: %w", infoPath, err)
+		}
 
-		if len(term) < minLength {
-			continue
+		_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", (&url.URL{Path: trashedPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if closeErr := info.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = moveFile(absPath, filepath.Join(filesDir, name))
 		}
+		if err != nil {
+			_ = os.Remove(infoPath)
 
-		groups[term] = SearchGroup{
-			IDs:         ids,
-			SearchTerms: []string{term},
-			Type:        SearchTerm,
+			return fmt.Errorf("unable to move file to trash: %s, err: %w", absPath, err)
 		}
-	}
 
-	db.handleDuplicateGroups(groups)
+		return nil
+	}
 }
 
-func (db *DB) handleDuplicateGroups(searchGroups map[string]SearchGroup) {
-	input := ""
-	iter := 1
+// foreignVolumeRoot returns the top directory (mount point) of the volume the file is stored on, if it's not the volume
+// of the home trash.
+func foreignVolumeRoot(absPath, dataHome string) (string, bool) {
+	fileInfo, err := os.Lstat(absPath)
+	if err != nil {
+		return "", false
+	}
 
-	for _, group := range searchGroups {
-		db.output.Printf("Duplicates found: %d (%d / %d) - %s\n", len(group.IDs), iter, len(searchGroups), group.Type)
+	device, ok := deviceID(fileInfo)
+	if !ok {
+		return "", false
+	}
 
-		iter++
+	// The home trash may not exist yet, its closest existing parent is on the same volume
+	for dir := dataHome; ; dir = filepath.Dir(dir) {
+		dirInfo, err := os.Stat(dir)
+		if err == nil {
+			if homeDevice, ok := deviceID(dirInfo); !ok || homeDevice == device {
+				return "", false
+			}
+
+			break
+		}
 
-		db.PrintIDs(group.IDs, group.SearchTerms)
+		if filepath.Dir(dir) == dir {
+			return "", false
+		}
+	}
 
-		db.output.Println("Delete any files? (comma separated list of numbers)")
+	topdir := filepath.Dir(absPath)
+	for {
+		parent := filepath.Dir(topdir)
+		if parent == topdir {
+			break
+		}
 
-		err := db.output.Scanln(&input)
+		parentInfo, err := os.Stat(parent)
 		if err != nil {
-			db.output.Println("Error scanning numbers. Scanned:", input)
-			db.output.Println()
-
-			continue
+			break
 		}
 
-		if len(strings.TrimSpace(input)) == 0 {
-			continue
+		if parentDevice, ok := deviceID(parentInfo); !ok || parentDevice != device {
+			break
 		}
 
-		numbers := strings.Split(input, ",")
-		for _, num := range numbers {
-			db.deleteFile(group.IDs, num)
+		topdir = parent
+	}
+
+	return topdir, true
+}
+
+// topdirTrash returns the trash directory of the user on the volume with the given top directory, as defined by the XDG
+// trash specification: $topdir/.Trash/$uid if the administrator created $topdir/.Trash as a sticky directory, or
+// $topdir/.Trash-$uid otherwise, which is created if needed.
+func topdirTrash(topdir string, uid int) (string, error) {
+	shared := filepath.Join(topdir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(shared, strconv.Itoa(uid))
+		if err := os.MkdirAll(dir, 0o700); err == nil {
+			return dir, nil
 		}
+	}
 
-		db.output.Println()
+	dir := filepath.Join(topdir, ".Trash-"+strconv.Itoa(uid))
+
+	err := os.Mkdir(dir, 0o700)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("unable to create trash directory %s, err: %w", dir, err)
+	}
+
+	// Symbolic links could redirect the trashed files anywhere
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("invalid trash directory %s", dir)
 	}
+
+	return dir, nil
 }
 
-func (db *DB) deleteFile(ids []ID, num string) bool {
-	index, err := strconv.Atoi(strings.TrimSpace(num))
+// moveFile renames a file, or copies it and removes the original if it has to be moved to another volume.
+func moveFile(source, target string) error {
+	err := os.Rename(source, target)
+	if !isCrossDeviceError(err) {
+		return err
+	}
+
+	err = copyFile(source, target)
 	if err != nil {
-		db.output.Printf("Invalid number: %s, err: %v, skipping...\n", err, num)
+		_ = os.Remove(target)
 
-		return false
+		return err
 	}
 
-	if index < 1 || index > len(ids) {
-		db.output.Printf("Invalid index: %d, skipping...\n", index)
+	return os.Remove(source)
+}
 
-		return false
+// copyFile copies a file with its permissions and modification time. The target must not exist yet.
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	id := ids[index-1]
-
-	db.output.Println("Deleting", id)
+	fileInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
 
-	delete(db.Files, id)
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
 
-	err = os.Remove(string(id))
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		db.output.Printf("Unable to delete file: %s, err: %v\n", id, err)
+		return err
+	}
 
-		return false
+	return os.Chtimes(target, fileInfo.ModTime(), fileInfo.ModTime())
+}
+
+// trashName returns the name used for the nth file with the same name in the trash, e.g. "photo (2).jpg".
+func trashName(name string, n int) string {
+	if n == 1 {
+		return name
 	}
 
-	return true
+	ext := filepath.Ext(name)
+
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
 }
@@ -1,41 +1,76 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 type TestOutput struct {
-	t     *testing.T
-	data  []string
-	input []string
-	count int
+	mutex    sync.Mutex
+	t        *testing.T
+	data     []string
+	input    []string
+	count    int
+	exitCode int
+	// recordExit makes Exit record the exit code instead of skipping the rest of the test
+	recordExit bool
 }
 
 func (out *TestOutput) Println(a ...any) {
 	str := fmt.Sprintln(a...)
 
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
 	out.data = append(out.data, str)
 }
 
 func (out *TestOutput) Printf(format string, a ...any) {
 	str := fmt.Sprintf(format, a...)
 
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
 	out.data = append(out.data, str)
 }
 
+func (out *TestOutput) Errorf(_, format string, a ...any) {
+	out.Printf(format, a...)
+}
+
 func (out *TestOutput) Scanln(a *string) error {
 	if out.count >= len(out.input) {
 		*a = ""
 
-		return nil
+		return io.EOF
 	}
 
 	*a = out.input[out.count]
@@ -45,8 +80,26 @@ func (out *TestOutput) Scanln(a *string) error {
 	return nil
 }
 
-func (out *TestOutput) Exit(_ int) {
-	out.t.SkipNow()
+func (out *TestOutput) Input() io.Reader {
+	lines := out.input[out.count:]
+	out.count = len(out.input)
+
+	return strings.NewReader(strings.Join(lines, "\n"))
+}
+
+func (out *TestOutput) Exit(code int) {
+	if !out.recordExit {
+		out.t.SkipNow()
+	}
+
+	out.exitCode = code
+}
+
+// RecordExit makes the output record the exit code, so that tests can verify failures past the exit.
+func (out *TestOutput) RecordExit() *TestOutput {
+	out.recordExit = true
+
+	return out
 }
 
 func (out *TestOutput) Get(idx int) string {
@@ -58,9 +111,21 @@ func (out *TestOutput) Get(idx int) string {
 }
 
 func (out *TestOutput) String() string {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
 	return strings.Join(out.data, "\n")
 }
 
+func stripColors(str string) string {
+	str = strings.ReplaceAll(str, redBold, "")
+	str = strings.ReplaceAll(str, yellowBold, "")
+	str = strings.ReplaceAll(str, blueBold, "")
+	str = strings.ReplaceAll(str, reset, "")
+
+	return str
+}
+
 func NewTestOutput(t *testing.T, input []string) *TestOutput {
 	t.Helper()
 
@@ -72,6 +137,164 @@ func NewTestOutput(t *testing.T, input []string) *TestOutput {
 	}
 }
 
+func TestApp_Stats_HashGroupSizes(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"a/pair-1.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/pair-1.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"a/pair-2.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		"b/pair-2.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		"a/triple.jpg,300,788b62828f73d4bac70088ea91c90ef5",
+		"b/triple.jpg,300,788b62828f73d4bac70088ea91c90ef5",
+		"c/triple.jpg,300,788b62828f73d4bac70088ea91c90ef5",
+		"a/many.jpg,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		"b/many.jpg,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		"c/many.jpg,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		"d/many.jpg,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		"e/many.jpg,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		"a/single.jpg,500,37b51d194a7513e45b56f6524f2d51f2",
+	})
+
+	output := NewTestOutput(t, nil)
+
+	// execute
+	err := StatsCommand(output, dbFile, defaultMinLength, 0, "")
+	require.NoError(t, err)
+
+	// verify
+	assert.Equal(t, "Hashes with multiple records: 4\n", output.Get(5))
+	assert.Equal(t, "Hashes with 2 records: 2\n", output.Get(6))
+	assert.Equal(t, "Hashes with 3 records: 1\n", output.Get(7))
+	assert.Equal(t, "Hashes with 4+ records: 1\n", output.Get(8))
+}
+
+func TestApp_Stats_Waste(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"a/pair.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/pair.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"a/triple.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		"b/triple.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		"c/triple.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		"a/single.jpg,1200,788b62828f73d4bac70088ea91c90ef5",
+	})
+
+	output := NewTestOutput(t, nil)
+
+	// execute
+	err := StatsCommand(output, dbFile, defaultMinLength, 0, "")
+	require.NoError(t, err)
+
+	// verify
+	assert.Contains(t, output.String(), "Duplicates occupy 25.0% of catalogued bytes (500 B of 2.0 KB)\n")
+}
+
+func TestApp_Stats_MetricsCSV(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"a/pair.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/pair.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"a/single.jpg,1200,788b62828f73d4bac70088ea91c90ef5",
+	})
+	metricsFile := filepath.Join(t.TempDir(), "metrics.csv")
+
+	// execute
+	for range 2 {
+		err := StatsCommand(NewTestOutput(t, nil), dbFile, defaultMinLength, 0, metricsFile)
+		require.NoError(t, err)
+	}
+
+	// verify
+	rows, err := readCsvFile(metricsFile)
+	require.NoError(t, err)
+
+	require.Len(t, rows, 3)
+	assert.Equal(t, []string{"timestamp", "totalRecords", "totalBytes", "uniqueHashes", "reclaimableBytes"}, rows[0])
+
+	for _, row := range rows[1:] {
+		_, err = time.Parse(time.RFC3339, row[0])
+		require.NoError(t, err)
+		assert.Equal(t, []string{"3", "1400", "2", "100"}, row[1:])
+	}
+}
+
+func TestApp_Stats_FileSizes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success with an odd number of files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/tiny-1.txt,100,",
+			"a/tiny-2.txt,100,",
+			"a/small.txt,200,",
+			"a/medium.txt,600,",
+			"a/huge.bin,9000,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := StatsCommand(output, dbFile, defaultMinLength, 0, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Average file size: 2.0 KB\n", output.Get(7))
+		assert.Equal(t, "Median file size: 200 B\n", output.Get(8))
+	})
+
+	t.Run("success with an even number of files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/tiny.txt,100,",
+			"a/small-1.txt,200,",
+			"a/small-2.txt,200,",
+			"a/medium.txt,600,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := StatsCommand(output, dbFile, defaultMinLength, 0, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Average file size: 275 B\n", output.Get(7))
+		assert.Equal(t, "Median file size: 200 B\n", output.Get(8))
+	})
+
+	t.Run("success with the middle files of different sizes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/tiny.txt,100,",
+			"a/small.txt,200,",
+			"a/medium.txt,600,",
+			"a/large.txt,1000,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := StatsCommand(output, dbFile, defaultMinLength, 0, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Average file size: 475 B\n", output.Get(7))
+		assert.Equal(t, "Median file size: 400 B\n", output.Get(8))
+	})
+}
+
 func TestApp_Scan_and_Stats(t *testing.T) {
 	t.Parallel()
 
@@ -128,6 +351,16 @@ func TestApp_Scan_and_Stats(t *testing.T) {
 		err := os.Remove(dbFile)
 		require.NoError(t, err)
 
+		err = os.Remove(dbFile + lockFileSuffix)
+		if !os.IsNotExist(err) {
+			require.NoError(t, err)
+		}
+
+		err = os.Remove(dbFile + metaFileSuffix)
+		if !os.IsNotExist(err) {
+			require.NoError(t, err)
+		}
+
 		for _, dirName := range dirNames {
 			removeDir(t, dirName)
 		}
@@ -144,25 +377,29 @@ func TestApp_Scan_and_Stats(t *testing.T) {
 
 		// execute
 		// - scan directories
-		err := ScanCommand(output, dbFile, dirNames)
+		err := ScanCommand(output, dbFile, dirNames, ScanOptions{})
 		require.NoError(t, err)
 
 		// - stat
-		err = StatsCommand(output, dbFile, defaultMinLength)
+		err = StatsCommand(output, dbFile, defaultMinLength, 0, "")
 		require.NoError(t, err)
 
 		// verify
 		// - scan dir
-		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 deleted\n", dirNames[0]), output.Get(0))
-		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 deleted\n", dirNames[1]), output.Get(1))
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", dirNames[0]), output.Get(0))
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", dirNames[1]), output.Get(1))
+		assert.True(t, strings.HasPrefix(output.Get(2), "Scanned 4 files ("), output.Get(2))
 
 		// - stats
-		assert.Equal(t, "Total records: 4\n", output.Get(2))
-		assert.Equal(t, "Total unique sizes: 2\n", output.Get(3))
-		assert.Equal(t, "Total unique search terms: 2\n", output.Get(4))
-		assert.Equal(t, "Total unique hashes: 3\n", output.Get(5))
-		assert.Equal(t, "Sizes with multiple records: 2\n", output.Get(6))
-		assert.Equal(t, "Hashes with multiple records: 1\n", output.Get(7))
+		assert.Equal(t, "Total records: 4\n", output.Get(3))
+		assert.Equal(t, "Total unique sizes: 2\n", output.Get(4))
+		assert.Equal(t, "Total unique search terms: 2\n", output.Get(5))
+		assert.Equal(t, "Total unique hashes: 3\n", output.Get(6))
+		assert.Equal(t, "Sizes with multiple records: 2\n", output.Get(7))
+		assert.Equal(t, "Hashes with multiple records: 1\n", output.Get(8))
+		assert.Equal(t, "Hashes with 2 records: 1\n", output.Get(9))
+		assert.Equal(t, "Hashes with 3 records: 0\n", output.Get(10))
+		assert.Equal(t, "Hashes with 4+ records: 0\n", output.Get(11))
 	})
 
 	t.Run("success - scan, rescan and stat", func(t *testing.T) {
@@ -176,7 +413,7 @@ func TestApp_Scan_and_Stats(t *testing.T) {
 
 		// execute
 		// - scan directories
-		err := ScanCommand(output, dbFile, dirNames)
+		err := ScanCommand(output, dbFile, dirNames, ScanOptions{})
 		require.NoError(t, err)
 
 		// delete directory
@@ -187,319 +424,6878 @@ func TestApp_Scan_and_Stats(t *testing.T) {
 		defer cleanup(t, dbFile2, dirNames2)
 
 		// - scan directories
-		err = ScanCommand(output, dbFile, []string{dirNames[0], dirNames2[0], dirNames2[1]})
+		err = ScanCommand(output, dbFile, []string{dirNames[0], dirNames2[0], dirNames2[1]}, ScanOptions{})
 		require.NoError(t, err)
 
 		// - stat
-		err = StatsCommand(output, dbFile, defaultMinLength)
+		err = StatsCommand(output, dbFile, defaultMinLength, 0, "")
 		require.NoError(t, err)
 
 		// verify
 		// - scan dir
-		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 deleted\n", dirNames[0]), output.Get(0))
-		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 deleted\n", dirNames[1]), output.Get(1))
-		assert.Equal(t, fmt.Sprintf("root: %s, 0 found files, 0 skipped, 0 created, 2 deleted\n", dirNames[0]), output.Get(2))
-		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 deleted\n", dirNames2[0]), output.Get(3))
-		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 deleted\n", dirNames2[1]), output.Get(4))
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", dirNames[0]), output.Get(0))
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", dirNames[1]), output.Get(1))
+		assert.True(t, strings.HasPrefix(output.Get(2), "Scanned 4 files ("), output.Get(2))
+		assert.Equal(t, fmt.Sprintf("root: %s, 0 found files, 0 skipped, 0 created, 0 updated, 0 renamed, 2 deleted\n", dirNames[0]), output.Get(3))
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", dirNames2[0]), output.Get(4))
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", dirNames2[1]), output.Get(5))
+		assert.True(t, strings.HasPrefix(output.Get(6), "Scanned 4 files ("), output.Get(6))
 
 		// - stats
-		// assert.Equal(t, "Total records: 6\n", output.Get(5))
-		assert.Equal(t, "Total unique sizes: 2\n", output.Get(6))
-		assert.Equal(t, "Total unique search terms: 2\n", output.Get(7))
-		assert.Equal(t, "Total unique hashes: 4\n", output.Get(8))
-		assert.Equal(t, "Sizes with multiple records: 2\n", output.Get(9))
-		assert.Equal(t, "Hashes with multiple records: 2\n", output.Get(10))
+		// assert.Equal(t, "Total records: 6\n", output.Get(7))
+		assert.Equal(t, "Total unique sizes: 2\n", output.Get(8))
+		assert.Equal(t, "Total unique search terms: 2\n", output.Get(9))
+		assert.Equal(t, "Total unique hashes: 4\n", output.Get(10))
+		assert.Equal(t, "Sizes with multiple records: 2\n", output.Get(11))
+		assert.Equal(t, "Hashes with multiple records: 2\n", output.Get(12))
 	})
 }
 
-func TestApp_Duplicates(t *testing.T) {
+func TestApp_Stats_TopTerms(t *testing.T) {
 	t.Parallel()
 
-	files := []string{
-		"bar-1786396036.txt",
-		"bambam/foo-756381984.txt",
-		"bambam/baz.txt",
-		"bambam/quix-1786396036.txt",
-	}
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"a/holiday-beach.jpg,100,",
+		"b/holiday-mountain.jpg,200,",
+		"c/holiday-city.jpg,300,",
+		"d/beach-sunset.jpg,400,",
+		"e/mountain.jpg,500,",
+	})
 
-	setup := func(t *testing.T) string {
-		t.Helper()
+	output := NewTestOutput(t, nil)
 
-		random := fmt.Sprintf("%f", rand.ExpFloat64())
+	// execute
+	err := StatsCommand(output, dbFile, 5, 2, "")
+	require.NoError(t, err)
 
-		lines := []string{
-			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[0]),
-			fmt.Sprintf("%s,1786396036,4d09a656f20fee1beb093f30c7ec504c\n", files[1]),
-			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[2]),
-			fmt.Sprintf("%s,123,788b62828f73d4bac70088ea91c90ef5\n", files[3]),
+	// verify
+	require.Len(t, output.data, 17)
+	assert.Equal(t, "Top search terms:\n", output.Get(14))
+	assert.Equal(t, "holiday: 3\n", output.Get(15))
+	assert.Equal(t, "mountain.jpg: 2\n", output.Get(16))
+}
+
+func TestApp_Scan_SinceScan(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success - only new and modified files are hashed on incremental rescan", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		past := time.Now().Add(-time.Hour)
+		for _, fileName := range []string{"unchanged.txt", "modified.txt"} {
+			filePath := filepath.Join(root, fileName)
+			require.NoError(t, os.WriteFile(filePath, []byte(fileName), 0o644))
+			require.NoError(t, os.Chtimes(filePath, past, past))
 		}
 
-		dbFile := fmt.Sprintf("_test_%s.csv", random)
+		output := NewTestOutput(t, nil)
 
-		err := os.WriteFile(dbFile, []byte(strings.Join(lines, "\n")), 0o644)
+		// execute
+		// - first scan
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{SinceScan: true})
 		require.NoError(t, err)
 
-		return dbFile
-	}
+		// - add a new file and modify an existing one
+		require.NoError(t, os.WriteFile(filepath.Join(root, "new.txt"), []byte("new"), 0o644))
 
-	cleanup := func(t *testing.T, dbFile string) {
-		t.Helper()
+		modifiedPath := filepath.Join(root, "modified.txt")
+		future := time.Now().Add(time.Hour)
+		require.NoError(t, os.WriteFile(modifiedPath, []byte("modified content"), 0o644))
+		require.NoError(t, os.Chtimes(modifiedPath, future, future))
 
-		err := os.Remove(dbFile)
+		// - incremental rescan
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{SinceScan: true})
 		require.NoError(t, err)
-	}
 
-	cleanColor := func(t *testing.T, str string) string {
-		t.Helper()
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+		assert.Equal(t, fmt.Sprintf("root: %s, 3 found files, 1 skipped, 1 created, 1 updated, 0 renamed, 0 deleted\n", root), output.Get(2))
 
-		str = strings.ReplaceAll(str, redBold, "")
-		str = strings.ReplaceAll(str, yellowBold, "")
-		str = strings.ReplaceAll(str, blueBold, "")
-		str = strings.ReplaceAll(str, reset, "")
+		db := NewDB(output, dbFile)
+		db.Load()
 
-		return str
-	}
+		expectedHash, err := hashFile(modifiedPath, MB, samplePositionHead)
+		require.NoError(t, err)
+		assert.Equal(t, expectedHash, db.Files[ID(modifiedPath)].Hash)
+		assert.Equal(t, future.Unix(), db.Files[ID(modifiedPath)].ModTime.Unix())
+		assert.Len(t, db.Files, 3)
+		assert.Contains(t, db.LastScans, root)
+	})
+}
 
-	t.Run("success finding duplicates by size and hashes", func(t *testing.T) {
-		t.Parallel()
+func TestApp_Scan_Progress(t *testing.T) {
+	t.Parallel()
 
-		dbFile := setup(t)
-		defer cleanup(t, dbFile)
+	t.Run("success reporting progress by bytes", func(t *testing.T) {
+		t.Parallel()
 
 		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		require.NoError(t, os.WriteFile(filepath.Join(root, "small.txt"), make([]byte, 10), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "big.txt"), make([]byte, 990), 0o644))
+
 		output := NewTestOutput(t, nil)
 
 		// execute
-		err := DuplicateCommand(output, dbFile, defaultMinLength)
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{Progress: true})
 		require.NoError(t, err)
 
 		// verify
-		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
-		assert.Contains(t, output.Get(1), files[2])
-		assert.Contains(t, output.Get(2), files[0])
+		var progressLines []string
+		for _, line := range output.data {
+			if strings.HasPrefix(line, "Progress: ") {
+				progressLines = append(progressLines, line)
+			}
+		}
+
+		// - depending on the order of processing, the big file may be reported at 90% first
+		require.NotEmpty(t, progressLines)
+		assert.Equal(t, "Progress: 100% (1000 B / 1000 B)\n", progressLines[len(progressLines)-1])
+		assert.LessOrEqual(t, len(progressLines), 2)
 	})
+}
 
-	t.Run("success finding duplicates by partial name match", func(t *testing.T) {
+func TestApp_Scan_NoHash(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success scanning without hashes, then hashing missing ones", func(t *testing.T) {
 		t.Parallel()
 
-		dbFile := setup(t)
-		defer cleanup(t, dbFile)
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
 
-		// data
-		const reducedSearchMinLength = 10
+		paths := []string{filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")}
+		for _, filePath := range paths {
+			require.NoError(t, os.WriteFile(filePath, []byte("same"), 0o644))
+		}
 
-		// setup
 		output := NewTestOutput(t, nil)
 
 		// execute
-		err := DuplicateCommand(output, dbFile, reducedSearchMinLength)
+		// - first phase: stat only
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{NoHash: true})
+		require.NoError(t, err)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		// - second phase: hash missing
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{HashMissing: true})
 		require.NoError(t, err)
 
 		// verify
-		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Search term\n", output.Get(4))
-		assert.Contains(t, cleanColor(t, output.Get(5)), files[3])
-		assert.Contains(t, cleanColor(t, output.Get(6)), files[0])
+		// - first phase
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 2 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+		assert.True(t, strings.HasPrefix(output.Get(1), "Scanned 2 files (0 B hashed)"), output.Get(1))
+		for _, filePath := range paths {
+			assert.Empty(t, db.Files[ID(filePath)].Hash)
+			assert.Equal(t, 4, db.Files[ID(filePath)].Size)
+		}
+		assert.Empty(t, db.Hashes)
+
+		// - second phase
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 0 skipped, 0 created, 2 updated, 0 renamed, 0 deleted\n", root), output.Get(2))
+
+		db = NewDB(output, dbFile)
+		db.Load()
+
+		expectedHash, err := hashFile(paths[0], MB, samplePositionHead)
+		require.NoError(t, err)
+		for _, filePath := range paths {
+			assert.Equal(t, expectedHash, db.Files[ID(filePath)].Hash)
+		}
+		assert.Len(t, db.Hashes[expectedHash], 2)
 	})
+}
 
-	t.Run("failure deleting non-existent file", func(t *testing.T) {
-		t.Parallel()
+func TestApp_Scan_Rename(t *testing.T) {
+	t.Parallel()
 
-		dbFile := setup(t)
-		defer cleanup(t, dbFile)
+	// setup
+	root := t.TempDir()
+	dbFile := filepath.Join(t.TempDir(), "db.csv")
+	require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
 
-		// setup
-		output := NewTestOutput(t, []string{"1"})
+	oldPath := filepath.Join(root, "old", "photo.jpg")
+	newPath := filepath.Join(root, "new", "photo.jpg")
 
-		// execute
-		err := DuplicateCommand(output, dbFile, defaultMinLength)
-		require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(oldPath), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Dir(newPath), 0o755))
+	require.NoError(t, os.WriteFile(oldPath, []byte("photo"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "old", "other.jpg"), []byte("other"), 0o644))
 
-		// verify
-		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
-		assert.Contains(t, output.Get(1), files[2])
-		assert.Contains(t, output.Get(2), files[0])
-	})
+	output := NewTestOutput(t, nil)
 
-	t.Run("success finding and delete duplicates by size and hashes", func(t *testing.T) {
-		t.Parallel()
+	err := ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+	require.NoError(t, err)
 
-		dbFile := setup(t)
-		defer cleanup(t, dbFile)
+	err = TagCommand(output, dbFile, oldPath, []string{"holiday"})
+	require.NoError(t, err)
 
-		// setup
-		err := os.WriteFile(files[0], nil, 0o644)
-		require.NoError(t, err)
+	err = CanonicalCommand(output, dbFile, oldPath, true)
+	require.NoError(t, err)
 
-		output := NewTestOutput(t, []string{"2"})
+	require.NoError(t, os.Rename(oldPath, newPath))
+	require.NoError(t, os.Remove(filepath.Join(root, "old", "other.jpg")))
 
-		// execute
-		err = DuplicateCommand(output, dbFile, defaultMinLength)
-		require.NoError(t, err)
+	// execute
+	err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+	require.NoError(t, err)
 
-		// verify
-		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
-		assert.Contains(t, output.Get(1), files[2])
-		assert.Contains(t, output.Get(2), files[0])
-		assert.Equal(t, "Delete any files? (comma separated list of numbers)\n", output.Get(3))
-		assert.Contains(t, output.Get(4), "Deleting")
-		assert.Contains(t, output.Get(4), files[0])
+	// verify
+	assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 0 created, 0 updated, 1 renamed, 1 deleted\n", root), output.Get(2))
 
-		assert.NoFileExists(t, files[2])
-	})
+	db := NewDB(output, dbFile)
+	db.Load()
+
+	assert.NotContains(t, db.Files, ID(oldPath))
+	assert.Equal(t, []string{"holiday"}, db.Files[ID(newPath)].Tags)
+	assert.True(t, db.Files[ID(newPath)].Canonical)
+	assert.Equal(t, []ID{ID(newPath)}, db.Tags["holiday"])
 }
 
-func TestApp_Search(t *testing.T) {
+func TestApp_Watch_Poll(t *testing.T) {
 	t.Parallel()
 
-	files := []string{
-		"bambam/foo-756381984.txt",
-		"bambam/bar-1786396036.txt",
-		"bambam/baz.txt",
-		"bambam/quix-1786396036.txt",
-	}
+	t.Run("success picking up files added between polls", func(t *testing.T) {
+		t.Parallel()
 
-	setup := func(t *testing.T) string {
-		t.Helper()
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644))
 
-		random := fmt.Sprintf("%f", rand.ExpFloat64())
+		output := NewTestOutput(t, nil)
 
-		lines := []string{
-			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[0]),
-			fmt.Sprintf("%s,1786396036,4d09a656f20fee1beb093f30c7ec504c\n", files[1]),
-			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[2]),
-			fmt.Sprintf("%s,123,788b62828f73d4bac70088ea91c90ef5\n", files[3]),
-		}
+		ctx, cancel := context.WithCancel(context.Background())
+		ticks := make(chan time.Time)
+		done := make(chan struct{})
 
-		dbFile := fmt.Sprintf("_test_%s.csv", random)
+		scanned := func(n int) func() bool {
+			return func() bool {
+				return strings.Count(output.String(), "root: "+root) == n
+			}
+		}
 
-		err := os.WriteFile(dbFile, []byte(strings.Join(lines, "\n")), 0o644)
-		require.NoError(t, err)
+		// execute
+		go func() {
+			pollScans(ctx, output, dbFile, []string{root}, ticks)
+			close(done)
+		}()
 
-		return dbFile
-	}
+		require.Eventually(t, scanned(1), 5*time.Second, 10*time.Millisecond)
 
-	cleanup := func(t *testing.T, dbFile string) {
-		t.Helper()
+		require.NoError(t, os.WriteFile(filepath.Join(root, "b.txt"), []byte("b"), 0o644))
 
-		err := os.Remove(dbFile)
-		require.NoError(t, err)
-	}
+		// - the tick is only received once the first poll finished
+		ticks <- time.Now()
 
-	clearColors := func(t *testing.T, str string) string {
-		t.Helper()
+		require.Eventually(t, scanned(2), 5*time.Second, 10*time.Millisecond)
 
-		str = strings.ReplaceAll(str, redBold, "")
-		str = strings.ReplaceAll(str, yellowBold, "")
-		str = strings.ReplaceAll(str, blueBold, "")
-		str = strings.ReplaceAll(str, reset, "")
+		cancel()
+		<-done
 
-		return str
-	}
+		// verify
+		content := output.String()
+		assert.Contains(t, content, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", root))
+		assert.Contains(t, content, fmt.Sprintf("root: %s, 2 found files, 1 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", root))
+		assert.Contains(t, content, "Poll 2 at ")
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+		assert.Contains(t, db.Files, ID(filepath.Join(root, "b.txt")))
+	})
 
-	t.Run("success searching by term - fast", func(t *testing.T) {
+	t.Run("success going on after skipped and failed polls", func(t *testing.T) {
 		t.Parallel()
 
-		dbFile := setup(t)
-		defer cleanup(t, dbFile)
+		if !dbLockSupported {
+			t.Skip("locking the DB is not supported on this platform")
+		}
 
 		// setup
-		output := NewTestOutput(t, nil)
+		root := t.TempDir()
+		missing := filepath.Join(t.TempDir(), "unmounted")
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, []byte("\"broken\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644))
 
-		// execute
-		err := TermSearchCommand(output, dbFile, fast, []string{"1786396036.txt"})
+		unlock, err := lockFile(dbFile + lockFileSuffix)
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ticks := make(chan time.Time)
+		done := make(chan struct{})
+
+		printed := func(message string) func() bool {
+			return func() bool {
+				return strings.Contains(output.String(), message)
+			}
+		}
+
+		// execute
+		go func() {
+			pollScans(ctx, output, dbFile, []string{root, missing}, ticks)
+			close(done)
+		}()
+
+		// - the DB is in use by another process
+		require.Eventually(t, printed("skipping this poll"), 5*time.Second, 10*time.Millisecond)
+
+		unlock()
+		ticks <- time.Now()
+
+		// - the DB can't be read
+		require.Eventually(t, printed("Error reading DB"), 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+		ticks <- time.Now()
+
+		require.Eventually(t, printed("root: "+root), 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		<-done
+
+		// verify
+		content := output.String()
+		assert.Contains(t, content, fmt.Sprintf("The DB %s is in use by another process, skipping this poll\n", dbFile))
+		assert.Contains(t, content, "Skipping missing root: "+missing+"\n")
+		assert.Contains(t, content, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", root))
+		assert.Contains(t, content, "Poll 3 at ")
+		assert.NotContains(t, content, "root: "+missing+",")
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+		assert.Contains(t, db.Files, ID(filepath.Join(root, "a.txt")))
+	})
+
+	t.Run("fail without polling", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := WatchCommand(output, writeTestDB(t, nil), []string{t.TempDir()}, WatchOptions{Interval: time.Minute})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Only watching by polling is supported, use --poll\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Scan_Sparse(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("sparse files are only detected on Unix-like systems")
+	}
+
+	t.Run("success flagging sparse files and reporting their disk usage", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		sparsePath := filepath.Join(root, "disk-image.img")
+		file, err := os.Create(sparsePath)
+		require.NoError(t, err)
+		_, err = file.WriteAt([]byte("end"), 64*MB)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		fileInfo, err := os.Stat(sparsePath)
+		require.NoError(t, err)
+
+		usage, ok := diskUsage(fileInfo)
+		if !ok || usage >= fileInfo.Size() {
+			t.Skip("the file system doesn't support sparse files")
+		}
+
+		densePath := filepath.Join(root, "notes.txt")
+		require.NoError(t, os.WriteFile(densePath, bytes.Repeat([]byte("a"), 10000), 0o644))
+
+		// execute
+		err = ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.True(t, db.Files[ID(sparsePath)].Sparse)
+		assert.Equal(t, int(usage), db.Files[ID(sparsePath)].DiskSize)
+		assert.False(t, db.Files[ID(densePath)].Sparse)
+
+		output := NewTestOutput(t, nil)
+
+		err = StatsCommand(output, dbFile, defaultMinLength, 0, "")
+		require.NoError(t, err)
+
+		assert.Contains(t, output.String(), fmt.Sprintf("Sparse files: 1 (64.0 MB logical, %s on disk)\n", formatBytes(usage)))
+	})
+}
+
+func TestApp_Scan_TreeHash(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success tree hashing and verifying large files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		// The files only differ after the first chunk, so sample hashes would consider them duplicates
+		content := bytes.Repeat([]byte("a"), treeHashChunkSize+10)
+		pathA := filepath.Join(root, "movie-a.mkv")
+		pathB := filepath.Join(root, "movie-b.mkv")
+		pathC := filepath.Join(root, "movie-c.mkv")
+		require.NoError(t, os.WriteFile(pathA, content, 0o644))
+		require.NoError(t, os.WriteFile(pathB, content, 0o644))
+		require.NoError(t, os.WriteFile(pathC, append(bytes.Repeat([]byte("a"), treeHashChunkSize), []byte("bbbbbbbbbb")...), 0o644))
+
+		// execute
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{TreeHash: true})
+		require.NoError(t, err)
+
+		// verify
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		recordA, recordB, recordC := db.Files[ID(pathA)], db.Files[ID(pathB)], db.Files[ID(pathC)]
+		assert.Equal(t, hashModeTree, recordA.HashMode)
+		assert.Equal(t, recordA.Hash, recordB.Hash)
+		assert.NotEqual(t, recordA.Hash, recordC.Hash)
+		assert.NotEqual(t, md5Hex(content[:MB]), recordA.Hash)
+
+		output := NewTestOutput(t, nil)
+
+		err = VerifyCommand(output, dbFile, VerifyOptions{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "Verified 3 files: 3 ok, 0 mismatched, 0 missing, 0 skipped\n", output.Get(0))
+	})
+
+	t.Run("failure combining with a sample position", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{t.TempDir()}, ScanOptions{TreeHash: true, SamplePosition: samplePositionTail})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "The tree hash covers the whole file, it can't be combined with --sample-position\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func Test_treeHashFile(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dir := t.TempDir()
+	content := make([]byte, 2*treeHashChunkSize+123)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	path := filepath.Join(dir, "large.bin")
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+
+	changed := slices.Clone(content)
+	changed[len(changed)-1]++
+
+	changedPath := filepath.Join(dir, "changed.bin")
+	require.NoError(t, os.WriteFile(changedPath, changed, 0o644))
+
+	// execute
+	first, err := treeHashFile(path, hashAlgoMD5, nil)
+	require.NoError(t, err)
+
+	second, err := treeHashFile(path, hashAlgoMD5, nil)
+	require.NoError(t, err)
+
+	other, err := treeHashFile(changedPath, hashAlgoMD5, nil)
+	require.NoError(t, err)
+
+	sha, err := treeHashFile(path, hashAlgoSHA256, nil)
+	require.NoError(t, err)
+
+	// verify
+	chunkHashes := ""
+	for offset := 0; offset < len(content); offset += treeHashChunkSize {
+		chunk := content[offset:min(offset+treeHashChunkSize, len(content))]
+		chunkHashes += md5Hex(append([]byte{0}, chunk...))
+	}
+
+	assert.Equal(t, md5Hex([]byte("\x01"+chunkHashes)), first)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+	assert.Len(t, sha, 64)
+}
+
+func TestApp_Scan_StorePerms(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits and owners are only stored on Unix-like systems")
+	}
+
+	t.Run("success storing and showing permission bits and owner", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		path := filepath.Join(root, "secret-notes.txt")
+		require.NoError(t, os.WriteFile(path, []byte("secret"), 0o644))
+		require.NoError(t, os.Chmod(path, 0o640))
+
+		// execute
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{StorePerms: true})
+		require.NoError(t, err)
+
+		// verify
+		owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Equal(t, "0640", db.Files[ID(path)].Mode)
+		assert.Equal(t, owner, db.Files[ID(path)].Owner)
+
+		output := NewTestOutput(t, nil)
+
+		err = TermSearchCommand(output, dbFile, SearchOptions{ShowPerms: true}, []string{"secret"})
+		require.NoError(t, err)
+
+		assert.Equal(t, fmt.Sprintf("[1] %s (0 MB) [-rw-r----- %s]\n", path, owner), stripColors(output.Get(0)))
+	})
+
+	t.Run("success showing unknown permissions of older records", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/secret-notes.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{ShowPerms: true}, []string{"secret"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "[1] a/secret-notes.txt (0 MB) [perms unknown]\n", stripColors(output.Get(0)))
+	})
+}
+
+func TestApp_Scan_Locked(t *testing.T) {
+	t.Parallel()
+
+	if !dbLockSupported {
+		t.Skip("locking the DB is not supported on this platform")
+	}
+
+	// setup
+	root := t.TempDir()
+	dbFile := filepath.Join(t.TempDir(), "db.csv")
+	require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644))
+
+	unlock, err := lockFile(dbFile + lockFileSuffix)
+	require.NoError(t, err)
+
+	output := NewTestOutput(t, nil).RecordExit()
+
+	// execute
+	err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+	require.NoError(t, err)
+
+	// verify
+	assert.Equal(t, fmt.Sprintf("The DB %s is in use by another process, try again later\n", dbFile), output.Get(0))
+	assert.Equal(t, 1, output.exitCode)
+
+	db := NewDB(NewTestOutput(t, nil), dbFile)
+	db.Load()
+	assert.Empty(t, db.Files)
+
+	// execute
+	unlock()
+
+	output = NewTestOutput(t, nil).RecordExit()
+	err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+	require.NoError(t, err)
+
+	// verify
+	assert.Equal(t, 0, output.exitCode)
+
+	db = NewDB(NewTestOutput(t, nil), dbFile)
+	db.Load()
+	assert.Len(t, db.Files, 1)
+}
+
+func TestApp_Scan_Resume(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success re-hashing only changed files after an interrupted scan", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o644))
+		}
+
+		output := NewTestOutput(t, nil)
+
+		// the scan is interrupted before the final write, only the periodic flushes reach the disk
+		interrupted := NewDB(output, dbFile)
+		interrupted.Load()
+		require.NoError(t, interrupted.Scan(ScanOptions{FlushEvery: 1}, root))
+
+		changed := filepath.Join(root, "b.txt")
+		require.NoError(t, os.WriteFile(changed, []byte("changed content"), 0o644))
+		later := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(changed, later, later))
+
+		output = NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{Resume: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.String(), "3 found files, 2 skipped, 0 created, 1 updated")
+		assert.Contains(t, output.String(), "(15 B hashed)")
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		assert.Equal(t, 15, db.Files[ID(changed)].Size)
+	})
+}
+
+func TestApp_Scan_Root(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success storing the scan root", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		roots := []string{t.TempDir(), t.TempDir()}
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		for _, root := range roots {
+			require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte(root), 0o644))
+		}
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, roots, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		for _, root := range roots {
+			assert.Equal(t, root, db.Files[ID(filepath.Join(root, "sub", "a.txt"))].Root)
+		}
+
+		require.NoError(t, db.Write())
+
+		db = NewDB(output, dbFile)
+		db.Load()
+
+		for _, root := range roots {
+			assert.Equal(t, root, db.Files[ID(filepath.Join(root, "sub", "a.txt"))].Root)
+		}
+	})
+
+	t.Run("success back-filling missing roots from the meta file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"/driveA/photos/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/driveA/other/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"/driveB/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+		require.NoError(t, os.WriteFile(dbFile+metaFileSuffix, []byte("/driveA,2024-01-01T00:00:00Z\n/driveA/photos,2024-01-01T00:00:00Z\n"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		// verify
+		assert.Equal(t, "/driveA/photos", db.Files["/driveA/photos/foo.txt"].Root)
+		assert.Equal(t, "/driveA", db.Files["/driveA/other/bar.txt"].Root)
+		assert.Empty(t, db.Files["/driveB/baz.txt"].Root)
+	})
+}
+
+func TestApp_Scan_Artifacts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success excluding the DB file and its meta file inside the scanned root", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(root, "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "foo.txt"), []byte("foo"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		// - the second scan would find the meta file written by the first one
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.FileExists(t, dbFile+metaFileSuffix)
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 1 skipped, 0 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(2))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 1)
+		assert.Contains(t, db.Files, ID(filepath.Join(root, "foo.txt")))
+	})
+
+	t.Run("success excluding the history file inside the scanned root", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(root, "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "foo.txt"), []byte("foo"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		err = SnapshotCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// execute
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.FileExists(t, dbFile+historyFileSuffix)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 1)
+		assert.NotContains(t, db.Files, ID(dbFile+historyFileSuffix))
+	})
+
+	t.Run("success excluding the files and directories written by the commands inside the scanned root", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(root, "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		for _, dir := range []string{"a", "b"} {
+			require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, dir, "photo.jpg"), []byte("photo"), 0o644))
+		}
+
+		output := NewTestOutput(t, nil)
+
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{MoveTo: filepath.Join(root, "quarantine")})
+		require.NoError(t, err)
+
+		err = StatsCommand(output, dbFile, 0, 0, filepath.Join(root, "metrics.csv"))
+		require.NoError(t, err)
+
+		// execute
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.FileExists(t, filepath.Join(root, "metrics.csv"))
+		assert.DirExists(t, filepath.Join(root, "quarantine"))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		assert.Equal(t, []ID{ID(filepath.Join(root, "a", "photo.jpg"))}, slices.Collect(maps.Keys(db.Files)))
+	})
+}
+
+func TestApp_Scan_InspectArchives(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (string, string, string) {
+		t.Helper()
+
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		// - a plain copy of one of the archive entries
+		require.NoError(t, os.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0o644))
+
+		archivePath := filepath.Join(root, "backup.zip")
+		f, err := os.Create(archivePath)
+		require.NoError(t, err)
+
+		zw := zip.NewWriter(f)
+		_, err = zw.Create("inner/")
+		require.NoError(t, err)
+		for name, content := range map[string]string{"inner/notes.txt": "notes", "todo.txt": "todo list"} {
+			w, err := zw.Create(name)
+			require.NoError(t, err)
+			_, err = w.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+		require.NoError(t, f.Close())
+
+		return root, dbFile, archivePath
+	}
+
+	t.Run("success cataloging archive entries", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile, archivePath := setup(t)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{InspectArchives: true})
+		require.NoError(t, err)
+
+		// verify
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		require.Len(t, db.Files, 4)
+
+		entry := db.Files[ID(archivePath+"::inner/notes.txt")]
+		assert.Equal(t, 5, entry.Size)
+		assert.Equal(t, db.Files[ID(filepath.Join(root, "notes.txt"))].Hash, entry.Hash)
+		assert.Equal(t, 9, db.Files[ID(archivePath+"::todo.txt")].Size)
+		assert.Contains(t, db.SearchTerms["todo.txt"], ID(archivePath+"::todo.txt"))
+	})
+
+	t.Run("success keeping archive entries until the archive is removed", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile, archivePath := setup(t)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{InspectArchives: true})
+		require.NoError(t, err)
+
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 4)
+
+		require.NoError(t, os.Remove(archivePath))
+
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		db = NewDB(output, dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 1)
+	})
+
+	t.Run("success ignoring archive contents by default", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile, _ := setup(t)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 2)
+	})
+
+	t.Run("success inspecting archives catalogued before inspecting was turned on", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile, archivePath := setup(t)
+
+		output := NewTestOutput(t, nil)
+
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// execute
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{InspectArchives: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 2 found files, 1 skipped, 0 created, 1 updated, 0 renamed, 0 deleted\n", root), output.Get(2))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 4)
+		assert.Contains(t, db.Files, ID(archivePath+"::todo.txt"))
+	})
+
+	t.Run("success keeping files with the separator in their names", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("colons are not allowed in file names on Windows")
+		}
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		filePath := filepath.Join(root, "notes::draft.txt")
+		require.NoError(t, os.WriteFile(filePath, []byte("draft"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{InspectArchives: true})
+		require.NoError(t, err)
+
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 1 skipped, 0 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(2))
+		assert.False(t, isArchiveEntry(filePath))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.Contains(t, db.Files, ID(filePath))
+	})
+}
+
+func Test_splitArchiveEntry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		path        string
+		wantArchive string
+		wantEntry   string
+		wantOK      bool
+	}{
+		{name: "entry of an archive", path: "a/backup.zip::inner/notes.txt", wantArchive: "a/backup.zip", wantEntry: "inner/notes.txt", wantOK: true},
+		{name: "archive in a directory containing the separator", path: "a::b/backup.tar.gz::notes.txt", wantArchive: "a::b/backup.tar.gz", wantEntry: "notes.txt", wantOK: true},
+		{name: "file containing the separator", path: "a/notes::draft.txt", wantArchive: "a/notes::draft.txt"},
+		{name: "plain file", path: "a/notes.txt", wantArchive: "a/notes.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			archive, entry, ok := splitArchiveEntry(tt.path)
+
+			// verify
+			assert.Equal(t, tt.wantArchive, archive)
+			assert.Equal(t, tt.wantEntry, entry)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
+
+func TestApp_Scan_MinTermLength(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success dropping short search terms from the index", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a-bb-holiday.jpg"), []byte("photo"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{MinTermLength: 3})
+		require.NoError(t, err)
+
+		// verify
+		// - the setting is stored, so that loading the DB keeps the short terms out of the index
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		assert.NotContains(t, db.SearchTerms, "a")
+		assert.NotContains(t, db.SearchTerms, "bb")
+		assert.Contains(t, db.SearchTerms, "holiday.jpg")
+		assert.Equal(t, []string{"holiday.jpg"}, db.Files[ID(filepath.Join(root, "a-bb-holiday.jpg"))].SearchTerms)
+	})
+
+	t.Run("success restoring short search terms when lowering the limit", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a-bb-holiday.jpg"), []byte("photo"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{MinTermLength: 3})
+		require.NoError(t, err)
+
+		// execute
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{MinTermLength: 2})
+		require.NoError(t, err)
+
+		// verify
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		assert.NotContains(t, db.SearchTerms, "a")
+		assert.Contains(t, db.SearchTerms, "bb")
+	})
+}
+
+func TestApp_Scan_Hidden(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (string, string) {
+		t.Helper()
+
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, ".git", "config"), []byte("config"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, ".DS_Store"), []byte("store"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "visible.txt"), []byte("visible"), 0o644))
+
+		return root, dbFile
+	}
+
+	t.Run("success skipping hidden files and directories by default", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+	})
+
+	t.Run("success including hidden files and directories", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{IncludeHidden: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 3 found files, 0 skipped, 3 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+	})
+
+	t.Run("success scanning a hidden root", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{filepath.Join(root, ".git")}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", filepath.Join(root, ".git")), output.Get(0))
+	})
+
+	t.Run("success keeping hidden files catalogued earlier", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile := setup(t)
+
+		// setup
+		// - the catalog was made including hidden files, e.g. before they were skipped by default
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{IncludeHidden: true})
+		require.NoError(t, err)
+
+		err = TagCommand(NewTestOutput(t, nil), dbFile, filepath.Join(root, ".DS_Store"), []string{"keep"})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = ScanCommand(output, dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 1 skipped, 0 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 3)
+		assert.Equal(t, []string{"keep"}, db.Files[ID(filepath.Join(root, ".DS_Store"))].Tags)
+		assert.Contains(t, db.Files, ID(filepath.Join(root, ".git", "config")))
+	})
+}
+
+func TestApp_Scan_Parallel(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	roots := []string{t.TempDir(), t.TempDir()}
+	for _, root := range roots {
+		for i := range 20 {
+			err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file-%d.txt", i)), []byte(fmt.Sprintf("%s-%d", root, i)), 0o644)
+			require.NoError(t, err)
+		}
+	}
+
+	dbFile := filepath.Join(t.TempDir(), "db.csv")
+	require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+	output := NewTestOutput(t, nil)
+
+	// execute
+	err := ScanCommand(output, dbFile, roots, ScanOptions{Parallel: true})
+	require.NoError(t, err)
+
+	// verify
+	summaries := []string{output.Get(0), output.Get(1)}
+	for _, root := range roots {
+		assert.Contains(t, summaries, fmt.Sprintf("root: %s, 20 found files, 0 skipped, 20 created, 0 updated, 0 renamed, 0 deleted\n", root))
+	}
+	assert.True(t, strings.HasPrefix(output.Get(2), "Scanned 40 files ("))
+
+	db := NewDB(output, dbFile)
+	db.Load()
+	assert.Len(t, db.Files, 40)
+	assert.Len(t, db.LastScans, 2)
+}
+
+func TestApp_Scan_SiblingRoots(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (string, string) {
+		t.Helper()
+
+		base := t.TempDir()
+		for _, dir := range []string{"x", "x10"} {
+			require.NoError(t, os.Mkdir(filepath.Join(base, dir), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(base, dir, dir+".txt"), []byte(dir), 0o644))
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		return base, dbFile
+	}
+
+	t.Run("success keeping the files of a root sharing the prefix of the scanned root", func(t *testing.T) {
+		t.Parallel()
+
+		base, dbFile := setup(t)
+
+		// setup
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{filepath.Join(base, "x10")}, ScanOptions{})
+		require.NoError(t, err)
+
+		err = TagCommand(NewTestOutput(t, nil), dbFile, filepath.Join(base, "x10", "x10.txt"), []string{"keep"})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = ScanCommand(output, dbFile, []string{filepath.Join(base, "x")}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", filepath.Join(base, "x")), output.Get(0))
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 2)
+		assert.Equal(t, []string{"keep"}, db.Files[ID(filepath.Join(base, "x10", "x10.txt"))].Tags)
+	})
+
+	t.Run("success scanning roots sharing a prefix in parallel", func(t *testing.T) {
+		t.Parallel()
+
+		base, dbFile := setup(t)
+
+		// setup
+		roots := []string{filepath.Join(base, "x"), filepath.Join(base, "x10")}
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, roots, ScanOptions{Parallel: true})
+		require.NoError(t, err)
+
+		// verify
+		summaries := []string{output.Get(0), output.Get(1)}
+		for _, root := range roots {
+			assert.Contains(t, summaries, fmt.Sprintf("root: %s, 1 found files, 0 skipped, 1 created, 0 updated, 0 renamed, 0 deleted\n", root))
+		}
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 2)
+	})
+}
+
+func TestApp_Scan_GlobRoots(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success expanding a pattern matching multiple directories", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		base := t.TempDir()
+		for _, dir := range []string{"drive1", "drive2", "other"} {
+			photos := filepath.Join(base, dir, "Photos")
+			require.NoError(t, os.MkdirAll(photos, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(photos, "photo.jpg"), []byte(dir), 0o644))
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{filepath.Join(base, "drive*", "Photos")}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 0, output.exitCode)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 2)
+		assert.Contains(t, db.Files, ID(filepath.Join(base, "drive1", "Photos", "photo.jpg")))
+		assert.Contains(t, db.Files, ID(filepath.Join(base, "drive2", "Photos", "photo.jpg")))
+		assert.Len(t, db.LastScans, 2)
+	})
+
+	t.Run("success rescanning matches sharing a prefix", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		base := t.TempDir()
+		for _, dir := range []string{"drive1", "drive10"} {
+			require.NoError(t, os.Mkdir(filepath.Join(base, dir), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(base, dir, "photo.jpg"), []byte(dir), 0o644))
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		pattern := filepath.Join(base, "drive*")
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{pattern}, ScanOptions{})
+		require.NoError(t, err)
+
+		err = TagCommand(NewTestOutput(t, nil), dbFile, filepath.Join(base, "drive10", "photo.jpg"), []string{"keep"})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		// - drive1 is scanned first, its files must not include the ones of drive10
+		err = ScanCommand(output, dbFile, []string{pattern}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		for i, dir := range []string{"drive1", "drive10"} {
+			assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 1 skipped, 0 created, 0 updated, 0 renamed, 0 deleted\n", filepath.Join(base, dir)), output.Get(i))
+		}
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 2)
+		assert.Equal(t, []string{"keep"}, db.Files[ID(filepath.Join(base, "drive10", "photo.jpg"))].Tags)
+	})
+
+	t.Run("success keeping an existing path containing wildcards", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		base := t.TempDir()
+		for _, dir := range []string{"Photos [2024]", "Photos 2"} {
+			require.NoError(t, os.Mkdir(filepath.Join(base, dir), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(base, dir, "photo.jpg"), []byte(dir), 0o644))
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		// - as a pattern, the brackets would match "Photos 2" instead
+		err := ScanCommand(output, dbFile, []string{filepath.Join(base, "Photos [2024]")}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 0, output.exitCode)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 1)
+		assert.Contains(t, db.Files, ID(filepath.Join(base, "Photos [2024]", "photo.jpg")))
+	})
+
+	t.Run("fail on a pattern matching nothing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		base := t.TempDir()
+
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{filepath.Join(base, "drive*")}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Error expanding roots: root pattern '%s' matches nothing\n", filepath.Join(base, "drive*")), output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Scan_ExcludeRoot(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	root := t.TempDir()
+	for _, path := range []string{"keep.txt", "tmp/cache/skip.txt", "tmp/skip.txt", "tmp2/keep.txt", "sub/keep.txt"} {
+		fullPath := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0o755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(path), 0o644))
+	}
+
+	dbFile := filepath.Join(t.TempDir(), "db.csv")
+	require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+	output := NewTestOutput(t, nil)
+
+	// execute
+	err := ScanCommand(output, dbFile, []string{root}, ScanOptions{ExcludeRoots: []string{filepath.Join(root, "tmp")}})
+	require.NoError(t, err)
+
+	// verify
+	db := NewDB(output, dbFile)
+	db.Load()
+
+	// - tmp2 only shares a prefix with the excluded root, it is not inside of it
+	paths := slices.Sorted(maps.Keys(db.Files))
+	assert.Equal(t, []ID{
+		ID(filepath.Join(root, "keep.txt")),
+		ID(filepath.Join(root, "sub", "keep.txt")),
+		ID(filepath.Join(root, "tmp2", "keep.txt")),
+	}, paths)
+}
+
+func TestDB_hashSample_ReusedBuffers(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dir := t.TempDir()
+	large := filepath.Join(dir, "large.bin")
+	small := filepath.Join(dir, "small.txt")
+
+	require.NoError(t, os.WriteFile(large, bytes.Repeat([]byte{0xff}, 2*MB), 0o644))
+	require.NoError(t, os.WriteFile(small, []byte("small"), 0o644))
+
+	db := NewDB(NewTestOutput(t, nil), "")
+
+	// execute
+	// - the small file is hashed after the large one, possibly reusing its buffer
+	_, _, err := db.hashSample(large, 2*MB, ScanOptions{})
+	require.NoError(t, err)
+
+	hash, _, err := db.hashSample(small, 5, ScanOptions{})
+	require.NoError(t, err)
+
+	// verify
+	assert.Equal(t, md5Hex([]byte("small")), hash)
+}
+
+func BenchmarkDB_hashSample(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "large.bin")
+	require.NoError(b, os.WriteFile(path, bytes.Repeat([]byte("0123456789abcdef"), 2*MB/16), 0o644))
+
+	db := NewDB(NewStdOut(), "")
+
+	b.Run("pooled buffers", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for range b.N {
+			_, _, err := db.hashSample(path, 2*MB, ScanOptions{})
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("fresh buffers", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for range b.N {
+			_, err := hashFile(path, MB, samplePositionHead)
+			require.NoError(b, err)
+		}
+	})
+}
+
+func TestApp_Scan_SamplePosition(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	// - two large files with identical beginnings, but different endings
+	setup := func(t *testing.T) (string, string, []string) {
+		t.Helper()
+
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		var paths []string
+		for _, ending := range []string{"first", "second"} {
+			path := filepath.Join(root, ending+".bin")
+			content := append(make([]byte, 2*MB), []byte(ending)...)
+			require.NoError(t, os.WriteFile(path, content, 0o644))
+
+			paths = append(paths, path)
+		}
+
+		return root, dbFile, paths
+	}
+
+	for _, tc := range []struct {
+		position   string
+		sameHashes bool
+	}{
+		{position: samplePositionHead, sameHashes: true},
+		{position: samplePositionTail, sameHashes: false},
+		{position: samplePositionBoth, sameHashes: false},
+	} {
+		t.Run("success hashing "+tc.position+" samples", func(t *testing.T) {
+			t.Parallel()
+
+			root, dbFile, paths := setup(t)
+
+			output := NewTestOutput(t, nil)
+
+			// execute
+			err := ScanCommand(output, dbFile, []string{root}, ScanOptions{SamplePosition: tc.position})
+			require.NoError(t, err)
+
+			// verify
+			db := NewDB(output, dbFile)
+			db.Load()
+
+			first, second := db.Files[ID(paths[0])], db.Files[ID(paths[1])]
+			assert.Equal(t, tc.sameHashes, first.Hash == second.Hash)
+			assert.Equal(t, samplePosition(int64(first.Size), tc.position), first.SamplePosition)
+
+			expectedHash, err := hashFile(paths[0], MB, tc.position)
+			require.NoError(t, err)
+			assert.Equal(t, expectedHash, first.Hash)
+		})
+	}
+
+	t.Run("failure with unknown sample position", func(t *testing.T) {
+		t.Parallel()
+
+		root, dbFile, _ := setup(t)
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{SamplePosition: "middle"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 1, output.exitCode)
+		assert.Equal(t, "Unknown sample position: middle\n", output.Get(0))
+	})
+}
+
+func TestApp_Scan_UnreadableDirectory(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success reporting unreadable directory and keeping its records", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+			t.Skip("unreadable directories can only be tested on Unix as a non-root user")
+		}
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		locked := filepath.Join(root, "locked")
+		require.NoError(t, os.Mkdir(locked, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(locked, "secret.txt"), []byte("secret"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "public.txt"), []byte("public"), 0o644))
+
+		require.NoError(t, ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{}))
+
+		require.NoError(t, os.Chmod(locked, 0o000))
+		t.Cleanup(func() {
+			_ = os.Chmod(locked, 0o755)
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{root}, ScanOptions{Verbose: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("root: %s, 1 found files, 1 skipped, 0 created, 0 updated, 0 renamed, 0 deleted\n", root), output.Get(0))
+		assert.Equal(t, "1 paths could not be read\n", output.Get(1))
+		assert.Contains(t, output.Get(2), locked)
+	})
+
+	t.Run("success keeping the records under a path failing with an IO error", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"root/broken/a.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"root/gone.txt,100,0cc175b9c0f1b6a831c399e269772661",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		walkErrors := []walkError{{path: "root/broken", err: syscall.EIO}}
+
+		// execute
+		db.handleMatches("root", map[string]int64{}, walkErrors, ScanOptions{})
+		db.printWalkErrors(walkErrors, true)
+
+		// verify
+		assert.Equal(t, "root: root, 0 found files, 0 skipped, 0 created, 0 updated, 0 renamed, 1 deleted\n", output.Get(0))
+		assert.Equal(t, "1 paths could not be read\n", output.Get(1))
+		assert.Equal(t, "  - root/broken: input/output error\n", output.Get(2))
+		assert.Contains(t, db.Files, ID("root/broken/a.txt"))
+		assert.NotContains(t, db.Files, ID("root/gone.txt"))
+	})
+}
+
+func TestDB_Write(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (string, *DB) {
+		t.Helper()
+
+		dbFile := writeTestDB(t, []string{"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de"})
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		require.NoError(t, db.add(Record{Path: "b/bar.txt", Size: 200}))
+
+		return dbFile, db
+	}
+
+	t.Run("success writing records sorted by path", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"c/baz.txt,300,788b62828f73d4bac70088ea91c90ef5,,",
+			"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de,,",
+			"b/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c,,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		// execute
+		require.NoError(t, db.Write())
+
+		first, err := os.ReadFile(dbFile)
+		require.NoError(t, err)
+
+		db = NewDB(output, dbFile)
+		db.Load()
+
+		require.NoError(t, db.Write())
+
+		second, err := os.ReadFile(dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, first, second)
+
+		lines := strings.Split(strings.TrimSpace(string(first)), "\n")
+		require.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "a/foo.txt,"))
+		assert.True(t, strings.HasPrefix(lines[1], "b/bar.txt,"))
+		assert.True(t, strings.HasPrefix(lines[2], "c/baz.txt,"))
+	})
+
+	t.Run("success replacing the DB file keeping its permissions", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("permission bits are not supported on Windows")
+		}
+
+		// setup
+		dbFile, db := setup(t)
+		require.NoError(t, os.Chmod(dbFile, 0o600))
+
+		// execute
+		err := db.Write()
+		require.NoError(t, err)
+
+		// verify
+		assert.NoFileExists(t, dbFile+tempFileSuffix)
+
+		info, err := os.Stat(dbFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		content, err := os.ReadFile(dbFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "b/bar.txt,200,")
+	})
+
+	t.Run("success keeping a symlinked DB file", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks require extra privileges on Windows")
+		}
+
+		// setup
+		target, _ := setup(t)
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.Symlink(target, dbFile))
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+		require.NoError(t, db.add(Record{Path: "b/bar.txt", Size: 200}))
+
+		// execute
+		err := db.Write()
+		require.NoError(t, err)
+
+		// verify
+		info, err := os.Lstat(dbFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "b/bar.txt,200,")
+	})
+
+	t.Run("fail keeping the previous DB file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile, db := setup(t)
+
+		original, err := os.ReadFile(dbFile)
+		require.NoError(t, err)
+
+		// - the temporary file can't be created
+		require.NoError(t, os.Mkdir(dbFile+tempFileSuffix, 0o755))
+
+		// execute
+		err = db.Write()
+
+		// verify
+		require.Error(t, err)
+
+		content, err := os.ReadFile(dbFile)
+		require.NoError(t, err)
+		assert.Equal(t, string(original), string(content))
+	})
+}
+
+func Test_sampleIDs(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	ids := make([]ID, 0, 1000)
+	for i := range 1000 {
+		ids = append(ids, ID(fmt.Sprintf("/data/%04d.jpg", i)))
+	}
+
+	// execute
+	sample := sampleIDs(ids, 5, 42)
+
+	// verify
+	assert.Len(t, sample, 50)
+	assert.True(t, slices.IsSorted(sample))
+	assert.Len(t, slices.Compact(slices.Clone(sample)), 50)
+	assert.Equal(t, sample, sampleIDs(ids, 5, 42))
+	assert.NotEqual(t, sample, sampleIDs(ids, 5, 43))
+	assert.Len(t, sampleIDs(ids[:3], 5, 42), 1)
+	assert.Empty(t, sampleIDs(nil, 5, 42))
+}
+
+func TestApp_Verify(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (string, []string) {
+		t.Helper()
+
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		var paths []string
+		for _, fileName := range []string{"a.txt", "b.txt", "c.txt"} {
+			filePath := filepath.Join(root, fileName)
+			require.NoError(t, os.WriteFile(filePath, []byte(fileName), 0o644))
+
+			paths = append(paths, filePath)
+		}
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		return dbFile, paths
+	}
+
+	t.Run("success verifying all files", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile, paths := setup(t)
+
+		// setup
+		require.NoError(t, os.WriteFile(paths[1], []byte("changed"), 0o644))
+		require.NoError(t, os.Remove(paths[2]))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := VerifyCommand(output, dbFile, VerifyOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.Get(0), "Mismatch: "+paths[1])
+		assert.Equal(t, fmt.Sprintf("Missing: %s\n", paths[2]), output.Get(1))
+		assert.Equal(t, "Verified 3 files: 1 ok, 1 mismatched, 1 missing, 0 skipped\n", output.Get(2))
+	})
+
+	t.Run("success resuming verification from checkpoint", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile, paths := setup(t)
+
+		// setup
+		checkpoint := filepath.Join(t.TempDir(), "verify.checkpoint")
+		output := NewTestOutput(t, nil)
+
+		// - an interrupted verification which only got through the first file
+		require.NoError(t, os.WriteFile(checkpoint, []byte(paths[0]+"\n"), 0o644))
+
+		// execute
+		err := VerifyCommand(output, dbFile, VerifyOptions{Checkpoint: checkpoint})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Verified 2 files: 2 ok, 0 mismatched, 0 missing, 1 skipped\n", output.Get(0))
+		assert.NoFileExists(t, checkpoint)
+	})
+
+	t.Run("success verifying a sample of files", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile, _ := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := VerifyCommand(output, dbFile, VerifyOptions{SamplePercent: 40, Seed: 42})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Sampled 1 of 3 files (seed: 42)\n", output.Get(0))
+		assert.Equal(t, "Verified 1 files: 1 ok, 0 mismatched, 0 missing, 0 skipped\n", output.Get(1))
+	})
+
+	t.Run("fail on invalid sample percent", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile, _ := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := VerifyCommand(output, dbFile, VerifyOptions{SamplePercent: 150})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Invalid sample percent: 150\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+
+	t.Run("success rejecting changed files by their stored checksum", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		path := filepath.Join(root, "a.txt")
+		require.NoError(t, os.WriteFile(path, []byte("original"), 0o644))
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{CRC32: true})
+		require.NoError(t, err)
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+		assert.Equal(t, crc32Hex([]byte("original")), db.Files[ID(path)].CRC32)
+
+		require.NoError(t, os.WriteFile(path, []byte("modified"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = VerifyCommand(output, dbFile, VerifyOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Mismatch: %s (stored crc32: %s, actual: %s)\n", path, crc32Hex([]byte("original")), crc32Hex([]byte("modified"))), output.Get(0))
+		assert.Equal(t, "Verified 1 files: 0 ok, 1 mismatched, 0 missing, 0 skipped\n", output.Get(1))
+	})
+
+	t.Run("success checking the stored checksum before the hash", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		path := filepath.Join(root, "a.txt")
+		require.NoError(t, os.WriteFile(path, []byte("original"), 0o644))
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{CRC32: true})
+		require.NoError(t, err)
+
+		// - only the checksum differs, the hash still matches the file
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		record := db.Files[ID(path)]
+		record.CRC32 = "00000000"
+		db.Files[ID(path)] = record
+		require.NoError(t, db.Write())
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = VerifyCommand(output, dbFile, VerifyOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Mismatch: %s (stored crc32: 00000000, actual: %s)\n", path, crc32Hex([]byte("original"))), output.Get(0))
+		assert.Equal(t, "Verified 1 files: 0 ok, 1 mismatched, 0 missing, 0 skipped\n", output.Get(1))
+	})
+
+	t.Run("success reporting hash groups with missing members", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		original := filepath.Join(root, "original.txt")
+		backup := filepath.Join(root, "backup.txt")
+		require.NoError(t, os.WriteFile(original, []byte("same content"), 0o644))
+		require.NoError(t, os.WriteFile(backup, []byte("same content"), 0o644))
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, os.Remove(backup))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = VerifyCommand(output, dbFile, VerifyOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Missing: %s\n", backup), output.Get(0))
+		assert.Equal(t, "Verified 2 files: 1 ok, 0 mismatched, 1 missing, 0 skipped\n", output.Get(1))
+		assert.Contains(t, output.Get(2), "Stale hash group: ")
+		assert.Contains(t, output.Get(2), "(1 missing, 1 present)")
+		assert.Equal(t, fmt.Sprintf("  missing: %s\n", backup), output.Get(3))
+		assert.Equal(t, fmt.Sprintf("  present: %s\n", original), output.Get(4))
+		assert.Equal(t, "1 hash groups have missing members\n", output.Get(5))
+	})
+}
+
+func TestApp_Duplicates(t *testing.T) {
+	t.Parallel()
+
+	files := []string{
+		"bar-1786396036.txt",
+		"bambam/foo-756381984.txt",
+		"bambam/baz.txt",
+		"bambam/quix-1786396036.txt",
+	}
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		random := fmt.Sprintf("%f", rand.ExpFloat64())
+
+		lines := []string{
+			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[0]),
+			fmt.Sprintf("%s,1786396036,4d09a656f20fee1beb093f30c7ec504c\n", files[1]),
+			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[2]),
+			fmt.Sprintf("%s,123,788b62828f73d4bac70088ea91c90ef5\n", files[3]),
+		}
+
+		dbFile := fmt.Sprintf("_test_%s.csv", random)
+
+		err := os.WriteFile(dbFile, []byte(strings.Join(lines, "\n")), 0o644)
+		require.NoError(t, err)
+
+		return dbFile
+	}
+
+	cleanup := func(t *testing.T, dbFile string) {
+		t.Helper()
+
+		err := os.Remove(dbFile)
+		require.NoError(t, err)
+
+		err = os.Remove(dbFile + lockFileSuffix)
+		if !os.IsNotExist(err) {
+			require.NoError(t, err)
+		}
+	}
+
+	cleanColor := func(t *testing.T, str string) string {
+		t.Helper()
+
+		str = strings.ReplaceAll(str, redBold, "")
+		str = strings.ReplaceAll(str, yellowBold, "")
+		str = strings.ReplaceAll(str, blueBold, "")
+		str = strings.ReplaceAll(str, reset, "")
+
+		return str
+	}
+
+	t.Run("success finding duplicates by size and hashes", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
+		assert.Contains(t, output.Get(1), files[2])
+		assert.Contains(t, output.Get(2), files[0])
+	})
+
+	t.Run("success finding duplicates by partial name match", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// data
+		const reducedSearchMinLength = 10
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: reducedSearchMinLength})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Search term\n", output.Get(4))
+		assert.Contains(t, cleanColor(t, output.Get(5)), files[3])
+		assert.Contains(t, cleanColor(t, output.Get(6)), files[0])
+	})
+
+	t.Run("failure deleting non-existent file", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, []string{"1"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
+		assert.Contains(t, output.Get(1), files[2])
+		assert.Contains(t, output.Get(2), files[0])
+	})
+
+	t.Run("success finding and delete duplicates by size and hashes", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		err := os.WriteFile(files[0], nil, 0o644)
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, []string{"2"})
+
+		// execute
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
+		assert.Contains(t, output.Get(1), files[2])
+		assert.Contains(t, output.Get(2), files[0])
+		assert.Equal(t, "Delete any files? (comma separated list of numbers)\n", output.Get(3))
+		assert.Contains(t, output.Get(4), "Deleting")
+		assert.Contains(t, output.Get(4), files[0])
+
+		assert.NoFileExists(t, files[2])
+	})
+
+	t.Run("success limiting displayed files per group", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dir := t.TempDir()
+
+		var lines []string
+		for i := range 4 {
+			filePath := filepath.Join(dir, fmt.Sprintf("copy%d.txt", i))
+			require.NoError(t, os.WriteFile(filePath, nil, 0o644))
+
+			lines = append(lines, fmt.Sprintf("%s,123,788b62828f73d4bac70088ea91c90ef5", filePath))
+		}
+
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, []string{"3,2"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength, LimitPerGroup: 2})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 4 (1 / 1) - Size and hash\n", output.Get(0))
+		assert.Contains(t, output.Get(1), "copy0.txt")
+		assert.Contains(t, output.Get(2), "copy1.txt")
+		assert.Equal(t, "... (showing 2 of 4 files in this group)\n", output.Get(3))
+		assert.Equal(t, "Invalid index: 3, skipping...\n", output.Get(5))
+		assert.Contains(t, output.Get(6), "Deleting")
+		assert.Contains(t, output.Get(6), "copy1.txt")
+
+		assert.FileExists(t, filepath.Join(dir, "copy0.txt"))
+		assert.NoFileExists(t, filepath.Join(dir, "copy1.txt"))
+		assert.FileExists(t, filepath.Join(dir, "copy2.txt"))
+	})
+}
+
+func TestApp_Duplicates_ExactName(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"camera1/IMG_0001.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+			"camera2/IMG_0001.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+			"camera3/img_0001.JPG,300,788b62828f73d4bac70088ea91c90ef5",
+			"camera3/IMG_0002.jpg,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+	}
+
+	t.Run("success grouping identical names", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Exact name\n", output.Get(0))
+		assert.Contains(t, stripColors(output.Get(1)), "camera1/IMG_0001.jpg")
+		assert.Contains(t, stripColors(output.Get(2)), "camera2/IMG_0001.jpg")
+		assert.Equal(t, "Delete any files? (comma separated list of numbers)\n", output.Get(3))
+	})
+
+	t.Run("success grouping identical names ignoring case", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, IgnoreCase: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 3 (1 / 1) - Exact name\n", output.Get(0))
+		assert.Contains(t, stripColors(output.Get(3)), "camera3/img_0001.JPG")
+	})
+
+	t.Run("failure with unknown mode", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: "foo"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 1, output.exitCode)
+		assert.Equal(t, "Unknown duplicate mode: foo\n", output.Get(0))
+	})
+}
+
+func TestApp_Duplicates_Stem(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"export/photo.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+			"backup/photo.jpeg,100,4d09a656f20fee1beb093f30c7ec504c",
+			"backup/Photo.png,100,788b62828f73d4bac70088ea91c90ef5",
+			"backup/photo.gif,200,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+	}
+
+	t.Run("success grouping names differing only in extension", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeStem})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Name without extension and size\n", output.Get(0))
+		assert.Contains(t, stripColors(output.Get(1)), "backup/photo.jpeg")
+		assert.Contains(t, stripColors(output.Get(2)), "export/photo.jpg")
+		assert.Equal(t, "Delete any files? (comma separated list of numbers)\n", output.Get(3))
+	})
+
+	t.Run("success grouping names differing only in extension ignoring case", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeStem, IgnoreCase: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 3 (1 / 1) - Name without extension and size\n", output.Get(0))
+	})
+}
+
+func TestApp_Duplicates_Stat(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success grouping by name, size and modification time", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"nas/a/IMG_0001.jpg,100,,1700000000",
+			"nas/b/IMG_0001.jpg,100,,1700000000",
+			"nas/c/IMG_0001.jpg,100,,1700000001",
+			"nas/d/IMG_0001.jpg,200,,1700000000",
+			"nas/e/IMG_0002.jpg,100,,1700000000",
+			"nas/f/IMG_0001.jpg,100,,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeStat})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Name, size and modification time\n", output.Get(0))
+		assert.Contains(t, stripColors(output.Get(1)), "nas/a/IMG_0001.jpg")
+		assert.Contains(t, stripColors(output.Get(2)), "nas/b/IMG_0001.jpg")
+		assert.Equal(t, "Delete any files? (comma separated list of numbers)\n", output.Get(3))
+	})
+}
+
+func TestApp_Duplicates_Preview(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, name string, content []byte) string {
+		t.Helper()
+
+		root := t.TempDir()
+
+		var lines []string
+		for _, dir := range []string{"a", "b"} {
+			path := filepath.Join(root, dir, name)
+
+			require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+			require.NoError(t, os.WriteFile(path, content, 0o644))
+
+			lines = append(lines, fmt.Sprintf("%s,%d,464f1ce84fed3d6837db4b810462f8de", path, len(content)))
+		}
+
+		return writeTestDB(t, lines)
+	}
+
+	t.Run("success previewing text files", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t, "notes.txt", []byte("first line\nsecond line\nthird line\n"))
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, Preview: 2})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.Get(3), "Preview of [1]")
+		assert.Equal(t, "  | first line\n", output.Get(4))
+		assert.Equal(t, "  | second line\n", output.Get(5))
+		assert.Contains(t, output.Get(6), "Preview of [2]")
+		assert.Equal(t, "  | first line\n", output.Get(7))
+		assert.Equal(t, "  | second line\n", output.Get(8))
+		assert.Equal(t, "Delete any files? (comma separated list of numbers)\n", output.Get(9))
+	})
+
+	t.Run("success previewing binary files as hex dump", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t, "data.bin", []byte{0x00, 0x01, 0x02, 0xff})
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, Preview: 2})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.Get(3), "Preview of [1]")
+		assert.Contains(t, output.Get(4), "00 01 02 ff")
+	})
+}
+
+func TestApp_Duplicates_Trash(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the XDG trash is only tested on Linux")
+	}
+
+	// setup
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+
+	root := t.TempDir()
+
+	var lines []string
+	for _, dir := range []string{"a", "b"} {
+		path := filepath.Join(root, dir, "photo.jpg")
+
+		require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+		lines = append(lines, fmt.Sprintf("%s,5,464f1ce84fed3d6837db4b810462f8de", path))
+	}
+
+	dbFile := writeTestDB(t, lines)
+
+	output := NewTestOutput(t, []string{"1"})
+
+	// execute
+	err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, Trash: true})
+	require.NoError(t, err)
+
+	// verify
+	trashed := filepath.Join(root, "a", "photo.jpg")
+	assert.NoFileExists(t, trashed)
+	assert.FileExists(t, filepath.Join(root, "b", "photo.jpg"))
+	assert.FileExists(t, filepath.Join(home, ".local", "share", "Trash", "files", "photo.jpg"))
+
+	info, err := os.ReadFile(filepath.Join(home, ".local", "share", "Trash", "info", "photo.jpg.trashinfo"))
+	require.NoError(t, err)
+	assert.Contains(t, string(info), "[Trash Info]\nPath="+trashed+"\nDeletionDate=")
+
+	db := NewDB(output, dbFile)
+	db.Load()
+	assert.Len(t, db.Files, 1)
+}
+
+func Test_topdirTrash(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success creating the trash of the user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		topdir := t.TempDir()
+
+		// execute
+		dir, err := topdirTrash(topdir, 1000)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, filepath.Join(topdir, ".Trash-1000"), dir)
+		assert.DirExists(t, dir)
+	})
+
+	t.Run("success using the shared trash created by the administrator", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("sticky directories only exist on Unix-like systems")
+		}
+
+		// setup
+		topdir := t.TempDir()
+		shared := filepath.Join(topdir, ".Trash")
+		require.NoError(t, os.Mkdir(shared, 0o777))
+		require.NoError(t, os.Chmod(shared, 0o777|os.ModeSticky))
+
+		// execute
+		dir, err := topdirTrash(topdir, 1000)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, filepath.Join(shared, "1000"), dir)
+		assert.NoDirExists(t, filepath.Join(topdir, ".Trash-1000"))
+	})
+
+	t.Run("success ignoring a shared trash which is not sticky", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		topdir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(topdir, ".Trash"), 0o777))
+
+		// execute
+		dir, err := topdirTrash(topdir, 1000)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, filepath.Join(topdir, ".Trash-1000"), dir)
+	})
+}
+
+func Test_moveFile(t *testing.T) {
+	t.Parallel()
+
+	// /dev/shm is a separate in-memory file system on most Linux systems
+	otherVolume := "/dev/shm"
+
+	tempInfo, err := os.Stat(t.TempDir())
+	require.NoError(t, err)
+
+	otherInfo, err := os.Stat(otherVolume)
+	if err != nil {
+		t.Skip("no other volume to move files to")
+	}
+
+	tempDevice, _ := deviceID(tempInfo)
+	otherDevice, ok := deviceID(otherInfo)
+	if !ok || tempDevice == otherDevice {
+		t.Skip("no other volume to move files to")
+	}
+
+	// setup
+	sourceDir, err := os.MkdirTemp(otherVolume, "file-catalog-test-")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(sourceDir)
+	})
+
+	source := filepath.Join(sourceDir, "photo.jpg")
+	require.NoError(t, os.WriteFile(source, []byte("photo"), 0o640))
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(source, modTime, modTime))
+
+	target := filepath.Join(t.TempDir(), "photo.jpg")
+
+	// execute
+	err = moveFile(source, target)
+	require.NoError(t, err)
+
+	// verify
+	assert.NoFileExists(t, source)
+
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "photo", string(content))
+
+	targetInfo, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), targetInfo.Mode().Perm())
+	assert.True(t, modTime.Equal(targetInfo.ModTime()))
+}
+
+func TestApp_ImportManifest(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success importing the checksums of a manifest", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+
+		small := []byte("small file")
+		large := bytes.Repeat([]byte("large file"), MB/5)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "small.txt"), small, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "large.bin"), large, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "known.txt"), []byte("known"), 0o644))
+
+		largeHash := md5.Sum(large)
+
+		manifest := md5Hex(small) + "  small.txt\n" +
+			hex.EncodeToString(largeHash[:]) + " *sub/large.bin\n" +
+			"788b62828f73d4bac70088ea91c90ef5  gone.txt\n" +
+			"acbd18db4cc2f85cedef654fccc4a4d8  known.txt\n" +
+			"not a checksum line\n"
+		manifestFile := filepath.Join(dir, "checksums.md5")
+		require.NoError(t, os.WriteFile(manifestFile, []byte(manifest), 0o644))
+
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, []byte(filepath.Join(dir, "known.txt")+",5,"+md5Hex([]byte("known"))+"\n"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ImportManifestCommand(output, dbFile, manifestFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Skipping invalid line 5: not a checksum line\n", output.Get(0))
+		assert.Equal(t, "Imported 3 files (1 not found, imported without a size), skipped 1 already catalogued and 1 invalid lines\n", output.Get(1))
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		smallRecord := db.Files[ID(filepath.Join(dir, "small.txt"))]
+		assert.Equal(t, md5Hex(small), smallRecord.Hash)
+		assert.Equal(t, len(small), smallRecord.Size)
+		assert.Empty(t, smallRecord.HashMode)
+
+		largeRecord := db.Files[ID(filepath.Join(dir, "sub", "large.bin"))]
+		assert.Equal(t, hex.EncodeToString(largeHash[:]), largeRecord.Hash)
+		assert.Equal(t, len(large), largeRecord.Size)
+		assert.Equal(t, hashModeFullMD5, largeRecord.HashMode)
+
+		goneRecord := db.Files[ID(filepath.Join(dir, "gone.txt"))]
+		assert.Equal(t, "788b62828f73d4bac70088ea91c90ef5", goneRecord.Hash)
+		assert.Equal(t, 0, goneRecord.Size)
+
+		assert.Equal(t, md5Hex([]byte("known")), db.Files[ID(filepath.Join(dir, "known.txt"))].Hash)
+
+		output = NewTestOutput(t, nil)
+
+		err = VerifyCommand(output, dbFile, VerifyOptions{})
+		require.NoError(t, err)
+
+		assert.Contains(t, output.String(), "Verified 4 files: 3 ok, 0 mismatched, 1 missing, 0 skipped\n")
+	})
+
+	t.Run("fail without a manifest file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, nil)
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ImportManifestCommand(output, dbFile, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No manifest file given\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Duplicates_Plan(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success applying a plan without the files changed since planning", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		planFile := filepath.Join(t.TempDir(), "plan.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		for _, dir := range []string{"a", "b"} {
+			require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, dir, "photo.jpg"), []byte("photo"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(root, dir, "doc.txt"), []byte("document"), 0o644))
+		}
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		planOutput := NewTestOutput(t, []string{"2", "2"})
+
+		// execute
+		err = DuplicateCommand(planOutput, dbFile, DuplicateOptions{SearchMinLength: 100, Plan: planFile})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, planOutput.String(), fmt.Sprintf("Planned the deletion of 2 files in %s\n", planFile))
+		for _, name := range []string{"photo.jpg", "doc.txt"} {
+			assert.FileExists(t, filepath.Join(root, "b", name))
+		}
+
+		plan, err := os.ReadFile(planFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(plan), filepath.Join(root, "b", "photo.jpg")+",5,"+md5Hex([]byte("photo"))+",,,"+filepath.Join(root, "a", "photo.jpg")+",5,")
+		assert.Contains(t, string(plan), filepath.Join(root, "b", "doc.txt")+",8,"+md5Hex([]byte("document"))+",,,"+filepath.Join(root, "a", "doc.txt")+",8,")
+
+		// setup
+		require.NoError(t, os.WriteFile(filepath.Join(root, "b", "doc.txt"), []byte("DOCUMENT"), 0o644))
+
+		output := NewTestOutput(t, []string{"y"})
+
+		// execute
+		err = ApplyPlanCommand(output, dbFile, planFile, false)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Skipping %s: content changed since planning\n", filepath.Join(root, "b", "doc.txt")), output.Get(0))
+		assert.Equal(t, "Delete 1 files (5 B)? [y/N]\n", output.Get(1))
+		assert.Equal(t, "Deleted 1 of 2 planned files\n", output.Get(3))
+
+		assert.NoFileExists(t, filepath.Join(root, "b", "photo.jpg"))
+		assert.FileExists(t, filepath.Join(root, "b", "doc.txt"))
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 3)
+		assert.NotContains(t, db.Files, ID(filepath.Join(root, "b", "photo.jpg")))
+	})
+
+	t.Run("success skipping files without an unchanged kept copy", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := writeTestDB(t, nil)
+		planFile := filepath.Join(t.TempDir(), "plan.csv")
+
+		row := func(names ...string) string {
+			var fields []string
+			for _, name := range names {
+				fields = append(fields, filepath.Join(root, name), "5", md5Hex([]byte("photo")), "", "")
+			}
+
+			return strings.Join(fields, ",") + "\n"
+		}
+
+		for _, name := range []string{"a.jpg", "a-kept.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+			require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte("photo"), 0o644))
+		}
+
+		// - the kept copies of b.jpg and c.jpg are each other, d.jpg has no kept copy recorded
+		plan := row("a.jpg", "a-kept.jpg") + row("b.jpg", "c.jpg") + row("c.jpg", "b.jpg") + row("d.jpg")
+		require.NoError(t, os.WriteFile(planFile, []byte(plan), 0o644))
+
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a-kept.jpg"), []byte("PHOTO"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ApplyPlanCommand(output, dbFile, planFile, false)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Skipping %s: kept copy %s: content changed since planning\n", filepath.Join(root, "a.jpg"), filepath.Join(root, "a-kept.jpg")), output.Get(0))
+		assert.Equal(t, fmt.Sprintf("Skipping %s: the kept copy %s is planned to be deleted as well\n", filepath.Join(root, "b.jpg"), filepath.Join(root, "c.jpg")), output.Get(1))
+		assert.Equal(t, fmt.Sprintf("Skipping %s: the kept copy %s is planned to be deleted as well\n", filepath.Join(root, "c.jpg"), filepath.Join(root, "b.jpg")), output.Get(2))
+		assert.Equal(t, fmt.Sprintf("Skipping %s: no kept copy was recorded\n", filepath.Join(root, "d.jpg")), output.Get(3))
+		assert.Equal(t, "Nothing to delete\n", output.Get(4))
+
+		for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+			assert.FileExists(t, filepath.Join(root, name))
+		}
+	})
+
+	t.Run("success refusing to plan the deletion of every file of a group", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		planFile := filepath.Join(t.TempDir(), "plan.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		for _, dir := range []string{"a", "b"} {
+			require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, dir, "photo.jpg"), []byte("photo"), 0o644))
+		}
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, []string{"1,2"})
+
+		// execute
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: 100, Plan: planFile})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.String(), "Not planning to delete every file of the group, keep at least one of them\n")
+		assert.Contains(t, output.String(), fmt.Sprintf("Planned the deletion of 0 files in %s\n", planFile))
+	})
+
+	t.Run("success deleting nothing without confirmation", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := writeTestDB(t, nil)
+		planFile := filepath.Join(t.TempDir(), "plan.csv")
+		path := filepath.Join(root, "photo.jpg")
+		keptPath := filepath.Join(root, "photo-copy.jpg")
+
+		require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+		require.NoError(t, os.WriteFile(keptPath, []byte("photo"), 0o644))
+		require.NoError(t, os.WriteFile(planFile, []byte(path+",5,"+md5Hex([]byte("photo"))+",,,"+keptPath+",5,"+md5Hex([]byte("photo"))+",,\n"), 0o644))
+
+		output := NewTestOutput(t, []string{"n"})
+
+		// execute
+		err := ApplyPlanCommand(output, dbFile, planFile, false)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Nothing deleted\n", output.Get(1))
+		assert.FileExists(t, path)
+	})
+}
+
+func TestApp_Duplicates_MinGroupSize(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"a/pair.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/pair.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"a/many.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+		"b/many.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+		"c/many.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+		"a/holiday-1.jpg,300,788b62828f73d4bac70088ea91c90ef5",
+		"a/holiday-2.jpg,400,acbd18db4cc2f85cedef654fccc4a4d8",
+	})
+
+	output := NewTestOutput(t, nil)
+
+	// execute
+	err := DuplicateCommand(output, dbFile, DuplicateOptions{SummaryOnly: true, MinGroupSize: 3})
+	require.NoError(t, err)
+
+	// verify
+	// - the pair by hash and the pair by the holiday search term are left out
+	assert.Equal(t, "Size and hash: 1 groups, 3 files, 400 B reclaimable\n", output.Get(0))
+	assert.Equal(t, "Search term: 1 groups, 3 files\n", output.Get(1))
+	assert.Empty(t, output.Get(2))
+}
+
+func TestApp_Duplicates_SkipEmpty(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		"a/pair.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/pair.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"a/alpha.log,0,d41d8cd98f00b204e9800998ecf8427e",
+		"b/bravo.cfg,0,d41d8cd98f00b204e9800998ecf8427e",
+		"c/charlie.ini,0,d41d8cd98f00b204e9800998ecf8427e",
+	}
+
+	t.Run("success leaving empty files out of the groups", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SummaryOnly: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "3 empty files (use `empty` command)\n", output.Get(0))
+		assert.Equal(t, "Size and hash: 1 groups, 2 files, 100 B reclaimable\n", output.Get(1))
+		assert.Empty(t, output.Get(3))
+	})
+
+	t.Run("success grouping empty files when included", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{ReportFormat: formatCSV, IncludeEmpty: true})
+		require.NoError(t, err)
+
+		// verify
+		rows, err := csv.NewReader(strings.NewReader(output.Get(0))).ReadAll()
+		require.NoError(t, err)
+
+		assert.Contains(t, rows, []string{"2", "Size and hash", "a/alpha.log", "0", "d41d8cd98f00b204e9800998ecf8427e"})
+		assert.Contains(t, rows, []string{"2", "Size and hash", "c/charlie.ini", "0", "d41d8cd98f00b204e9800998ecf8427e"})
+	})
+
+	t.Run("success listing empty files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := EmptyCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "a/alpha.log\n", output.Get(0))
+		assert.Equal(t, "b/bravo.cfg\n", output.Get(1))
+		assert.Equal(t, "c/charlie.ini\n", output.Get(2))
+		assert.Equal(t, "Empty files: 3\n", output.Get(3))
+	})
+}
+
+func TestApp_Canonical(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		"a/photo.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/photo.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"c/photo.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"a/notes.txt,50,0cc175b9c0f1b6a831c399e269772661",
+		"b/notes.txt,50,0cc175b9c0f1b6a831c399e269772661",
+	}
+
+	t.Run("success skipping the groups with a canonical copy", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := CanonicalCommand(output, dbFile, "b/photo.jpg", true)
+		require.NoError(t, err)
+
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{SummaryOnly: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "1 groups with a canonical copy skipped (use `canonical --unset` to review them)\n", output.Get(0))
+		assert.Equal(t, "Size and hash: 1 groups, 2 files, 50 B reclaimable\n", output.Get(1))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.True(t, db.Files["b/photo.jpg"].Canonical)
+		assert.False(t, db.Files["a/photo.jpg"].Canonical)
+	})
+
+	t.Run("success moving the mark to another copy", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := CanonicalCommand(output, dbFile, "b/photo.jpg", true)
+		require.NoError(t, err)
+
+		err = CanonicalCommand(output, dbFile, "c/photo.jpg", true)
+		require.NoError(t, err)
+
+		// verify
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.False(t, db.Files["b/photo.jpg"].Canonical)
+		assert.True(t, db.Files["c/photo.jpg"].Canonical)
+	})
+
+	t.Run("success reporting the group again after unsetting the mark", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := CanonicalCommand(output, dbFile, "b/photo.jpg", true)
+		require.NoError(t, err)
+
+		err = CanonicalCommand(output, dbFile, "b/photo.jpg", false)
+		require.NoError(t, err)
+
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{SummaryOnly: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Size and hash: 2 groups, 5 files, 250 B reclaimable\n", output.Get(0))
+	})
+
+	t.Run("fail marking a file not in the DB", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := CanonicalCommand(output, dbFile, "d/photo.jpg", true)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Error marking file: file not found in DB: d/photo.jpg\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Duplicates_NothingDeleted(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	// - the rows are not sorted, so writing the DB would change it
+	dbFile := writeTestDB(t, []string{
+		"b/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+	})
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(dbFile, past, past))
+
+	before, err := os.ReadFile(dbFile)
+	require.NoError(t, err)
+
+	output := NewTestOutput(t, []string{"", ""})
+
+	// execute
+	err = DuplicateCommand(output, dbFile, DuplicateOptions{})
+	require.NoError(t, err)
+
+	// verify
+	after, err := os.ReadFile(dbFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	fileInfo, err := os.Stat(dbFile)
+	require.NoError(t, err)
+	assert.Equal(t, past, fileInfo.ModTime())
+}
+
+func TestApp_Duplicates_KeepPattern(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success keeping the matching file and skipping ambiguous groups", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		files := map[string]string{
+			"master/photo.jpg": "photo",
+			"backup/photo.jpg": "photo",
+			"other/photo.jpg":  "photo",
+			"backup/doc.txt":   "document",
+			"other/doc.txt":    "document",
+			"master/a/x.txt":   "x",
+			"master/b/x.txt":   "x",
+		}
+		for name, content := range files {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0o644))
+		}
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{Auto: true, KeepPattern: regexp.MustCompile("/master/")})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.String(), fmt.Sprintf("Skipping 2 duplicates of %s: the keep pattern matches 0 of them\n", filepath.Join(root, "backup", "doc.txt")))
+		assert.Contains(t, output.String(), fmt.Sprintf("Keeping %s\n", filepath.Join(root, "master", "photo.jpg")))
+		assert.Contains(t, output.String(), fmt.Sprintf("Skipping 2 duplicates of %s: the keep pattern matches 2 of them\n", filepath.Join(root, "master", "a", "x.txt")))
+		assert.Contains(t, output.String(), "Resolved 1 groups, skipped 2 groups\n")
+		assert.Equal(t, 0, output.count)
+
+		for name := range files {
+			if strings.HasSuffix(name, "photo.jpg") && !strings.HasPrefix(name, "master") {
+				assert.NoFileExists(t, filepath.Join(root, name))
+
+				continue
+			}
+
+			assert.FileExists(t, filepath.Join(root, name))
+		}
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 5)
+	})
+
+	t.Run("success skipping files differing from the kept file after the hashed sample", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		// - the files share the first MB, which is all the hash covers, but their tails differ
+		content := make([]byte, MB+24)
+		master := filepath.Join(root, "master", "video.mp4")
+		backup := filepath.Join(root, "backup", "video.mp4")
+		for path, tail := range map[string]string{master: "master tail", backup: "backup tail"} {
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			copy(content[MB:], tail)
+			require.NoError(t, os.WriteFile(path, content, 0o644))
+		}
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{Auto: true, KeepPattern: regexp.MustCompile("/master/")})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.String(), fmt.Sprintf("Skipping %s: its content differs from %s\n", backup, master))
+		assert.NotContains(t, output.String(), "Deleting")
+		assert.FileExists(t, master)
+		assert.FileExists(t, backup)
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Len(t, db.Files, 2)
+	})
+
+	t.Run("fail without a keep pattern", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, nil)
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Auto: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Resolving duplicates automatically requires a rule, use --keep-pattern\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Duplicates_MoveTo(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success moving duplicates into a dated folder", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		target := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		for _, dir := range []string{"a", "b", "c"} {
+			require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, dir, "photo.jpg"), []byte("photo"), 0o644))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a", "other.jpg"), []byte("other"), 0o644))
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{MoveTo: target})
+		require.NoError(t, err)
+
+		// verify
+		dateDir := filepath.Join(target, time.Now().Format(time.DateOnly))
+		assert.Equal(t, fmt.Sprintf("Moved %d duplicates to %s\n", 2, dateDir), output.Get(2))
+
+		assert.FileExists(t, filepath.Join(root, "a", "photo.jpg"))
+		assert.FileExists(t, filepath.Join(root, "a", "other.jpg"))
+		for _, dir := range []string{"b", "c"} {
+			assert.NoFileExists(t, filepath.Join(root, dir, "photo.jpg"))
+			assert.FileExists(t, filepath.Join(dateDir, dir, "photo.jpg"))
+		}
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		require.Len(t, db.Files, 4)
+		assert.Contains(t, db.Files, ID(filepath.Join(root, "a", "photo.jpg")))
+		assert.Contains(t, db.Files, ID(filepath.Join(dateDir, "b", "photo.jpg")))
+		assert.Contains(t, db.Files, ID(filepath.Join(dateDir, "c", "photo.jpg")))
+		assert.NotContains(t, db.Files, ID(filepath.Join(root, "b", "photo.jpg")))
+		assert.Len(t, db.Hashes[db.Files[ID(filepath.Join(root, "a", "photo.jpg"))].Hash], 3)
+	})
+
+	t.Run("fail on other modes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, nil)
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeStem, MoveTo: t.TempDir()})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Moving duplicates is only supported in the %s mode\n", duplicateModeDefault), output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Duplicates_SummaryOnly(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success summarizing duplicates without prompting", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/foo.txt,2048,464f1ce84fed3d6837db4b810462f8de",
+			"b/foo.txt,2048,464f1ce84fed3d6837db4b810462f8de",
+			"c/foo.txt,2048,464f1ce84fed3d6837db4b810462f8de",
+			"a/bar.txt,100,4d09a656f20fee1beb093f30c7ec504c",
+			"b/bar.txt,100,4d09a656f20fee1beb093f30c7ec504c",
+			"a/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, []string{"1"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: 100, SummaryOnly: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Size and hash: 2 groups, 5 files, 4.1 KB reclaimable\n", output.Get(0))
+		assert.Equal(t, "", output.Get(1))
+		assert.NotContains(t, output.String(), "Delete any files?")
+		assert.Equal(t, 0, output.count)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+		assert.Len(t, db.Files, 6)
+	})
+
+	t.Run("success leaving out the reclaimable bytes of groups by name", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/foo.txt,2048,464f1ce84fed3d6837db4b810462f8de",
+			"b/foo.txt,100,4d09a656f20fee1beb093f30c7ec504c",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, SummaryOnly: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Exact name: 1 groups, 2 files\n", output.Get(0))
+	})
+
+	t.Run("success reporting no duplicates", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/foo.txt,2048,464f1ce84fed3d6837db4b810462f8de",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SummaryOnly: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No duplicates found\n", output.Get(0))
+	})
+}
+
+func TestApp_Duplicates_ByType(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success summarizing reclaimable bytes per extension", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/movie.mp4,4096,464f1ce84fed3d6837db4b810462f8de",
+			"b/movie.mp4,4096,464f1ce84fed3d6837db4b810462f8de",
+			"a/photo.jpg,1024,4d09a656f20fee1beb093f30c7ec504c",
+			"b/photo.JPG,1024,4d09a656f20fee1beb093f30c7ec504c",
+			"c/photo-copy.jpg,1024,4d09a656f20fee1beb093f30c7ec504c",
+			"a/notes,100,788b62828f73d4bac70088ea91c90ef5",
+			"b/notes,100,788b62828f73d4bac70088ea91c90ef5",
+			"a/single.pdf,300,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{ByType: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "mp4: 4.0 KB reclaimable in 1 files\n", output.Get(0))
+		assert.Equal(t, "jpg: 2.0 KB reclaimable in 2 files\n", output.Get(1))
+		assert.Equal(t, "(no extension): 100 B reclaimable in 1 files\n", output.Get(2))
+		assert.Equal(t, "", output.Get(3))
+		assert.Equal(t, 0, output.count)
+	})
+
+	t.Run("fail in other modes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/foo.txt,2048,464f1ce84fed3d6837db4b810462f8de",
+		})
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{ByType: true, Mode: duplicateModeStem})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "The breakdown by file type is only supported in the default mode\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Duplicates_Ext(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success restricting duplicates to extensions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/notes.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"b/notes-copy.TXT,100,464f1ce84fed3d6837db4b810462f8de",
+			"c/notes.md,100,464f1ce84fed3d6837db4b810462f8de",
+			"a/photo.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+			"b/photo-copy.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: 100, Extensions: []string{".txt"}})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
+		assert.Contains(t, stripColors(output.Get(1)), "a/notes.txt")
+		assert.Contains(t, stripColors(output.Get(2)), "b/notes-copy.TXT")
+		assert.Equal(t, "Delete any files? (comma separated list of numbers)\n", output.Get(3))
+		assert.NotContains(t, output.String(), "photo")
+	})
+}
+
+func TestApp_Duplicates_DeleteEmptyDirs(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success removing directories which became empty", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+
+		keptPath := filepath.Join(root, "photos", "photo.jpg")
+		deletedPath := filepath.Join(root, "import", "2024", "photo.jpg")
+
+		var lines []string
+		for _, path := range []string{deletedPath, keptPath} {
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+			lines = append(lines, fmt.Sprintf("%s,5,464f1ce84fed3d6837db4b810462f8de", path))
+		}
+
+		dbFile := writeTestDB(t, lines)
+		require.NoError(t, os.WriteFile(dbFile+metaFileSuffix, []byte(root+",2024-01-01T00:00:00Z\n"), 0o644))
+
+		output := NewTestOutput(t, []string{"1"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, DeleteEmptyDirs: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.NoFileExists(t, deletedPath)
+		assert.NoDirExists(t, filepath.Join(root, "import", "2024"))
+		assert.NoDirExists(t, filepath.Join(root, "import"))
+		assert.DirExists(t, root)
+		assert.FileExists(t, keptPath)
+		assert.Contains(t, output.String(), "Removed empty directory: "+filepath.Join(root, "import", "2024"))
+		assert.Contains(t, output.String(), "Removed empty directory: "+filepath.Join(root, "import"))
+	})
+
+	t.Run("success keeping the scan root even if it became empty", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+
+		paths := []string{filepath.Join(root, "a", "photo.jpg"), filepath.Join(root, "b", "photo.jpg")}
+
+		var lines []string
+		for _, path := range paths {
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+			lines = append(lines, fmt.Sprintf("%s,5,464f1ce84fed3d6837db4b810462f8de", path))
+		}
+
+		// - the directory of the deleted file is a scan root itself
+		dbFile := writeTestDB(t, lines)
+		require.NoError(t, os.WriteFile(dbFile+metaFileSuffix, []byte(filepath.Join(root, "a")+",2024-01-01T00:00:00Z\n"), 0o644))
+
+		output := NewTestOutput(t, []string{"1"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, DeleteEmptyDirs: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.NoFileExists(t, paths[0])
+		assert.DirExists(t, filepath.Join(root, "a"))
+		assert.NotContains(t, output.String(), "Removed empty directory")
+	})
+
+	t.Run("success keeping the root of the deleted file without the scan roots", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		paths := []string{filepath.Join(root, "a", "photo.jpg"), filepath.Join(root, "b", "photo.jpg")}
+		for _, path := range paths {
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+			err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{filepath.Dir(path)}, ScanOptions{})
+			require.NoError(t, err)
+		}
+
+		// - the roots are only known from the records
+		require.NoError(t, os.Remove(dbFile+metaFileSuffix))
+
+		output := NewTestOutput(t, []string{"1"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, DeleteEmptyDirs: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.NoFileExists(t, paths[0])
+		assert.DirExists(t, filepath.Join(root, "a"))
+		assert.NotContains(t, output.String(), "Removed empty directory")
+	})
+}
+
+func TestApp_Duplicates_PreferOlderThan(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, ages []time.Duration) (string, []string) {
+		t.Helper()
+
+		root := t.TempDir()
+
+		var (
+			paths []string
+			lines []string
+		)
+		for i, age := range ages {
+			path := filepath.Join(root, strconv.Itoa(i), "photo.jpg")
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+			paths = append(paths, path)
+			lines = append(lines, fmt.Sprintf("%s,5,464f1ce84fed3d6837db4b810462f8de,%d", path, time.Now().Add(-age).Unix()))
+		}
+
+		return writeTestDB(t, lines), paths
+	}
+
+	t.Run("success deleting the suggested older files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile, paths := setup(t, []time.Duration{60 * 24 * time.Hour, time.Hour, 90 * 24 * time.Hour})
+
+		output := NewTestOutput(t, []string{acceptSuggestion})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, PreferOlderThan: 30 * 24 * time.Hour})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.String(), "Suggested for deletion (older than 720h0m0s)")
+		assert.NoFileExists(t, paths[0])
+		assert.FileExists(t, paths[1])
+		assert.NoFileExists(t, paths[2])
+	})
+
+	t.Run("success keeping the newest file if all files are older", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile, paths := setup(t, []time.Duration{60 * 24 * time.Hour, 40 * 24 * time.Hour, 90 * 24 * time.Hour})
+
+		output := NewTestOutput(t, []string{acceptSuggestion})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, PreferOlderThan: 30 * 24 * time.Hour})
+		require.NoError(t, err)
+
+		// verify
+		assert.NoFileExists(t, paths[0])
+		assert.FileExists(t, paths[1])
+		assert.NoFileExists(t, paths[2])
+	})
+
+	t.Run("success without suggestions if no file is older", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile, paths := setup(t, []time.Duration{time.Hour, 2 * time.Hour})
+
+		output := NewTestOutput(t, []string{""})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, PreferOlderThan: 30 * 24 * time.Hour})
+		require.NoError(t, err)
+
+		// verify
+		assert.NotContains(t, output.String(), "Suggested for deletion")
+		assert.FileExists(t, paths[0])
+		assert.FileExists(t, paths[1])
+	})
+}
+
+func TestJSONErrorOutput_Errorf(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success reporting a failed load as JSON", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := filepath.Join(t.TempDir(), "missing.csv")
+
+		testOutput := NewTestOutput(t, nil).RecordExit()
+		errOutput := &bytes.Buffer{}
+
+		output := NewJSONErrorOutput(testOutput, errOutput)
+
+		// execute
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		// verify
+		var reported map[string]string
+		require.NoError(t, json.Unmarshal(errOutput.Bytes(), &reported))
+		assert.Equal(t, errCodeReadDB, reported["code"])
+		assert.Contains(t, reported["message"], "Error reading DB: unable to read DB file '"+dbFile+"'")
+		assert.Len(t, reported, 2)
+
+		assert.Empty(t, testOutput.data)
+		assert.Equal(t, 1, testOutput.exitCode)
+	})
+
+	t.Run("success reporting a failed scan as JSON", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		pattern := filepath.Join(t.TempDir(), "drive*")
+
+		testOutput := NewTestOutput(t, nil).RecordExit()
+		errOutput := &bytes.Buffer{}
+
+		output := NewJSONErrorOutput(testOutput, errOutput)
+
+		// execute
+		err := ScanCommand(output, dbFile, []string{pattern}, ScanOptions{})
+		require.NoError(t, err)
+
+		// verify
+		var reported map[string]string
+		require.NoError(t, json.Unmarshal(errOutput.Bytes(), &reported))
+		assert.Equal(t, errCodeScan, reported["code"])
+		assert.Equal(t, fmt.Sprintf("Error expanding roots: root pattern '%s' matches nothing", pattern), reported["message"])
+
+		assert.Empty(t, testOutput.data)
+		assert.Equal(t, 1, testOutput.exitCode)
+	})
+}
+
+func TestStdOut_Scanln(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success reading lines until EOF", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		out := &StdOut{input: bufio.NewReader(strings.NewReader("1, 3\n\n2"))}
+
+		var first, second, third, fourth string
+
+		// execute
+		err1 := out.Scanln(&first)
+		err2 := out.Scanln(&second)
+		err3 := out.Scanln(&third)
+		err4 := out.Scanln(&fourth)
+
+		// verify
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		require.NoError(t, err3)
+		require.ErrorIs(t, err4, io.EOF)
+
+		assert.Equal(t, "1, 3", first)
+		assert.Equal(t, "", second)
+		assert.Equal(t, "2", third)
+		assert.Equal(t, "", fourth)
+	})
+}
+
+func TestApp_Duplicates_EOF(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success skipping groups at the end of the input", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+
+		paths := []string{filepath.Join(root, "a", "photo.jpg"), filepath.Join(root, "b", "photo.jpg")}
+
+		var lines []string
+		for _, path := range paths {
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+			lines = append(lines, fmt.Sprintf("%s,5,464f1ce84fed3d6837db4b810462f8de", path))
+		}
+
+		dbFile := writeTestDB(t, lines)
+
+		// - no input is given at all, so reading the answer returns io.EOF
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 0, output.exitCode)
+		assert.NotContains(t, output.String(), "Error scanning numbers")
+		assert.NotContains(t, output.String(), "Deleting")
+		assert.FileExists(t, paths[0])
+		assert.FileExists(t, paths[1])
+	})
+}
+
+func TestApp_Duplicates_ConfirmEach(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success deleting only the confirmed files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+
+		var (
+			paths []string
+			lines []string
+		)
+		for _, dir := range []string{"a", "b", "c", "d"} {
+			path := filepath.Join(root, dir, "photo.jpg")
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+			paths = append(paths, path)
+			lines = append(lines, fmt.Sprintf("%s,5,464f1ce84fed3d6837db4b810462f8de", path))
+		}
+
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, []string{"1,2,3", "y", "n", "Y"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, ConfirmEach: true})
+		require.NoError(t, err)
+
+		// verify
+		remaining := 0
+		for _, path := range paths {
+			if _, err := os.Stat(path); err == nil {
+				remaining++
+			}
+		}
+
+		assert.Equal(t, 2, remaining)
+		assert.Equal(t, 2, strings.Count(output.String(), "Deleting "))
+		assert.Equal(t, 1, strings.Count(output.String(), "Keeping "))
+		assert.Equal(t, 3, strings.Count(output.String(), "? [y/N]"))
+	})
+
+	t.Run("success keeping the files if the input ends", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+
+		paths := []string{filepath.Join(root, "a", "photo.jpg"), filepath.Join(root, "b", "photo.jpg")}
+
+		var lines []string
+		for _, path := range paths {
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("photo"), 0o644))
+
+			lines = append(lines, fmt.Sprintf("%s,5,464f1ce84fed3d6837db4b810462f8de", path))
+		}
+
+		dbFile := writeTestDB(t, lines)
+
+		output := NewTestOutput(t, []string{"1,2"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{Mode: duplicateModeExactName, ConfirmEach: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.FileExists(t, paths[0])
+		assert.FileExists(t, paths[1])
+		assert.NotContains(t, output.String(), "Deleting")
+	})
+}
+
+func TestApp_Duplicates_SizeTolerance(t *testing.T) {
+	t.Parallel()
+
+	dbFile := writeTestDB(t, []string{
+		"a/video.mp4,2000000,464f1ce84fed3d6837db4b810462f8de",
+		"b/video.mp4,2000004,464f1ce84fed3d6837db4b810462f8de",
+		"c/video.mp4,2000150,464f1ce84fed3d6837db4b810462f8de",
+		"d/video.mp4,2000004,4d09a656f20fee1beb093f30c7ec504c",
+	})
+
+	tests := []struct {
+		name    string
+		options DuplicateOptions
+		want    [][]ID
+	}{
+		{
+			name:    "exact sizes only",
+			options: DuplicateOptions{},
+			want:    nil,
+		},
+		{
+			name:    "tolerance in bytes",
+			options: DuplicateOptions{SizeTolerance: 16},
+			want:    [][]ID{{"a/video.mp4", "b/video.mp4"}},
+		},
+		{
+			name:    "tolerance in percent",
+			options: DuplicateOptions{SizeTolerancePct: 0.01},
+			want:    [][]ID{{"a/video.mp4", "b/video.mp4", "c/video.mp4"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			output := NewTestOutput(t, nil)
+
+			db := NewDB(output, dbFile)
+			db.Load()
+
+			// execute
+			groups := db.duplicatesBySizeAndHash(tt.options)
+
+			// verify
+			var got [][]ID
+			for _, group := range groups {
+				got = append(got, group.IDs)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApp_Duplicates_SizeTolerance_Rejected(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options DuplicateOptions
+	}{
+		{
+			name:    "auto",
+			options: DuplicateOptions{SizeTolerance: 16, Auto: true, KeepPattern: regexp.MustCompile("^a/")},
+		},
+		{
+			name:    "plan",
+			options: DuplicateOptions{SizeTolerancePct: 0.01, Plan: "plan.csv"},
+		},
+		{
+			name:    "move duplicates",
+			options: DuplicateOptions{SizeTolerance: 16, MoveTo: "dups"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			dbFile := writeTestDB(t, []string{
+				"a/video.mp4,2000000,464f1ce84fed3d6837db4b810462f8de",
+				"b/video.mp4,2000004,464f1ce84fed3d6837db4b810462f8de",
+			})
+
+			output := NewTestOutput(t, nil).RecordExit()
+
+			// execute
+			err := DuplicateCommand(output, dbFile, tt.options)
+			require.NoError(t, err)
+
+			// verify
+			// - nothing was resolved, the files are still in the catalog
+			assert.Equal(t, "The size tolerance can't be used with --auto, --plan or --move-duplicates-to\n", output.Get(0))
+			assert.Equal(t, 1, output.exitCode)
+
+			db := NewDB(NewTestOutput(t, nil), dbFile)
+			db.Load()
+
+			assert.Len(t, db.Files, 2)
+		})
+	}
+}
+
+func Test_parseSizeTolerance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw         string
+		wantBytes   int64
+		wantPercent float64
+		wantErr     bool
+	}{
+		{raw: "", wantBytes: 0},
+		{raw: "16", wantBytes: 16},
+		{raw: "1KB", wantBytes: 1024},
+		{raw: "0.5%", wantPercent: 0.5},
+		{raw: "-1%", wantErr: true},
+		{raw: "abc%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			gotBytes, gotPercent, err := parseSizeTolerance(tt.raw)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBytes, gotBytes)
+			assert.InDelta(t, tt.wantPercent, gotPercent, 0.0001)
+		})
+	}
+}
+
+func TestApp_Duplicates_SearchTermOrder(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"a/holidaypictures-small.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/holidaypictures-copy.txt,150,4d09a656f20fee1beb093f30c7ec504c",
+		"a/weddingvideos-raw.mp4,5000000,788b62828f73d4bac70088ea91c90ef5",
+		"b/weddingvideos-cut.mp4,3000000,acbd18db4cc2f85cedef654fccc4a4d8",
+		"a/documentsarchive-1.txt,1000,37b51d194a7513e45b56f6524f2d51f2",
+		"b/documentsarchive-2.txt,2000,73feffa4b7f6bb68e44cf984c85f6e88",
+	})
+
+	output := NewTestOutput(t, nil)
+
+	// execute
+	err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: 10})
+	require.NoError(t, err)
+
+	// verify
+	// - groups are reviewed by their total size, largest first
+	out := stripColors(output.String())
+
+	wedding := strings.Index(out, "a/weddingvideos-raw.mp4")
+	documents := strings.Index(out, "a/documentsarchive-1.txt")
+	holiday := strings.Index(out, "a/holidaypictures-small.txt")
+
+	require.NotEqual(t, -1, wedding)
+	require.NotEqual(t, -1, documents)
+	require.NotEqual(t, -1, holiday)
+	assert.Less(t, wedding, documents)
+	assert.Less(t, documents, holiday)
+}
+
+func TestApp_Duplicates_CSV(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success reporting duplicate groups as csv", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			`"a/foo,bar.txt",100,464f1ce84fed3d6837db4b810462f8de`,
+			"b/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"c/unique.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, []string{"1"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength, ReportFormat: formatCSV})
+		require.NoError(t, err)
+
+		// verify
+		rows, err := csv.NewReader(strings.NewReader(output.Get(0))).ReadAll()
+		require.NoError(t, err)
+
+		assert.Equal(t, [][]string{
+			{"group", "type", "path", "size", "hash"},
+			{"1", "Size and hash", "a/foo,bar.txt", "100", "464f1ce84fed3d6837db4b810462f8de"},
+			{"1", "Size and hash", "b/foo.txt", "100", "464f1ce84fed3d6837db4b810462f8de"},
+		}, rows)
+		assert.Empty(t, output.Get(1))
+		assert.Equal(t, 0, output.count)
+	})
+
+	t.Run("success reporting duplicate groups as tsv", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			`"a/foo,bar.txt",100,464f1ce84fed3d6837db4b810462f8de`,
+			"b/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"c/unique.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength, ReportFormat: formatTSV})
+		require.NoError(t, err)
+
+		// verify
+		expected := "group\ttype\tpath\tsize\thash\n" +
+			"1\tSize and hash\ta/foo,bar.txt\t100\t464f1ce84fed3d6837db4b810462f8de\n" +
+			"1\tSize and hash\tb/foo.txt\t100\t464f1ce84fed3d6837db4b810462f8de\n"
+		assert.Equal(t, expected, output.Get(0))
+		assert.Empty(t, output.Get(1))
+	})
+}
+
+func TestApp_Duplicates_HashMissing(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success hashing only the files of the same size", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		pathA := filepath.Join(root, "a.txt")
+		pathB := filepath.Join(root, "b.txt")
+		pathC := filepath.Join(root, "c.txt")
+		pathD := filepath.Join(root, "d.txt")
+		require.NoError(t, os.WriteFile(pathA, []byte("same content"), 0o644))
+		require.NoError(t, os.WriteFile(pathB, []byte("same content"), 0o644))
+		require.NoError(t, os.WriteFile(pathC, []byte("diff content"), 0o644))
+		require.NoError(t, os.WriteFile(pathD, []byte("unique size"), 0o644))
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{NoHash: true})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength, ReportFormat: formatTSV, HashMissing: true})
+		require.NoError(t, err)
+
+		// verify
+		hash := md5Hex([]byte("same content"))
+
+		assert.Equal(t, "Hashed 3 files of the same size as others, 0 failed\n", output.Get(0))
+		assert.Equal(t, "group\ttype\tpath\tsize\thash\n"+
+			"1\tSize and hash\t"+pathA+"\t12\t"+hash+"\n"+
+			"1\tSize and hash\t"+pathB+"\t12\t"+hash+"\n", output.Get(1))
+
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		assert.Equal(t, hash, db.Files[ID(pathA)].Hash)
+		assert.Equal(t, hash, db.Files[ID(pathB)].Hash)
+		assert.Equal(t, md5Hex([]byte("diff content")), db.Files[ID(pathC)].Hash)
+		assert.Empty(t, db.Files[ID(pathD)].Hash)
+	})
+}
+
+func TestApp_Duplicates_HardLinks(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("hardlink detection is tested on Unix only")
+	}
+
+	t.Run("success warning when deleting a hardlinked file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dir := t.TempDir()
+		original := filepath.Join(dir, "original.txt")
+		link := filepath.Join(dir, "link.txt")
+
+		require.NoError(t, os.WriteFile(original, []byte("foo"), 0o644))
+		require.NoError(t, os.Link(original, link))
+
+		dbFile := writeTestDB(t, []string{
+			fmt.Sprintf("%s,3,acbd18db4cc2f85cedef654fccc4a4d8", original),
+			fmt.Sprintf("%s,3,acbd18db4cc2f85cedef654fccc4a4d8", link),
+		})
+
+		output := NewTestOutput(t, []string{"1"})
+
+		// execute
+		err := DuplicateCommand(output, dbFile, DuplicateOptions{SearchMinLength: defaultMinLength})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Duplicates found: 2 (1 / 1) - Size and hash\n", output.Get(0))
+		assert.Contains(t, output.Get(4), "Deleting")
+		assert.Contains(t, output.Get(4), link)
+		assert.Equal(t, fmt.Sprintf("Warning: %s shares its inode with 1 other catalogued file(s), no space will be reclaimed\n", link), output.Get(5))
+		assert.NoFileExists(t, link)
+		assert.FileExists(t, original)
+	})
+}
+
+func writeTestDB(t *testing.T, lines []string) string {
+	t.Helper()
+
+	dbFile := filepath.Join(t.TempDir(), "db.csv")
+
+	err := os.WriteFile(dbFile, []byte(strings.Join(lines, "\n")), 0o644)
+	require.NoError(t, err)
+
+	return dbFile
+}
+
+func TestApp_Search(t *testing.T) {
+	t.Parallel()
+
+	files := []string{
+		"bambam/foo-756381984.txt",
+		"bambam/bar-1786396036.txt",
+		"bambam/baz.txt",
+		"bambam/quix-1786396036.txt",
+	}
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		random := fmt.Sprintf("%f", rand.ExpFloat64())
+
+		lines := []string{
+			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[0]),
+			fmt.Sprintf("%s,1786396036,4d09a656f20fee1beb093f30c7ec504c\n", files[1]),
+			fmt.Sprintf("%s,756381984,464f1ce84fed3d6837db4b810462f8de\n", files[2]),
+			fmt.Sprintf("%s,123,788b62828f73d4bac70088ea91c90ef5\n", files[3]),
+		}
+
+		dbFile := fmt.Sprintf("_test_%s.csv", random)
+
+		err := os.WriteFile(dbFile, []byte(strings.Join(lines, "\n")), 0o644)
+		require.NoError(t, err)
+
+		return dbFile
+	}
+
+	cleanup := func(t *testing.T, dbFile string) {
+		t.Helper()
+
+		err := os.Remove(dbFile)
+		require.NoError(t, err)
+
+		err = os.Remove(dbFile + lockFileSuffix)
+		if !os.IsNotExist(err) {
+			require.NoError(t, err)
+		}
+	}
+
+	clearColors := func(t *testing.T, str string) string {
+		t.Helper()
+
+		str = strings.ReplaceAll(str, redBold, "")
+		str = strings.ReplaceAll(str, yellowBold, "")
+		str = strings.ReplaceAll(str, blueBold, "")
+		str = strings.ReplaceAll(str, reset, "")
+
+		return str
+	}
+
+	t.Run("success searching by term - fast", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: fast}, []string{"1786396036.txt"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
+		assert.Contains(t, clearColors(t, output.Get(1)), files[3])
+	})
+
+	t.Run("failure searching by term - fast", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: fast}, []string{"1786396036"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No results found for search term '1786396036'.\n", output.Get(0))
+	})
+
+	t.Run("failure searching by term - slow", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow}, []string{"abcde"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No results found for search term 'abcde'.\n", output.Get(0))
+	})
+
+	t.Run("success searching by term", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow}, []string{"1786396036"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
+		assert.Contains(t, clearColors(t, output.Get(1)), files[3])
+	})
+
+	t.Run("success searching by multiple terms", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow}, []string{"bar", "1786396036"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
+		assert.Empty(t, output.Get(1))
+	})
+
+	t.Run("success searching by file", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+		defer cleanup(t, dbFile)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := FileSearchCommand(output, dbFile, SearchOptions{Mode: slow}, files[1])
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
+		assert.Empty(t, output.Get(1))
+	})
+}
+
+func TestApp_Search_ModeEnv(t *testing.T) {
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"bambam/bar-1786396036.txt,1786396036,4d09a656f20fee1beb093f30c7ec504c",
+		"bambam/quix-1786396036.txt,123,788b62828f73d4bac70088ea91c90ef5",
+	})
+
+	tests := []struct {
+		name    string
+		mode    string
+		args    []string
+		results bool
+	}{
+		{name: "termSearch - fast", mode: fast, args: []string{termSearch, dbFile, "1786396036"}, results: false},
+		{name: "termSearch - slow", mode: slow, args: []string{termSearch, dbFile, "1786396036"}, results: true},
+		{name: "fileSearch - fast", mode: fast, args: []string{fileSearch, dbFile, "1786396"}, results: false},
+		{name: "fileSearch - slow", mode: slow, args: []string{fileSearch, dbFile, "1786396"}, results: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envSearchMode, tt.mode)
+
+			output := NewTestOutput(t, nil)
+
+			// execute
+			err := CreateApp(output).Run(append([]string{"file-catalog"}, tt.args...))
+			require.NoError(t, err)
+
+			// verify
+			if tt.results {
+				assert.Contains(t, stripColors(output.Get(0)), "bambam/bar-1786396036.txt")
+				assert.Contains(t, stripColors(output.Get(1)), "bambam/quix-1786396036.txt")
+			} else {
+				assert.Contains(t, output.Get(0), "No results found")
+			}
+		})
+	}
+}
+
+func TestApp_FileSearch_Mode(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"bambam/bar-1786396036.txt,1786396036,4d09a656f20fee1beb093f30c7ec504c",
+			"bambam/quix-1786396036.txt,123,788b62828f73d4bac70088ea91c90ef5",
+		})
+	}
+
+	t.Run("success searching by file with explicit slow mode", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := CreateApp(output).Run([]string{"file-catalog", fs, "--mode", slow, dbFile, "1786396"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, stripColors(output.Get(0)), "bambam/bar-1786396036.txt")
+		assert.Contains(t, stripColors(output.Get(1)), "bambam/quix-1786396036.txt")
+	})
+
+	t.Run("fail on unknown mode", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := FileSearchCommand(output, dbFile, SearchOptions{Mode: "quick"}, "1786396")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Unknown search mode: quick\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Search_ShowTime(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Now().Add(-95 * 24 * time.Hour).Truncate(time.Second)
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			fmt.Sprintf("bambam/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,%d", modTime.Unix()),
+			"bambam/foo-baz.txt,100,464f1ce84fed3d6837db4b810462f8de,",
+		})
+	}
+
+	tests := []struct {
+		showTime string
+		want     []string
+	}{
+		{
+			showTime: "",
+			want:     []string{"[1] bambam/foo-bar.txt (0 MB)\n", "[2] bambam/foo-baz.txt (0 MB)\n"},
+		},
+		{
+			showTime: showTimeRelative,
+			want:     []string{"[1] bambam/foo-bar.txt (0 MB) - 3 months ago\n", "[2] bambam/foo-baz.txt (0 MB) - unknown time\n"},
+		},
+		{
+			showTime: showTimeAbsolute,
+			want: []string{
+				"[1] bambam/foo-bar.txt (0 MB) - " + modTime.Format("2006-01-02 15:04") + "\n",
+				"[2] bambam/foo-baz.txt (0 MB) - unknown time\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run("show time: "+tt.showTime, func(t *testing.T) {
+			t.Parallel()
+
+			dbFile := setup(t)
+
+			// setup
+			output := NewTestOutput(t, nil)
+
+			// execute
+			err := TermSearchCommand(output, dbFile, SearchOptions{Mode: fast, ShowTime: tt.showTime}, []string{"foo"})
+			require.NoError(t, err)
+
+			// verify
+			assert.Equal(t, tt.want[0], stripColors(output.Get(0)))
+			assert.Equal(t, tt.want[1], stripColors(output.Get(1)))
+		})
+	}
+}
+
+func TestApp_Search_ShowMatches(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"photos/2021.12.31-DSC_5070-Verbessert-RR-Bearbeitet.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+			"photos/DSC_5071-Bearbeitet.jpg,100,4d09a656f20fee1beb093f30c7ec504c",
+		})
+	}
+
+	t.Run("success showing terms matched by contains", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, ShowMatches: true}, []string{"5070", "arbeit"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "[1] photos/2021.12.31-DSC_5070-Verbessert-RR-Bearbeitet.jpg (0 MB) [matched: dsc_5070, bearbeitet.jpg]\n", stripColors(output.Get(0)))
+		assert.Empty(t, output.Get(1))
+	})
+
+	t.Run("success showing exactly matched terms", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: fast, ShowMatches: true}, []string{"bearbeitet.jpg"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "[1] photos/2021.12.31-DSC_5070-Verbessert-RR-Bearbeitet.jpg (0 MB) [matched: bearbeitet.jpg]\n", stripColors(output.Get(0)))
+		assert.Equal(t, "[2] photos/DSC_5071-Bearbeitet.jpg (0 MB) [matched: bearbeitet.jpg]\n", stripColors(output.Get(1)))
+	})
+}
+
+func TestApp_TermSearch_MaxCandidates(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"a/holiday-beach.jpg,100,",
+			"b/holiday-mountain.jpg,200,",
+			"c/holiday-city.jpg,300,",
+		})
+	}
+
+	t.Run("fail on too broad term", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, MaxCandidates: 2}, []string{"beach", "holi"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Search term 'holi' is too broad, it matches more than 2 files. Add more specific terms.\n", output.Get(0))
+		assert.Equal(t, "No results found.\n", output.Get(1))
+	})
+
+	t.Run("success within limit", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, MaxCandidates: 3}, []string{"holi"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "[1] a/holiday-beach.jpg (0 MB)\n", stripColors(output.Get(0)))
+		assert.Equal(t, "[3] c/holiday-city.jpg (0 MB)\n", stripColors(output.Get(2)))
+	})
+
+	t.Run("fail on too many results together", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		for _, mode := range []string{fast, slow} {
+			// setup
+			output := NewTestOutput(t, nil)
+
+			// execute
+			err := TermSearchCommand(output, dbFile, SearchOptions{Mode: mode, MaxResults: 4}, []string{"holiday", "ext:jpg"})
+			require.NoError(t, err)
+
+			// verify
+			assert.Equal(t, "Search stopped, the terms match more than 4 files together. Add more specific terms or raise --max-results.\n", output.Get(0), mode)
+			assert.Equal(t, "No results found.\n", output.Get(1), mode)
+		}
+	})
+}
+
+func TestDB_PrintIDs_Dedupe(t *testing.T) {
+	t.Parallel()
+
+	dbFile := writeTestDB(t, []string{
+		"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+	})
+
+	t.Run("success printing each path once", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		ids := []ID{"b/bar.txt", "a/foo.txt", "b/bar.txt", "a/foo.txt"}
+
+		// execute
+		db.PrintIDs(ids, nil, PrintOptions{Dedupe: true})
+
+		// verify
+		assert.Equal(t, "[1] a/foo.txt (0 MB)\n", stripColors(output.Get(0)))
+		assert.Equal(t, "[2] b/bar.txt (0 MB)\n", stripColors(output.Get(1)))
+		assert.Empty(t, output.Get(2))
+		assert.Equal(t, []ID{"b/bar.txt", "a/foo.txt", "b/bar.txt", "a/foo.txt"}, ids)
+	})
+
+	t.Run("success printing duplicates without dedupe", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		// execute
+		db.PrintIDs([]ID{"b/bar.txt", "a/foo.txt", "b/bar.txt"}, nil, PrintOptions{})
+
+		// verify
+		assert.Equal(t, "[1] a/foo.txt (0 MB)\n", stripColors(output.Get(0)))
+		assert.Equal(t, "[2] b/bar.txt (0 MB)\n", stripColors(output.Get(1)))
+		assert.Equal(t, "[3] b/bar.txt (0 MB)\n", stripColors(output.Get(2)))
+	})
+}
+
+func TestDB_PrintIDs_Truncation(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, count int) (*DB, *TestOutput, []ID) {
+		t.Helper()
+
+		lines := make([]string, 0, count)
+		ids := make([]ID, 0, count)
+		for i := range count {
+			path := fmt.Sprintf("dir/file-%03d.txt", i)
+			lines = append(lines, path+",100,464f1ce84fed3d6837db4b810462f8de")
+			ids = append(ids, ID(path))
+		}
+
+		output := NewTestOutput(t, nil)
+
+		db := NewDB(output, writeTestDB(t, lines))
+		db.Load()
+
+		return db, output, ids
+	}
+
+	t.Run("success printing exactly max lines without truncation", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		db, output, ids := setup(t, maxLines)
+
+		// execute
+		db.PrintIDs(ids, nil, PrintOptions{})
+
+		// verify
+		assert.Len(t, output.data, maxLines)
+		assert.NotContains(t, output.String(), "showing")
+	})
+
+	t.Run("success reporting the total of truncated lists", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		db, output, ids := setup(t, 342)
+
+		// execute
+		db.PrintIDs(ids, nil, PrintOptions{})
+
+		// verify
+		assert.Len(t, output.data, maxLines+1)
+		assert.Equal(t, "... (showing 100 of 342)\n", output.Get(maxLines))
+	})
+}
+
+func Test_formatAge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{age: 30 * time.Second, want: "just now"},
+		{age: time.Minute, want: "1 minute ago"},
+		{age: 5 * time.Hour, want: "5 hours ago"},
+		{age: 3 * 24 * time.Hour, want: "3 days ago"},
+		{age: 95 * 24 * time.Hour, want: "3 months ago"},
+		{age: 800 * 24 * time.Hour, want: "2 years ago"},
+		{age: -time.Hour, want: "in the future"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got := formatAge(tt.age)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApp_Search_Query(t *testing.T) {
+	t.Parallel()
+
+	files := []string{
+		"bambam/foo-bar.jpg",
+		"bambam/foo-baz.JPG",
+		"bambam/foo-quix.txt",
+	}
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			fmt.Sprintf("%s,100,464f1ce84fed3d6837db4b810462f8de", files[0]),
+			fmt.Sprintf("%s,200,4d09a656f20fee1beb093f30c7ec504c", files[1]),
+			fmt.Sprintf("%s,300,788b62828f73d4bac70088ea91c90ef5", files[2]),
+		})
+	}
+
+	t.Run("success searching by extension and term", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow}, []string{"ext:jpg", "foo"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, stripColors(output.Get(0)), files[0])
+		assert.Contains(t, stripColors(output.Get(1)), files[1])
+		assert.Empty(t, output.Get(2))
+	})
+
+	t.Run("success searching by tag after tagging", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TagCommand(output, dbFile, files[2], []string{"Keep"})
+		require.NoError(t, err)
+
+		err = TermSearchCommand(output, dbFile, SearchOptions{Mode: fast}, []string{"tag:keep"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, stripColors(output.Get(0)), files[2])
+		assert.Empty(t, output.Get(1))
+	})
+
+	t.Run("failure searching by unknown tag", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow}, []string{"foo", "tag:missing"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No results found for filter 'tag:missing'.\n", output.Get(0))
+	})
+}
+
+func TestApp_Search_SlowDeduplicates(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	// - both files have multiple search terms containing the needle
+	dbFile := writeTestDB(t, []string{
+		"photos/holiday-holidays-2024.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		"photos/holiday-holidaymakers.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		"photos/birthday-2024.jpg,300,788b62828f73d4bac70088ea91c90ef5",
+	})
+
+	output := NewTestOutput(t, nil)
+
+	db := NewDB(output, dbFile)
+	db.Load()
+
+	// execute
+	results, stop := db.slowCollectIDs([]string{"holiday"}, 0, 0)
+
+	// verify
+	assert.Nil(t, stop)
+	require.Len(t, results, 1)
+	assert.ElementsMatch(t, []ID{"photos/holiday-holidays-2024.jpg", "photos/holiday-holidaymakers.jpg"}, results[0])
+
+	// execute
+	err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow}, []string{"holiday"})
+	require.NoError(t, err)
+
+	// verify
+	assert.Len(t, output.data, 2)
+	assert.Equal(t, 1, strings.Count(output.String(), "holidays-2024"))
+	assert.Equal(t, 1, strings.Count(output.String(), "holidaymakers"))
+}
+
+func TestDB_Handler(t *testing.T) {
+	t.Parallel()
+
+	dbFile := writeTestDB(t, []string{
+		"photos/holiday-2024.jpg,100,464f1ce84fed3d6837db4b810462f8de,,keep",
+		"photos/holiday-2023.png,200,4d09a656f20fee1beb093f30c7ec504c,,",
+		"docs/birthday-2024.txt,300,788b62828f73d4bac70088ea91c90ef5,,",
+	})
+
+	db := NewDB(NewTestOutput(t, nil), dbFile)
+	db.Load()
+
+	server := httptest.NewServer(db.Handler(defaultMaxResults))
+	t.Cleanup(server.Close)
+
+	get := func(t *testing.T, server *httptest.Server, query url.Values) (int, map[string]any) {
+		t.Helper()
+
+		resp, err := http.Get(server.URL + "/search?" + query.Encode())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+		return resp.StatusCode, body
+	}
+
+	t.Run("success searching", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		status, body := get(t, server, url.Values{"q": {"holiday"}, "mode": {slow}})
+
+		// verify
+		assert.Equal(t, http.StatusOK, status)
+
+		results := body["results"].([]any)
+		require.Len(t, results, 2)
+		assert.Equal(t, "photos/holiday-2023.png", results[0].(map[string]any)["path"])
+		assert.Equal(t, "photos/holiday-2024.jpg", results[1].(map[string]any)["path"])
+		assert.Equal(t, float64(100), results[1].(map[string]any)["size"])
+		assert.Equal(t, []any{"keep"}, results[1].(map[string]any)["tags"])
+	})
+
+	t.Run("success searching with filters", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		status, body := get(t, server, url.Values{"q": {"2024 ext:txt"}})
+
+		// verify
+		assert.Equal(t, http.StatusOK, status)
+
+		results := body["results"].([]any)
+		require.Len(t, results, 1)
+		assert.Equal(t, "docs/birthday-2024.txt", results[0].(map[string]any)["path"])
+	})
+
+	t.Run("success without results", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		status, body := get(t, server, url.Values{"q": {"nothing"}})
+
+		// verify
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, body["results"])
+	})
+
+	t.Run("failure with unknown mode", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		status, body := get(t, server, url.Values{"q": {"holiday"}, "mode": {"foo"}})
+
+		// verify
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "unknown search mode: foo", body["error"])
+	})
+
+	t.Run("failure with too many results", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		limited := httptest.NewServer(db.Handler(1))
+		t.Cleanup(limited.Close)
+
+		// execute
+		status, body := get(t, limited, url.Values{"q": {"holiday"}, "mode": {fast}})
+
+		// verify
+		assert.Equal(t, http.StatusUnprocessableEntity, status)
+		assert.Equal(t, maxResultsStop(1).message, body["error"])
+		assert.NotContains(t, body, "results")
+	})
+
+	t.Run("success keeping the index order", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		before := slices.Clone(db.SearchTerms["2024"])
+
+		// execute
+		status, _ := get(t, server, url.Values{"q": {"2024"}, "mode": {fast}})
+
+		// verify
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, before, db.SearchTerms["2024"])
+	})
+}
+
+func TestApp_Search_CSV(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success searching with csv output", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			`"bambam/foo, bar.txt",100,464f1ce84fed3d6837db4b810462f8de`,
+			"bambam/foo-baz.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"bambam/quix.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, Format: formatCSV}, []string{"foo"})
+		require.NoError(t, err)
+
+		// verify
+		rows, err := csv.NewReader(strings.NewReader(output.Get(0))).ReadAll()
+		require.NoError(t, err)
+
+		assert.Equal(t, [][]string{
+			{"path", "size", "hash"},
+			{"bambam/foo, bar.txt", "100", "464f1ce84fed3d6837db4b810462f8de"},
+			{"bambam/foo-baz.txt", "200", "4d09a656f20fee1beb093f30c7ec504c"},
+		}, rows)
+	})
+
+	t.Run("success printing only the header without results", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"bambam/quix.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, Format: formatCSV}, []string{"foo"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, []string{"path,size,hash\n"}, output.data)
+	})
+
+	t.Run("fail on a too broad search", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"bambam/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"bambam/foo-baz.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+		})
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, Format: formatCSV, MaxCandidates: 1}, []string{"foo"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, []string{"Search term 'foo' is too broad, it matches more than 1 files. Add more specific terms.\n"}, output.data)
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Search_JSON(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"bambam/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,,keep",
+		"bambam/quix.txt,300,788b62828f73d4bac70088ea91c90ef5",
+	})
+
+	tests := []struct {
+		name     string
+		terms    []string
+		expected []searchResult
+	}{
+		{
+			name:     "success searching with json output",
+			terms:    []string{"foo"},
+			expected: []searchResult{{Path: "bambam/foo-bar.txt", Size: 100, Hash: "464f1ce84fed3d6837db4b810462f8de", Tags: []string{"keep"}}},
+		},
+		{
+			name:     "success printing an empty result set without results",
+			terms:    []string{"nothing"},
+			expected: []searchResult{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			output := NewTestOutput(t, nil)
+
+			// execute
+			err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, Format: formatJSON}, tt.terms)
+			require.NoError(t, err)
+
+			// verify
+			require.Len(t, output.data, 1)
+
+			var content map[string][]searchResult
+			require.NoError(t, json.Unmarshal([]byte(output.Get(0)), &content))
+			assert.Equal(t, tt.expected, content["results"])
+		})
+	}
+}
+
+func TestApp_Repl(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success answering a scripted sequence of queries", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"bambam/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"bambam/foobar.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"bambam/quix.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, []string{
+			"foo",
+			":fast",
+			"foo",
+			"",
+			":limit 1",
+			":slow",
+			"foo",
+			":limit x",
+			":bogus",
+			":quit",
+			"quix",
+		})
+
+		// execute
+		err := ReplCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		expected := []string{
+			"Loaded 3 files, enter search queries (:fast, :slow, :limit N, :quit)\n",
+			"[1] bambam/foo-bar.txt (0 MB)\n",
+			"[2] bambam/foobar.txt (0 MB)\n",
+			"Search mode: fast\n",
+			"[1] bambam/foo-bar.txt (0 MB)\n",
+			"Limit: 1\n",
+			"Search mode: slow\n",
+			"[1] bambam/foo-bar.txt (0 MB)\n",
+			"... (showing 1 of 2)\n",
+			"Invalid limit: x\n",
+			"Unknown command: :bogus\n",
+		}
+		for i, line := range expected {
+			assert.Equal(t, line, stripColors(output.Get(i)))
+		}
+		assert.Empty(t, output.Get(len(expected)))
+	})
+
+	t.Run("fail reading the DB from stdin", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ReplCommand(output, stdinDBFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "The DB can't be read from stdin, as the queries are read from it\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Search_TSV(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success searching with tsv output", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			`"bambam/foo, bar.txt",100,464f1ce84fed3d6837db4b810462f8de`,
+			"bambam/foo-baz.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"bambam/quix.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, Format: formatTSV}, []string{"foo"})
+		require.NoError(t, err)
+
+		// verify
+		expected := "path\tsize\thash\n" +
+			"bambam/foo, bar.txt\t100\t464f1ce84fed3d6837db4b810462f8de\n" +
+			"bambam/foo-baz.txt\t200\t4d09a656f20fee1beb093f30c7ec504c\n"
+		assert.Equal(t, expected, output.Get(0))
+	})
+
+	t.Run("success escaping tabs and adding modification times", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"\"bambam/foo\tbar.txt\",100,464f1ce84fed3d6837db4b810462f8de,1700000000",
+			"bambam/foo-baz.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermSearchCommand(output, dbFile, SearchOptions{Mode: slow, Format: formatTSV, ShowTime: showTimeAbsolute}, []string{"foo"})
+		require.NoError(t, err)
+
+		// verify
+		modTime := time.Unix(1700000000, 0).Local().Format(time.RFC3339)
+
+		expected := "path\tsize\thash\tmtime\n" +
+			"bambam/foo\\tbar.txt\t100\t464f1ce84fed3d6837db4b810462f8de\t" + modTime + "\n" +
+			"bambam/foo-baz.txt\t200\t4d09a656f20fee1beb093f30c7ec504c\t\n"
+		assert.Equal(t, expected, output.Get(0))
+	})
+}
+
+func Test_ParseQuery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    Query
+		wantErr bool
+	}{
+		{
+			name: "plain terms",
+			args: []string{"foo", "bar"},
+			want: Query{Terms: []string{"foo", "bar"}},
+		},
+		{
+			name: "mixed terms and filters",
+			args: []string{"ext:.JPG", "foo", "tag:Keep"},
+			want: Query{
+				Terms: []string{"foo"},
+				Filters: []QueryFilter{
+					{Field: QueryFieldExt, Value: "jpg"},
+					{Field: QueryFieldTag, Value: "keep"},
+				},
+			},
+		},
+		{
+			name: "unknown prefix is a plain term",
+			args: []string{"12:30"},
+			want: Query{Terms: []string{"12:30"}},
+		},
+		{
+			name:    "missing filter value",
+			args:    []string{"ext:"},
+			wantErr: true,
+		},
+		{
+			name:    "empty query",
+			args:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got, err := ParseQuery(tt.args)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApp_Report_Tree(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"photos/2023/a.jpg,2048,464f1ce84fed3d6837db4b810462f8de",
+			"photos/2023/b.jpg,1024,4d09a656f20fee1beb093f30c7ec504c",
+			"photos/2024/c.jpg,512,788b62828f73d4bac70088ea91c90ef5",
+			"docs/d.txt,100,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+	}
+
+	t.Run("success reporting all directories", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ReportCommand(output, dbFile, ReportOptions{Tree: true})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "    3.6 KB  .\n", output.Get(0))
+		assert.Equal(t, "    3.5 KB  photos\n", output.Get(1))
+		assert.Equal(t, "    3.0 KB  photos/2023\n", output.Get(2))
+		assert.Equal(t, "     512 B  photos/2024\n", output.Get(3))
+		assert.Equal(t, "     100 B  docs\n", output.Get(4))
+		assert.Empty(t, output.Get(5))
+	})
+
+	t.Run("success limiting depth", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ReportCommand(output, dbFile, ReportOptions{Tree: true, Depth: 1})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "    3.6 KB  .\n", output.Get(0))
+		assert.Equal(t, "    3.5 KB  photos\n", output.Get(1))
+		assert.Equal(t, "     100 B  docs\n", output.Get(2))
+		assert.Empty(t, output.Get(3))
+	})
+}
+
+func TestApp_Reindex(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"a/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,,photo",
+			"b/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,,",
+			"c/baz.jpg,300,788b62828f73d4bac70088ea91c90ef5,,",
+		})
+	}
+
+	t.Run("success rebuilding corrupted indexes", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		expected := NewDB(output, dbFile)
+		expected.Load()
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		delete(db.Hashes, "464f1ce84fed3d6837db4b810462f8de")
+		db.Hashes["bogus"] = []ID{"c/baz.jpg", "missing.txt"}
+		db.Sizes[100] = db.Sizes[100][:1]
+		db.SearchTerms["foo"] = append(db.SearchTerms["foo"], "missing.txt")
+		delete(db.Extensions, "jpg")
+		db.Tags["photo"] = nil
+
+		// execute
+		db.Reindex()
+
+		// verify
+		assert.Equal(t, "Reindexed 3 files\n", output.Get(0))
+		assert.Equal(t, expected.Files, db.Files)
+
+		for name, pair := range map[string][2]map[string][]ID{
+			"hashes":       {expected.Hashes, db.Hashes},
+			"search terms": {expected.SearchTerms, db.SearchTerms},
+			"extensions":   {expected.Extensions, db.Extensions},
+			"tags":         {expected.Tags, db.Tags},
+		} {
+			require.Len(t, pair[1], len(pair[0]), name)
+			for key, ids := range pair[0] {
+				assert.ElementsMatch(t, ids, pair[1][key], name+": "+key)
+			}
+		}
+
+		require.Len(t, db.Sizes, len(expected.Sizes))
+		for size, ids := range expected.Sizes {
+			assert.ElementsMatch(t, ids, db.Sizes[size])
+		}
+	})
+
+	t.Run("success writing the reindexed DB", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ReindexCommand(output, dbFile, false, false)
+		require.NoError(t, err)
+
+		// verify
+		content, err := os.ReadFile(dbFile)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(content), "a/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,,photo,,,,,,,,,\n"))
+	})
+
+	t.Run("success updating outdated hashes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dir := t.TempDir()
+		oldPath := filepath.Join(dir, "old.txt")
+		currentPath := filepath.Join(dir, "current.txt")
+
+		content := []byte("hello world")
+		require.NoError(t, os.WriteFile(oldPath, content, 0o644))
+		require.NoError(t, os.WriteFile(currentPath, content, 0o644))
+
+		dbFile := writeTestDB(t, []string{
+			oldPath + ",11,00000000000000000000000000000000,,,,ffffffff,,sample-512k",
+			currentPath + ",11," + md5Hex(content) + ",,,,,,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ReindexCommand(output, dbFile, false, true)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Updated 1 outdated hashes, 0 failed\n", output.Get(0))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		record := db.Files[ID(oldPath)]
+		assert.Equal(t, md5Hex(content), record.Hash)
+		assert.Equal(t, crc32Hex(content), record.CRC32)
+		assert.Empty(t, record.HashMode)
+		assert.ElementsMatch(t, []ID{ID(oldPath), ID(currentPath)}, db.Hashes[md5Hex(content)])
+		assert.NotContains(t, db.Hashes, "00000000000000000000000000000000")
+	})
+}
+
+func TestApp_Rehash(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello world")
+	md5Hash := hashData(content, hashAlgoMD5)
+	sha256Hash := hashData(content, hashAlgoSHA256)
+
+	setup := func(t *testing.T) (string, string, string) {
+		t.Helper()
+
+		dir := t.TempDir()
+		foo := filepath.Join(dir, "foo.txt")
+		bar := filepath.Join(dir, "bar.txt")
+
+		require.NoError(t, os.WriteFile(foo, content, 0o644))
+		require.NoError(t, os.WriteFile(bar, content, 0o644))
+
+		// foo was scanned with md5 only, bar with sha256 only
+		dbFile := writeTestDB(t, []string{
+			foo + ",11," + md5Hash + ",,,,,",
+			bar + ",11,,,,,,sha256:" + sha256Hash,
+		})
+
+		return dbFile, foo, bar
+	}
+
+	t.Run("success loading mixed algorithm records", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile, foo, bar := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		// execute
+		md5Groups := db.duplicatesBySizeAndHash(DuplicateOptions{HashAlgo: hashAlgoMD5})
+		sha256Groups := db.duplicatesBySizeAndHash(DuplicateOptions{HashAlgo: hashAlgoSHA256})
+
+		// verify
+		assert.Empty(t, md5Groups)
+		assert.Empty(t, sha256Groups)
+		assert.Equal(t, []ID{ID(foo)}, db.Hashes[md5Hash])
+		assert.Equal(t, []ID{ID(bar)}, db.AlgoHashes[hashAlgoSHA256][sha256Hash])
+	})
+
+	t.Run("success backfilling the missing hashes", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile, foo, bar := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := RehashCommand(output, dbFile, hashAlgoSHA256)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Rehashed 1 files with sha256, 0 failed\n", output.Get(0))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		sha256Groups := db.duplicatesBySizeAndHash(DuplicateOptions{HashAlgo: hashAlgoSHA256})
+		require.Len(t, sha256Groups, 1)
+		for _, group := range sha256Groups {
+			assert.ElementsMatch(t, []ID{ID(foo), ID(bar)}, group.IDs)
+		}
+
+		// the md5 hash of foo is kept, bar still has none
+		assert.Equal(t, md5Hash, db.Files[ID(foo)].Hash)
+		assert.Empty(t, db.Files[ID(bar)].Hash)
+	})
+
+	t.Run("fail on unknown algorithm", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile, _, _ := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := RehashCommand(output, dbFile, "sha1")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Unknown hash algorithm: sha1\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Convert(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success converting to binary and back", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		csvFile := writeTestDB(t, []string{
+			"a/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,1700000000,photo;keep,tail,0a1b2c3d,sha256:abc",
+			"b/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,,,,,",
+			"c/baz.jpg,300,,,,,,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// - normalize the CSV file, so that it can be compared byte by byte
+		err := ReindexCommand(output, csvFile, false, false)
+		require.NoError(t, err)
+
+		original, err := os.ReadFile(csvFile)
+		require.NoError(t, err)
+
+		binaryFile := filepath.Join(t.TempDir(), "db"+binaryDBExtension)
+		restoredFile := filepath.Join(t.TempDir(), "db.csv")
+
+		// execute
+		err = ConvertCommand(output, csvFile, binaryFile, "")
+		require.NoError(t, err)
+
+		err = ConvertCommand(output, binaryFile, restoredFile, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 0, output.exitCode)
+		assert.Equal(t, "Converted 3 files to "+binaryFile+"\n", output.Get(1))
+
+		restored, err := os.ReadFile(restoredFile)
+		require.NoError(t, err)
+		assert.Equal(t, string(original), string(restored))
+
+		expected := NewDB(output, csvFile)
+		expected.Load()
+
+		db := NewDB(output, binaryFile)
+		db.Load()
+
+		assert.Equal(t, expected.Files, db.Files)
+		assert.Equal(t, expected.Hashes, db.Hashes)
+		assert.Equal(t, expected.AlgoHashes, db.AlgoHashes)
+		assert.Equal(t, expected.SearchTerms, db.SearchTerms)
+	})
+
+	t.Run("success recalculating the stored search terms after the settings changed", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		csvFile := writeTestDB(t, []string{
+			"a/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,,,,,",
+			"b/holiday-2024.jpg,200,,,,,,",
+		})
+		binaryFile := filepath.Join(t.TempDir(), "db"+binaryDBExtension)
+
+		output := NewTestOutput(t, nil)
+
+		err := ConvertCommand(output, csvFile, binaryFile, "")
+		require.NoError(t, err)
+
+		setting := []byte(metaSetting + "," + metaSettingMinTermLength + ",4\n")
+		require.NoError(t, os.WriteFile(csvFile+metaFileSuffix, setting, 0o644))
+		require.NoError(t, os.WriteFile(binaryFile+metaFileSuffix, setting, 0o644))
+
+		expected := NewDB(output, csvFile)
+		expected.Load()
+
+		// execute
+		db := NewDB(output, binaryFile)
+		db.Load()
+
+		// verify
+		assert.NotContains(t, db.SearchTerms, "foo")
+		assert.Contains(t, db.SearchTerms, "holiday")
+		assert.Equal(t, expected.Files, db.Files)
+		assert.Equal(t, expected.SearchTerms, db.SearchTerms)
+	})
+
+	t.Run("success loading a binary DB without stored search terms", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		csvFile := writeTestDB(t, []string{"a/foo-bar.txt,100,464f1ce84fed3d6837db4b810462f8de,,,,,"})
+		binaryFile := filepath.Join(t.TempDir(), "db"+binaryDBExtension)
+
+		// - version 1 files have no search terms stored
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode(binaryDB{
+			Version: 1,
+			Records: []binaryRecord{{Path: "a/foo-bar.txt", Size: 100, Hash: "464f1ce84fed3d6837db4b810462f8de"}},
+		}))
+		require.NoError(t, os.WriteFile(binaryFile, buf.Bytes(), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		expected := NewDB(output, csvFile)
+		expected.Load()
+
+		// execute
+		db := NewDB(output, binaryFile)
+		db.Load()
+
+		// verify
+		assert.Equal(t, expected.Files, db.Files)
+		assert.Equal(t, expected.SearchTerms, db.SearchTerms)
+	})
+
+	t.Run("success round-tripping a tab delimited DB", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		csvFile := writeTestDB(t, []string{
+			`"a/foo, bar.txt",100,464f1ce84fed3d6837db4b810462f8de,1700000000,photo;keep`,
+			`"b/1,2,3.txt",200,4d09a656f20fee1beb093f30c7ec504c,,,,,`,
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// - normalize the CSV file, so that it can be compared byte by byte
+		err := ReindexCommand(output, csvFile, false, false)
+		require.NoError(t, err)
+
+		original, err := os.ReadFile(csvFile)
+		require.NoError(t, err)
+
+		tsvFile := filepath.Join(t.TempDir(), "db.tsv")
+		restoredFile := filepath.Join(t.TempDir(), "db.csv")
+
+		// execute
+		err = ConvertCommand(output, csvFile, tsvFile, "tab")
+		require.NoError(t, err)
+
+		// - the delimiter is kept by commands rewriting the DB
+		err = TagCommand(output, tsvFile, "a/foo, bar.txt", []string{"holiday"})
+		require.NoError(t, err)
+
+		converted, err := os.ReadFile(tsvFile)
+		require.NoError(t, err)
+
+		err = ConvertCommand(output, tsvFile, restoredFile, ",")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 0, output.exitCode)
+
+		lines := strings.Split(string(converted), "\n")
+		assert.Equal(t, "#delimiter=tab", lines[0])
+		assert.Equal(t, "a/foo, bar.txt\t100\t464f1ce84fed3d6837db4b810462f8de\t1700000000\tphoto;keep;holiday\t\t\t\t\t\t\t\t\t", lines[1])
+		assert.Equal(t, "b/1,2,3.txt\t200\t4d09a656f20fee1beb093f30c7ec504c\t\t\t\t\t\t\t\t\t\t\t", lines[2])
+
+		restored, err := os.ReadFile(restoredFile)
+		require.NoError(t, err)
+		assert.Equal(t, strings.Replace(string(original), "photo;keep", "photo;keep;holiday", 1), string(restored))
+	})
+
+	t.Run("fail with an invalid delimiter", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		csvFile := writeTestDB(t, nil)
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ConvertCommand(output, csvFile, filepath.Join(t.TempDir(), "db.csv"), "ab")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Invalid delimiter: 'ab' can't separate fields, use a single character or tab\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+
+	t.Run("success loading an empty binary DB", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		binaryFile := filepath.Join(t.TempDir(), "db"+binaryDBExtension)
+		require.NoError(t, os.WriteFile(binaryFile, nil, 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		db := NewDB(output, binaryFile)
+		db.Load()
+
+		// verify
+		assert.Equal(t, 0, output.exitCode)
+		assert.Empty(t, db.Files)
+	})
+}
+
+func TestDB_Load_Streaming(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	lines := []string{
+		"b/foo.txt,100,464f1ce84fed3d6837db4b810462f8de,1700000000,photo",
+		"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de,1700000000,",
+		"c/bar-baz.txt,200,4d09a656f20fee1beb093f30c7ec504c,1700000000,photo",
+		"a/bar.jpg,200,,,",
+		"a/sub/foo.txt,100,464f1ce84fed3d6837db4b810462f8de,1600000000,",
+	}
+	dbFile := writeTestDB(t, lines)
+
+	// The reference loader reads all rows at once and handles them sorted by path
+	records, err := readCsvFile(dbFile)
+	require.NoError(t, err)
+	slices.SortFunc(records, func(a, b []string) int {
+		return strings.Compare(a[colPath], b[colPath])
+	})
+
+	expected := NewDB(NewTestOutput(t, nil), dbFile)
+	for _, record := range records {
+		expected.handleRecord(record)
+	}
+
+	// execute
+	db := NewDB(NewTestOutput(t, nil), dbFile)
+	db.Load()
+
+	// verify
+	assert.Equal(t, expected.Files, db.Files)
+	assert.Equal(t, expected.Sizes, db.Sizes)
+	assert.Equal(t, expected.Hashes, db.Hashes)
+	assert.Equal(t, expected.AlgoHashes, db.AlgoHashes)
+	assert.Equal(t, expected.SearchTerms, db.SearchTerms)
+	assert.Equal(t, expected.Extensions, db.Extensions)
+	assert.Equal(t, expected.Tags, db.Tags)
+	assert.Equal(t, expected.sortedIDs, db.sortedIDs)
+}
+
+func BenchmarkDB_Load(b *testing.B) {
+	lines := make([]string, 0, 10000)
+	for i := range 10000 {
+		lines = append(lines, fmt.Sprintf("/data/%d/2021.12.31-DSC_%d-Verbessert-RR-Bearbeitet.jpg,%d,%032x,1700000000,,,,", i%100, i, i*1000, i))
+	}
+
+	dir := b.TempDir()
+	csvFile := filepath.Join(dir, "db.csv")
+	binaryFile := filepath.Join(dir, "db"+binaryDBExtension)
+
+	require.NoError(b, os.WriteFile(csvFile, []byte(strings.Join(lines, "\n")), 0o644))
+	require.NoError(b, ConvertCommand(NewStdOut(), csvFile, binaryFile, ""))
+
+	for _, dbFile := range []string{csvFile, binaryFile} {
+		b.Run(filepath.Ext(dbFile), func(b *testing.B) {
+			for range b.N {
+				db := NewDB(NewStdOut(), dbFile)
+				db.Load()
+			}
+		})
+	}
+}
+
+func BenchmarkDB_Load_Large(b *testing.B) {
+	lines := make([]string, 0, 200000)
+	for i := range 200000 {
+		lines = append(lines, fmt.Sprintf("/data/%d/%d/IMG_%d.jpg,%d,%032x,1700000000,,,,", i%100, i%1000, i, i*1000, i))
+	}
+
+	dbFile := filepath.Join(b.TempDir(), "db.csv")
+	require.NoError(b, os.WriteFile(dbFile, []byte(strings.Join(lines, "\n")), 0o644))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		db := NewDB(NewStdOut(), dbFile)
+		db.Load()
+	}
+}
+
+func TestApp_Overlap(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success reporting the files of the other catalog missing from the primary", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"/main/foo.txt,1024,464f1ce84fed3d6837db4b810462f8de",
+			"/main/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"/main/quix.txt,500,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+		otherFile := writeTestDB(t, []string{
+			"/backup/foo-copy.txt,1024,464f1ce84fed3d6837db4b810462f8de",
+			"/backup/foo-again.txt,1024,464f1ce84fed3d6837db4b810462f8de",
+			"/backup/bar.txt,250,4d09a656f20fee1beb093f30c7ec504c",
+			"/backup/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+			"/backup/new.txt,400,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := OverlapCommand(output, dbFile, otherFile)
+		require.NoError(t, err)
+
+		// verify
+		// - bar.txt differs in size, baz.txt is not in the primary catalog
+		assert.Equal(t, "/backup/bar.txt\n", output.Get(0))
+		assert.Equal(t, "/backup/baz.txt\n", output.Get(1))
+		assert.Equal(t, "/backup/new.txt (not hashed)\n", output.Get(2))
+		assert.Equal(t, fmt.Sprintf("Files missing from %s: 3\n", dbFile), output.Get(3))
+		assert.Equal(t, fmt.Sprintf("Files of %s present in %s: 2 of 5 (2.0 KB of 2.9 KB)\n", otherFile, dbFile), output.Get(4))
+	})
+
+	t.Run("fail without the other catalog", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, nil)
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := OverlapCommand(output, dbFile, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No other DB file given\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Reconcile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success listing the files to copy and delete", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sourceFile := writeTestDB(t, []string{
+			"/photos/foo.jpg,1024,464f1ce84fed3d6837db4b810462f8de",
+			"/photos/bar.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+			"/photos/baz.jpg,300,788b62828f73d4bac70088ea91c90ef5",
+			"/photos/new.jpg,400,",
+		})
+		targetFile := writeTestDB(t, []string{
+			"/backup/foo-renamed.jpg,1024,464f1ce84fed3d6837db4b810462f8de",
+			"/backup/bar.jpg,250,4d09a656f20fee1beb093f30c7ec504c",
+			"/backup/old.jpg,500,acbd18db4cc2f85cedef654fccc4a4d8",
+			"/backup/unknown.jpg,600,",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ReconcileCommand(output, sourceFile, targetFile)
+		require.NoError(t, err)
+
+		// verify
+		// - foo.jpg is present under another name, bar.jpg differs in size, unknown.jpg can't be compared
+		assert.Equal(t, "copy /photos/bar.jpg\n", output.Get(0))
+		assert.Equal(t, "copy /photos/baz.jpg\n", output.Get(1))
+		assert.Equal(t, "copy /photos/new.jpg (not hashed)\n", output.Get(2))
+		assert.Equal(t, "delete /backup/bar.jpg\n", output.Get(3))
+		assert.Equal(t, "delete /backup/old.jpg\n", output.Get(4))
+		assert.Equal(t, fmt.Sprintf("Files to copy to %s: 3 (900 B)\n", targetFile), output.Get(5))
+		assert.Equal(t, fmt.Sprintf("Files to delete from %s: 2 (750 B)\n", targetFile), output.Get(6))
+		assert.Equal(t, fmt.Sprintf("Files of %s kept without a hash to compare: 1\n", targetFile), output.Get(7))
+	})
+
+	t.Run("success with matching catalogs", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sourceFile := writeTestDB(t, []string{
+			"/photos/foo.jpg,1024,464f1ce84fed3d6837db4b810462f8de",
+		})
+		targetFile := writeTestDB(t, []string{
+			"/backup/foo.jpg,1024,464f1ce84fed3d6837db4b810462f8de",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ReconcileCommand(output, sourceFile, targetFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("Files to copy to %s: 0 (0 B)\n", targetFile), output.Get(0))
+		assert.Equal(t, fmt.Sprintf("Files to delete from %s: 0 (0 B)\n", targetFile), output.Get(1))
+		assert.Empty(t, output.Get(2))
+	})
+
+	t.Run("fail without the target catalog", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sourceFile := writeTestDB(t, nil)
+
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ReconcileCommand(output, sourceFile, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No target DB file given\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Roots(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success summarizing stored and derived roots", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"/driveA/photos/foo.jpg,1024,464f1ce84fed3d6837db4b810462f8de",
+			"/driveA/bar.txt,1024,4d09a656f20fee1beb093f30c7ec504c",
+			"/driveB/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+			"/other/sub/quix.txt,200,acbd18db4cc2f85cedef654fccc4a4d8",
+			"/other/quux.txt,100,",
+		})
+		require.NoError(t, os.WriteFile(dbFile+metaFileSuffix, []byte("/driveA,2024-01-01T00:00:00Z\n/driveB,2024-01-01T00:00:00Z\n"), 0o644))
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := RootsCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "/driveA: 2 files, 2.0 KB\n", output.Get(0))
+		assert.Equal(t, "/driveB: 1 files, 300 B\n", output.Get(1))
+		assert.Equal(t, "/other: 2 files, 300 B (derived)\n", output.Get(2))
+		assert.Empty(t, output.Get(3))
+	})
+
+	t.Run("success reporting an empty catalog", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, nil)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := RootsCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No files catalogued\n", output.Get(0))
+	})
+}
+
+func Test_topLevelDir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/data/photos/foo.jpg", want: "/data"},
+		{path: "data/photos/foo.jpg", want: "data"},
+		{path: "/foo.jpg", want: "/"},
+		{path: "foo.jpg", want: "."},
+		{path: "/data/backup.zip::inner/foo.jpg", want: "/data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got := topLevelDir(tt.path)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApp_ByHash(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"/driveA/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/driveB/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/driveA/bar.txt,200,464f1ce84aaaaaaaaaaaaaaaaaaaaaaa",
+			"/driveA/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+	}
+
+	t.Run("success listing the files of a unique prefix", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := setup(t)
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ByHashCommand(output, dbFile, "788B6282")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "788b62828f73d4bac70088ea91c90ef5:\n", output.Get(0))
+		assert.Equal(t, "[1] /driveA/baz.txt (0 MB)\n", stripColors(output.Get(1)))
+		assert.Empty(t, output.Get(2))
+	})
+
+	t.Run("success warning about an ambiguous prefix", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := setup(t)
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ByHashCommand(output, dbFile, "464f1ce8")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Warning: hash prefix 464f1ce8 is ambiguous, it matches 2 hashes\n", output.Get(0))
+		assert.Equal(t, "464f1ce84aaaaaaaaaaaaaaaaaaaaaaa:\n", output.Get(1))
+		assert.Equal(t, "[1] /driveA/bar.txt (0 MB)\n", stripColors(output.Get(2)))
+		assert.Equal(t, "464f1ce84fed3d6837db4b810462f8de:\n", output.Get(3))
+		assert.Equal(t, "[1] /driveA/foo.txt (0 MB)\n", stripColors(output.Get(4)))
+		assert.Equal(t, "[2] /driveB/foo.txt (0 MB)\n", stripColors(output.Get(5)))
+	})
+
+	t.Run("fail with a too short prefix", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := setup(t)
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := ByHashCommand(output, dbFile, "464f")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Hash prefix is too short, give at least 6 characters\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+
+	t.Run("success reporting no matches", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := setup(t)
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := ByHashCommand(output, dbFile, "ffffff")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No files found with hash prefix ffffff\n", output.Get(0))
+	})
+}
+
+func TestApp_UniqueTo(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"/driveA/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/driveA/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"/driveA/sub/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+			"/driveA/sub/baz-copy.txt,300,788b62828f73d4bac70088ea91c90ef5",
+			"/driveA/new.txt,400,",
+			"/driveB/foo-backup.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/driveB/bar.txt,250,4d09a656f20fee1beb093f30c7ec504c",
+			"/driveB/quix.txt,500,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+	}
+
+	t.Run("success listing files without a copy outside of the root", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := UniqueToCommand(output, dbFile, "/driveA")
+		require.NoError(t, err)
+
+		// verify
+		// - bar.txt differs in size on driveB, baz.txt is only copied within driveA
+		assert.Equal(t, "/driveA/bar.txt\n", output.Get(0))
+		assert.Equal(t, "/driveA/new.txt (not hashed)\n", output.Get(1))
+		assert.Equal(t, "/driveA/sub/baz-copy.txt\n", output.Get(2))
+		assert.Equal(t, "/driveA/sub/baz.txt\n", output.Get(3))
+		assert.Equal(t, "Files unique to /driveA: 4\n", output.Get(4))
+	})
+
+	t.Run("success listing files of the other root", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := UniqueToCommand(output, dbFile, "/driveB")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "/driveB/bar.txt\n", output.Get(0))
+		assert.Equal(t, "/driveB/quix.txt\n", output.Get(1))
+		assert.Equal(t, "Files unique to /driveB: 2\n", output.Get(2))
+	})
+
+	t.Run("fail without root", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := UniqueToCommand(output, dbFile, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No root given\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Collisions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success listing paths only differing in case", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"/data/Foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/data/foo.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"/data/bar.txt,300,788b62828f73d4bac70088ea91c90ef5",
+			"/Data/bar.txt,300,788b62828f73d4bac70088ea91c90ef5",
+			"/data/baz.txt,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := CollisionsCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "/Data/bar.txt\n", output.Get(0))
+		assert.Equal(t, "/data/bar.txt\n", output.Get(1))
+		assert.Equal(t, "\n", output.Get(2))
+		assert.Equal(t, "/data/Foo.txt\n", output.Get(3))
+		assert.Equal(t, "/data/foo.txt\n", output.Get(4))
+		assert.Equal(t, "\n", output.Get(5))
+		assert.Equal(t, "Case collisions: 2\n", output.Get(6))
+	})
+
+	t.Run("success without collisions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"/data/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/data/bar.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := CollisionsCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Case collisions: 0\n", output.Get(0))
+	})
+}
+
+func TestApp_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success appending snapshots", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"b/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"c/bar.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := SnapshotCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// - the catalog grows between the snapshots
+		db := NewDB(output, dbFile)
+		db.Load()
+		require.NoError(t, db.add(Record{Path: "d/baz.txt", Size: 1000, Hash: "4d09a656f20fee1beb093f30c7ec504c"}))
+		require.NoError(t, db.Write())
+
+		err = SnapshotCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Snapshot recorded: 3 files, 500 B, 2 unique hashes, 100 B duplicate waste\n", output.Get(0))
+		assert.Equal(t, "Snapshot recorded: 4 files, 1.5 KB, 3 unique hashes, 100 B duplicate waste\n", output.Get(1))
+
+		snapshots, err := readSnapshots(dbFile + historyFileSuffix)
+		require.NoError(t, err)
+		require.Len(t, snapshots, 2)
+
+		assert.Equal(t, 3, snapshots[0].Records)
+		assert.Equal(t, int64(500), snapshots[0].Bytes)
+		assert.Equal(t, 2, snapshots[0].UniqueHashes)
+		assert.Equal(t, int64(100), snapshots[0].Waste)
+		assert.Equal(t, 4, snapshots[1].Records)
+		assert.Equal(t, int64(1500), snapshots[1].Bytes)
+		assert.False(t, snapshots[1].Time.Before(snapshots[0].Time))
+	})
+}
+
+func TestApp_Trend(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		dbFile := writeTestDB(t, nil)
+
+		history := "2024-01-01T10:00:00Z,1000,1048576,900,0\n" +
+			"2024-02-01T10:00:00Z,2000,2097152,1800,1024\n" +
+			"2024-03-01T10:00:00Z,4000,4194304,3500,2048\n"
+		require.NoError(t, os.WriteFile(dbFile+historyFileSuffix, []byte(history), 0o644))
+
+		return dbFile
+	}
+
+	t.Run("success printing a table", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TrendCommand(output, dbFile, formatTable)
+		require.NoError(t, err)
+
+		// verify
+		assert.Contains(t, output.Get(0), "files")
+		assert.Contains(t, output.Get(1), "1,000")
+		assert.Contains(t, output.Get(1), "1.0 MB")
+		assert.Contains(t, output.Get(3), "4,000")
+		assert.Contains(t, output.Get(3), "2.0 KB")
+	})
+
+	t.Run("success printing sparklines", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TrendCommand(output, dbFile, formatSparkline)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Files:  ▁▃█ (1,000 - 4,000)\n", output.Get(0))
+		assert.Equal(t, "Waste:  ▁▄█ (0 B - 2.0 KB)\n", output.Get(3))
+	})
+
+	t.Run("success without history", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, nil)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TrendCommand(output, dbFile, formatTable)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No snapshots recorded yet\n", output.Get(0))
+	})
+}
+
+func TestDB_idsUnder(t *testing.T) {
+	t.Parallel()
+
+	dbFile := writeTestDB(t, []string{
+		"/data/sub/deep/quix.txt,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		"/data/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"/data-old/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"/data2/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+		"/data/sub/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+		"/data,50,4d09a656f20fee1beb093f30c7ec504c",
+	})
+
+	tests := []struct {
+		dir  string
+		want []ID
+	}{
+		{dir: "/data", want: []ID{"/data", "/data/foo.txt", "/data/sub/bar.txt", "/data/sub/deep/quix.txt"}},
+		{dir: "/data/", want: []ID{"/data", "/data/foo.txt", "/data/sub/bar.txt", "/data/sub/deep/quix.txt"}},
+		{dir: "/data/sub", want: []ID{"/data/sub/bar.txt", "/data/sub/deep/quix.txt"}},
+		{dir: "/data/foo.txt", want: []ID{"/data/foo.txt"}},
+		{dir: "/data2", want: []ID{"/data2/baz.txt"}},
+		{dir: "/dat", want: nil},
+		{dir: "/", want: []ID{"/data", "/data-old/foo.txt", "/data/foo.txt", "/data/sub/bar.txt", "/data/sub/deep/quix.txt", "/data2/baz.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			db := NewDB(NewTestOutput(t, nil), dbFile)
+			db.Load()
+
+			// execute
+			got := db.idsUnder(tt.dir)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("success keeping the index sorted when adding and removing files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		// execute
+		require.NoError(t, db.add(Record{Path: "/data/sub/aaa.txt", Size: 1}))
+		db.remove("/data/sub/bar.txt")
+
+		// verify
+		assert.True(t, slices.IsSorted(db.sortedIDs))
+		assert.Equal(t, []ID{"/data/sub/aaa.txt", "/data/sub/deep/quix.txt"}, db.idsUnder("/data/sub"))
+	})
+}
+
+func BenchmarkDB_idsUnder(b *testing.B) {
+	db := NewDB(NewStdOut(), "")
+	for i := range 100000 {
+		require.NoError(b, db.add(Record{Path: fmt.Sprintf("/data/%03d/file-%d.txt", i%1000, i), Size: i}))
+	}
+
+	b.Run("binary search", func(b *testing.B) {
+		for range b.N {
+			_ = db.idsUnder("/data/500")
+		}
+	})
+
+	b.Run("linear scan", func(b *testing.B) {
+		for range b.N {
+			var ids []ID
+			for id := range db.Files {
+				if isUnderRoot(string(id), "/data/500") {
+					ids = append(ids, id)
+				}
+			}
+		}
+	})
+}
+
+func Test_intersectAllIDs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		idGroups [][]ID
+		want     []ID
+	}{
+		{
+			name:     "single group",
+			idGroups: [][]ID{{"b", "a"}},
+			want:     []ID{"b", "a"},
+		},
+		{
+			name:     "keeping the order of the first group",
+			idGroups: [][]ID{{"d", "c", "b", "a"}, {"a", "c"}, {"c", "a", "d"}},
+			want:     []ID{"c", "a"},
+		},
+		{
+			name:     "keeping the repetitions of the first group",
+			idGroups: [][]ID{{"a", "b", "a"}, {"a"}},
+			want:     []ID{"a", "a"},
+		},
+		{
+			name:     "no overlap",
+			idGroups: [][]ID{{"a", "b", "c"}, {"d"}, {"a"}},
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got := intersectAllIDs(tt.idGroups)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func BenchmarkIntersectAllIDs(b *testing.B) {
+	// Two very common terms (e.g. "photo" and "2023") and a very rare one, in the order of the query
+	common := make([]ID, 0, 10000)
+	for i := range 10000 {
+		common = append(common, ID(fmt.Sprintf("/data/file-%d.txt", i)))
+	}
+
+	otherCommon := slices.Clone(common[5000:])
+	rare := []ID{common[9990], "/elsewhere/file.txt"}
+	idGroups := [][]ID{common, otherCommon, rare}
+
+	b.Run("rarest first", func(b *testing.B) {
+		for range b.N {
+			_ = intersectAllIDs(idGroups)
+		}
+	})
+
+	b.Run("in query order", func(b *testing.B) {
+		for range b.N {
+			idGroup := idGroups[0]
+			for _, termIDs := range idGroups[1:] {
+				idGroup = intersectIDs(idGroup, termIDs)
+			}
+		}
+	})
+}
+
+func TestApp_TermSearch_UnicodeNormalization(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"mac/cafe\u0301-paris.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+			"linux/caf\u00e9-lyon.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+		})
+	}
+
+	for name, needle := range map[string]string{"composed": "caf\u00e9", "decomposed": "cafe\u0301"} {
+		for _, mode := range []string{fast, slow} {
+			t.Run("success finding both forms by "+name+" needle in "+mode+" mode", func(t *testing.T) {
+				t.Parallel()
+
+				dbFile := setup(t)
+
+				// setup
+				output := NewTestOutput(t, nil)
+
+				// execute
+				err := TermSearchCommand(output, dbFile, SearchOptions{Mode: mode}, []string{needle})
+				require.NoError(t, err)
+
+				// verify
+				assert.Equal(t, "[1] linux/caf\u00e9-lyon.jpg (0 MB)\n", stripColors(output.Get(0)))
+				assert.Equal(t, "[2] mac/cafe\u0301-paris.jpg (0 MB)\n", stripColors(output.Get(1)))
+				assert.Contains(t, output.Get(1), "\033[31mcafe\u0301\033[0m")
+			})
+		}
+	}
+}
+
+func TestDB_Load_RepeatedTerms(t *testing.T) {
+	t.Parallel()
+
+	// setup
+	dbFile := writeTestDB(t, []string{
+		"a/foo-foo-bar-foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"b/foo-baz.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+	})
+
+	db := NewDB(NewTestOutput(t, nil), dbFile)
+
+	// execute
+	db.Load()
+
+	// verify
+	assert.Equal(t, []string{"foo", "bar", "foo.txt"}, db.Files["a/foo-foo-bar-foo.txt"].SearchTerms)
+	assert.Equal(t, []ID{"a/foo-foo-bar-foo.txt", "b/foo-baz.txt"}, db.SearchTerms["foo"])
+
+	// removing the file must not leave any of its IDs behind
+	db.remove("a/foo-foo-bar-foo.txt")
+	assert.Equal(t, []ID{"b/foo-baz.txt"}, db.SearchTerms["foo"])
+}
+
+func TestApp_TermSearch_LongNames(t *testing.T) {
+	t.Parallel()
+
+	blob := strings.Repeat("abcdefghij", 50)
+
+	t.Run("success splitting a 500 character term into chunks", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"blobs/" + blob + "-photo.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		})
+
+		// execute
+		db := NewDB(NewTestOutput(t, nil), dbFile)
+		db.Load()
+
+		// verify
+		terms := db.Files[ID("blobs/"+blob+"-photo.jpg")].SearchTerms
+		require.Len(t, terms, 5)
+		assert.Equal(t, blob[:128], terms[0])
+		assert.Equal(t, blob[384:], terms[3])
+		assert.Equal(t, "photo.jpg", terms[4])
+		assert.Equal(t, blob, strings.Join(terms[:4], ""))
+		assert.NotContains(t, db.SearchTerms, blob)
+	})
+
+	t.Run("success finding the file by a chunk with a configured maximum", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+		// file systems limit file names to 255 bytes
+		name := blob[:240] + ".bin"
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte("blob"), 0o644))
+
+		err := ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{MaxTermLength: 100})
+		require.NoError(t, err)
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err = TermSearchCommand(output, dbFile, SearchOptions{Mode: fast}, []string{blob[100:200]})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, fmt.Sprintf("[1] %s (0 MB)\n", filepath.Join(root, name)), stripColors(output.Get(0)))
+	})
+}
+
+func Test_splitLongTerms(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		terms     []string
+		maxLength int
+		want      []string
+	}{
+		{name: "short terms", terms: []string{"foo", "bar"}, maxLength: 3, want: []string{"foo", "bar"}},
+		{name: "long term", terms: []string{"abcdefgh"}, maxLength: 3, want: []string{"abc", "def", "gh"}},
+		{name: "multibyte runes", terms: []string{"aéé"}, maxLength: 2, want: []string{"a", "é", "é"}},
+		{name: "rune longer than maximum", terms: []string{"éa"}, maxLength: 1, want: []string{"é", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got := splitLongTerms(tt.terms, tt.maxLength)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApp_StdinDB(t *testing.T) {
+	t.Parallel()
+
+	catalog := []string{
+		"bambam/foo-1786396036.txt,100,464f1ce84fed3d6837db4b810462f8de",
+		"bambam/bar-1786396036.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+		"bambam/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+	}
+
+	t.Run("success searching a catalog piped through stdin", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, catalog)
+
+		// execute
+		err := CreateApp(output).Run([]string{"file-catalog", ts, "--mode", slow, stdinDBFile, "1786396"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "[1] bambam/bar-1786396036.txt (0 MB)\n", stripColors(output.Get(0)))
+		assert.Equal(t, "[2] bambam/foo-1786396036.txt (0 MB)\n", stripColors(output.Get(1)))
+		assert.Equal(t, 0, output.exitCode)
+	})
+
+	t.Run("fail on modifying a catalog piped through stdin", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, catalog).RecordExit()
+
+		// execute
+		err := TagCommand(output, stdinDBFile, "bambam/baz.txt", []string{"keep"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "The DB read from stdin can't be modified\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Terms(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success printing the terms of a file name", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := TermsCommand(output, "/photos/2021.12.31-DSC_5070-Verbessert_RR - Bearbeitet.JPG")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, []string{"2021.12.31\n", "dsc_5070\n", "verbessert_rr\n", "bearbeitet.jpg\n"}, output.data)
+	})
+
+	t.Run("fail without file name", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := TermsCommand(output, "")
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "No file name given\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Under(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"/mnt/drive/photos/2023/beach.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+			"/mnt/drive/photos/2024/mountain.jpg,200,4d09a656f20fee1beb093f30c7ec504c",
+			"/mnt/drive/docs/taxes.pdf,300,788b62828f73d4bac70088ea91c90ef5",
+			"/mnt/drive-backup/photos/2023/beach.jpg,100,464f1ce84fed3d6837db4b810462f8de",
+		})
+	}
+
+	t.Run("success listing nested files", func(t *testing.T) {
+		t.Parallel()
+
+		dbFile := setup(t)
+
+		// setup
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := UnderCommand(output, dbFile, "/mnt/drive/photos", "")
 		require.NoError(t, err)
 
 		// verify
-		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
-		assert.Contains(t, clearColors(t, output.Get(1)), files[3])
+		assert.Equal(t, "[1] /mnt/drive/photos/2023/beach.jpg (0 MB)\n", stripColors(output.Get(0)))
+		assert.Equal(t, "[2] /mnt/drive/photos/2024/mountain.jpg (0 MB)\n", stripColors(output.Get(1)))
+		assert.Empty(t, output.Get(2))
 	})
 
-	t.Run("failure searching by term - fast", func(t *testing.T) {
+	t.Run("success not listing directories sharing a prefix", func(t *testing.T) {
 		t.Parallel()
 
 		dbFile := setup(t)
-		defer cleanup(t, dbFile)
 
 		// setup
 		output := NewTestOutput(t, nil)
 
 		// execute
-		err := TermSearchCommand(output, dbFile, fast, []string{"1786396036"})
+		err := UnderCommand(output, dbFile, "/mnt/drive", "")
 		require.NoError(t, err)
 
 		// verify
-		assert.Equal(t, "No results found for search term '1786396036'.\n", output.Get(0))
+		assert.Equal(t, "[1] /mnt/drive/docs/taxes.pdf (0 MB)\n", stripColors(output.Get(0)))
+		assert.Equal(t, "[2] /mnt/drive/photos/2023/beach.jpg (0 MB)\n", stripColors(output.Get(1)))
+		assert.Equal(t, "[3] /mnt/drive/photos/2024/mountain.jpg (0 MB)\n", stripColors(output.Get(2)))
+		assert.Empty(t, output.Get(3))
 	})
 
-	t.Run("failure searching by term - slow", func(t *testing.T) {
+	t.Run("success without files", func(t *testing.T) {
 		t.Parallel()
 
 		dbFile := setup(t)
-		defer cleanup(t, dbFile)
 
 		// setup
 		output := NewTestOutput(t, nil)
 
 		// execute
-		err := TermSearchCommand(output, dbFile, slow, []string{"abcde"})
+		err := UnderCommand(output, dbFile, "/mnt/other", "")
 		require.NoError(t, err)
 
 		// verify
-		assert.Equal(t, "No results found for search term 'abcde'.\n", output.Get(0))
+		assert.Equal(t, "No files found under /mnt/other\n", output.Get(0))
 	})
+}
 
-	t.Run("success searching by term", func(t *testing.T) {
+func TestApp_DedupRecords(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success removing duplicate rows", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dbFile := writeTestDB(t, []string{
+			"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de,1700000000",
+			"b/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c,1700000000",
+			"a/foo.txt,100,464f1ce84fed3d6837db4b810462f8de,1700000000",
+			"b/bar.txt,250,788b62828f73d4bac70088ea91c90ef5,1800000000",
+			"b/bar.txt,150,acbd18db4cc2f85cedef654fccc4a4d8,1600000000",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := DedupRecordsCommand(output, dbFile)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Removed 1 identical and 2 conflicting rows\n", output.Get(0))
+
+		content, err := os.ReadFile(dbFile)
+		require.NoError(t, err)
+		assert.Equal(t, 2, strings.Count(string(content), "\n"))
+
+		db := NewDB(output, dbFile)
+		db.Load()
+
+		require.Len(t, db.Files, 2)
+		assert.Equal(t, 250, db.Files["b/bar.txt"].Size)
+		assert.Equal(t, []ID{"b/bar.txt"}, db.Hashes["788b62828f73d4bac70088ea91c90ef5"])
+		assert.Equal(t, []ID{"a/foo.txt"}, db.Sizes[100])
+	})
+
+	t.Run("fail on binary DB", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := DedupRecordsCommand(output, filepath.Join(t.TempDir(), "db"+binaryDBExtension))
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "Only CSV DB files can contain duplicate rows\n", output.Get(0))
+		assert.Equal(t, 1, output.exitCode)
+	})
+}
+
+func TestApp_Orphans(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) string {
+		t.Helper()
+
+		return writeTestDB(t, []string{
+			"/data/foo.txt,100,464f1ce84fed3d6837db4b810462f8de",
+			"/data/sub/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c",
+			"/data2/baz.txt,300,788b62828f73d4bac70088ea91c90ef5",
+			"/old/quix.txt,400,acbd18db4cc2f85cedef654fccc4a4d8",
+		})
+	}
+
+	t.Run("success listing files outside of the given roots", func(t *testing.T) {
 		t.Parallel()
 
 		dbFile := setup(t)
-		defer cleanup(t, dbFile)
 
 		// setup
 		output := NewTestOutput(t, nil)
 
 		// execute
-		err := TermSearchCommand(output, dbFile, slow, []string{"1786396036"})
+		err := OrphansCommand(output, dbFile, []string{"/data/"})
 		require.NoError(t, err)
 
 		// verify
-		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
-		assert.Contains(t, clearColors(t, output.Get(1)), files[3])
+		assert.Equal(t, "/data2/baz.txt\n", output.Get(0))
+		assert.Equal(t, "/old/quix.txt\n", output.Get(1))
+		assert.Equal(t, "Orphaned files: 2\n", output.Get(2))
 	})
 
-	t.Run("success searching by multiple terms", func(t *testing.T) {
+	t.Run("success using the roots scanned before", func(t *testing.T) {
 		t.Parallel()
 
 		dbFile := setup(t)
-		defer cleanup(t, dbFile)
 
 		// setup
 		output := NewTestOutput(t, nil)
 
+		err := os.WriteFile(dbFile+metaFileSuffix, []byte("/data,2024-01-01T00:00:00Z\n/data2,2024-01-01T00:00:00Z\n"), 0o644)
+		require.NoError(t, err)
+
 		// execute
-		err := TermSearchCommand(output, dbFile, slow, []string{"bar", "1786396036"})
+		err = OrphansCommand(output, dbFile, nil)
 		require.NoError(t, err)
 
 		// verify
-		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
-		assert.Empty(t, output.Get(1))
+		assert.Equal(t, "/old/quix.txt\n", output.Get(0))
+		assert.Equal(t, "Orphaned files: 1\n", output.Get(1))
 	})
 
-	t.Run("success searching by file", func(t *testing.T) {
+	t.Run("success using the stored roots of the files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		// - the stored root takes precedence over the path of the file
+		dbFile := writeTestDB(t, []string{
+			"/data/foo.txt,100,464f1ce84fed3d6837db4b810462f8de,,,,,,,/data",
+			"/data/bar.txt,200,4d09a656f20fee1beb093f30c7ec504c,,,,,,,/old",
+		})
+
+		output := NewTestOutput(t, nil)
+
+		// execute
+		err := OrphansCommand(output, dbFile, []string{"/data"})
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, "/data/bar.txt\n", output.Get(0))
+		assert.Equal(t, "Orphaned files: 1\n", output.Get(1))
+	})
+
+	t.Run("failure without roots", func(t *testing.T) {
 		t.Parallel()
 
 		dbFile := setup(t)
-		defer cleanup(t, dbFile)
 
 		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := OrphansCommand(output, dbFile, nil)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 1, output.exitCode)
+		assert.Equal(t, "No roots given and no roots were scanned before\n", output.Get(0))
+	})
+}
+
+func Test_isUnderRoot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path     string
+		root     string
+		expected bool
+	}{
+		{path: "/data/foo.txt", root: "/data", expected: true},
+		{path: "/data/foo.txt", root: "/data/", expected: true},
+		{path: "/data", root: "/data", expected: true},
+		{path: "/data2/foo.txt", root: "/data", expected: false},
+		{path: "/data/foo.txt", root: "/", expected: true},
+		{path: "foo/bar.txt", root: ".", expected: true},
+		{path: "../foo.txt", root: ".", expected: false},
+		{path: "foo/bar.txt", root: "./foo", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" in "+tt.root, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.expected, isUnderRoot(tt.path, tt.root))
+		})
+	}
+}
+
+func Test_isRecordUnderRoot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		record   Record
+		root     string
+		expected bool
+	}{
+		{name: "unknown root inside", record: Record{Path: "/data/foo.txt"}, root: "/data", expected: true},
+		{name: "unknown root outside", record: Record{Path: "/data2/foo.txt"}, root: "/data", expected: false},
+		{name: "same root", record: Record{Path: "/mnt/a/foo.txt", Root: "/data"}, root: "/data/", expected: true},
+		{name: "root inside", record: Record{Path: "/data/sub/foo.txt", Root: "/data/sub"}, root: "/data", expected: true},
+		{name: "other root", record: Record{Path: "/data/foo.txt", Root: "/data2"}, root: "/data", expected: false},
+		{name: "directory of the root", record: Record{Path: "/data/sub/foo.txt", Root: "/data"}, root: "/data/sub", expected: true},
+		{name: "other directory of the root", record: Record{Path: "/data/foo.txt", Root: "/data"}, root: "/data/sub", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.expected, isRecordUnderRoot(tt.record, tt.root))
+		})
+	}
+}
+
+func TestApp_PartialDuplicates(t *testing.T) {
+	t.Parallel()
+
+	t.Run("failure without experimental flag", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		output := NewTestOutput(t, nil).RecordExit()
+
+		// execute
+		err := PartialDuplicatesCommand(output, "db.csv", false)
+		require.NoError(t, err)
+
+		// verify
+		assert.Equal(t, 1, output.exitCode)
+		assert.Equal(t, "partial-duplicates is experimental, use --experimental to run it anyway\n", output.Get(0))
+	})
+
+	t.Run("success finding truncated files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		root := t.TempDir()
+		dbFile := filepath.Join(t.TempDir(), "db.csv")
+		require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+		content := make([]byte, 2*MB)
+		for i := range content {
+			content[i] = byte(rand.IntN(256))
+		}
+
+		different := slices.Clone(content[:MB+10])
+		different[MB+5]++
+
+		full := filepath.Join(root, "full.bin")
+		truncated := filepath.Join(root, "truncated.bin")
+		require.NoError(t, os.WriteFile(full, content, 0o644))
+		require.NoError(t, os.WriteFile(truncated, content[:MB+MB/2], 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "different.bin"), different, 0o644))
+
+		require.NoError(t, ScanCommand(NewTestOutput(t, nil), dbFile, []string{root}, ScanOptions{}))
+
 		output := NewTestOutput(t, nil)
 
 		// execute
-		err := FileSearchCommand(output, dbFile, slow, files[1])
+		err := PartialDuplicatesCommand(output, dbFile, true)
 		require.NoError(t, err)
 
 		// verify
-		assert.Contains(t, clearColors(t, output.Get(0)), files[1])
-		assert.Empty(t, output.Get(1))
+		assert.Equal(t, fmt.Sprintf("Partial duplicate: %s is a prefix of %s (1.5 MB of 2.0 MB)\n", truncated, full), output.Get(0))
+		assert.Equal(t, "Partial duplicates found: 1\n", output.Get(1))
 	})
 }
 
@@ -509,6 +7305,7 @@ func Test_FindHighlights(t *testing.T) {
 	type args struct {
 		haystack string
 		needles  []string
+		mode     string
 	}
 	tests := []struct {
 		name string
@@ -539,6 +7336,65 @@ func Test_FindHighlights(t *testing.T) {
 			},
 			want: "\033[1m\033[31mhElLo\033[0m \033[1m\033[31mWorld\033[0m, hello peter",
 		},
+		{
+			name: "matched term in the file name instead of the directory",
+			args: args{
+				haystack: "photos/bar/2021-bar-1786.jpg",
+				needles:  []string{"bar", "1786"},
+			},
+			want: "photos/bar/2021-\033[1m\033[31mbar\033[0m-\033[1m\033[31m1786\033[0m.jpg",
+		},
+		{
+			name: "matched term after a character changing length when lowercased",
+			args: args{
+				haystack: "\u212Aelvin-foo.txt",
+				needles:  []string{"foo.txt"},
+			},
+			want: "\u212Aelvin-\033[1m\033[31mfoo.txt\033[0m",
+		},
+		{
+			name: "matched term changing length when lowercased",
+			args: args{
+				haystack: "photos/\u212Aelvin-foo.txt",
+				needles:  []string{"kelvin"},
+			},
+			want: "photos/\033[1m\033[31m\u212Aelvin\033[0m-foo.txt",
+		},
+		{
+			name: "needle spanning terms",
+			args: args{
+				haystack: "photos/bar-1786.jpg",
+				needles:  []string{"bar-1786"},
+			},
+			want: "photos/\033[1m\033[31mbar-1786\033[0m.jpg",
+		},
+		{
+			name: "term contained by an earlier term in slow mode",
+			args: args{
+				haystack: "photos/holidays-holiday.jpg",
+				needles:  []string{"holiday"},
+				mode:     slow,
+			},
+			want: "photos/\033[1m\033[31mholiday\033[0ms-holiday.jpg",
+		},
+		{
+			name: "term matched exactly in fast mode",
+			args: args{
+				haystack: "photos/holidays-holiday-2021.jpg",
+				needles:  []string{"holiday"},
+				mode:     fast,
+			},
+			want: "photos/holidays-\033[1m\033[31mholiday\033[0m-2021.jpg",
+		},
+		{
+			name: "term only contained in fast mode",
+			args: args{
+				haystack: "photos/holidays-2021.jpg",
+				needles:  []string{"holiday"},
+				mode:     fast,
+			},
+			want: "photos/\033[1m\033[31mholiday\033[0ms-2021.jpg",
+		},
 		{
 			name: "skip overlaps",
 			args: args{
@@ -553,7 +7409,136 @@ func Test_FindHighlights(t *testing.T) {
 			t.Parallel()
 
 			// execute
-			got := FindHighlights(tt.args.haystack, tt.args.needles)
+			got := FindHighlights(tt.args.haystack, tt.args.needles, tt.args.mode)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_rateLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success pacing reads", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		const rate = 10 * 1024
+
+		limiter := newRateLimiter(rate)
+		start := time.Now()
+
+		// execute
+		// - the first 10KB fit in the bucket, the last 5KB have to wait for ~0.5s
+		for range 3 {
+			limiter.wait(5 * 1024)
+		}
+
+		// verify
+		elapsed := time.Since(start)
+		assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+		assert.Less(t, elapsed, 2*time.Second)
+	})
+
+	t.Run("success not limiting without rate", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		limiter := newRateLimiter(0)
+		start := time.Now()
+
+		// execute
+		for range 3 {
+			limiter.wait(MB)
+		}
+
+		// verify
+		assert.Nil(t, limiter)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+}
+
+func Test_parseByteSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw     string
+		want    int64
+		wantErr bool
+	}{
+		{raw: "", want: 0},
+		{raw: "512", want: 512},
+		{raw: "100KB", want: 100 * 1024},
+		{raw: "50mb", want: 50 * MB},
+		{raw: "1.5GB", want: 1536 * MB},
+		{raw: "abc", wantErr: true},
+		{raw: "-1MB", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got, err := parseByteSize(tt.raw)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_formatCount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{n: 0, want: "0"},
+		{n: 999, want: "999"},
+		{n: 12000, want: "12,000"},
+		{n: 1234567, want: "1,234,567"},
+		{n: -1234, want: "-1,234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got := formatCount(tt.n)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_formatBytes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{n: 0, want: "0 B"},
+		{n: 1023, want: "1023 B"},
+		{n: 1536, want: "1.5 KB"},
+		{n: 34 * 1024 * MB, want: "34.0 GB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got := formatBytes(tt.n)
 
 			// verify
 			assert.Equal(t, tt.want, got)
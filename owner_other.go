@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileOwner returns an empty owner, uid and gid only exist on Unix-like systems.
+func fileOwner(os.FileInfo) string {
+	return ""
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the owner of the file as uid:gid.
+func fileOwner(fileInfo os.FileInfo) string {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%d:%d", stat.Uid, stat.Gid)
+}